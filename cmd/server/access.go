@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* ============ ACCESS CONTROL ============ */
+
+// projectRole is what a user may do with a project. Each role includes the
+// ones below it.
+type projectRole int
+
+const (
+	roleNone   projectRole = iota
+	roleViewer             // read, run and search
+	roleEditor             // save new versions, index, create refs
+	roleAdmin              // delete, manage collaborators, retention and refs
+	roleOwner              // an admin no one else can remove
+)
+
+var roleNames = map[projectRole]string{roleViewer: "viewer", roleEditor: "editor", roleAdmin: "admin", roleOwner: "owner"}
+
+func (r projectRole) String() string { return roleNames[r] }
+
+// parseCollaboratorRole parses the roles a collaborator can be given.
+func parseCollaboratorRole(s string) (projectRole, bool) {
+	for _, r := range []projectRole{roleViewer, roleEditor, roleAdmin} {
+		if roleNames[r] == s {
+			return r, true
+		}
+	}
+	return roleNone, false
+}
+
+// userIDKey holds the caller's user ID, as set by authenticate.
+const userIDKey = "userID"
+
+// currentUser returns the caller's user ID, or "" for anonymous requests.
+func currentUser(c *gin.Context) string {
+	return c.GetString(userIDKey)
+}
+
+// saveOwner is the owner recorded if a save creates a project: the one an
+// API admin names, else the signed-in caller. Anonymous requests cannot
+// choose an owner.
+func saveOwner(c *gin.Context, requested string) string {
+	if requested != "" && c.GetString(userRoleKey) == callerAdmin {
+		return requested
+	}
+	return currentUser(c)
+}
+
+// saveAuthor is the author recorded with a version: the one an API admin
+// names, else the signed-in caller. Only when the API cannot tell users apart
+// is the author the client claims taken as given.
+func saveAuthor(c *gin.Context, requested string) string {
+	if requested != "" && c.GetString(userRoleKey) == callerAdmin {
+		return requested
+	}
+	if user := currentUser(c); user != "" || authEnabled() {
+		return user
+	}
+	return requested
+}
+
+// roleOf returns the role userID has in a project. Projects without an owner
+// predate access control or were saved while the API could not tell users
+// apart: everyone may change them then, but only read them once it can.
+func roleOf(meta ProjectMeta, userID string) projectRole {
+	switch {
+	case meta.Owner == "" && !authEnabled():
+		return roleAdmin
+	case meta.Owner == "":
+		return roleViewer
+	case userID != "" && userID == meta.Owner:
+		return roleOwner
+	}
+	if userID != "" {
+		if r, ok := parseCollaboratorRole(meta.Collaborators[userID]); ok {
+			return r
+		}
+	}
+	if meta.Public {
+		return roleViewer
+	}
+	return roleNone
+}
+
+// callerProjectRole is the caller's role in a project. API admins (see
+// authenticate) act as its owner.
+func callerProjectRole(c *gin.Context, meta ProjectMeta) projectRole {
+	if c.GetString(userRoleKey) == callerAdmin {
+		return roleOwner
+	}
+	return roleOf(meta, currentUser(c))
+}
+
+// checkAccess reports whether the caller holds at least the role need in
+// projID and answers the request when they do not: 401 for anonymous
+// callers, 404 for users who cannot see the project and 403 for those whose
+// role is too low. Unknown projects pass, as a save creates them, except
+// that with authentication configured anonymous callers cannot create
+// ownerless projects; any other error reading the project refuses the
+// request.
+func checkAccess(c *gin.Context, projID string, need projectRole) (ProjectMeta, bool) {
+	meta, err := store.GetMeta(projID)
+	switch {
+	case errors.Is(err, errNotFound):
+		if need >= roleEditor && authEnabled() && currentUser(c) == "" && c.GetString(userRoleKey) != callerAdmin {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "sign in to create a project", "code": "unauthenticated"})
+			return meta, false
+		}
+		return meta, true
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return meta, false
+	}
+	have := callerProjectRole(c, meta)
+	switch {
+	case have >= need:
+		return meta, true
+	case currentUser(c) == "":
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required", "code": "unauthenticated"})
+	case have == roleNone:
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"error": "this requires the " + need.String() + " role", "code": "forbidden", "role": have.String()})
+	}
+	return meta, false
+}
+
+// authorize is checkAccess for routes that also refuse projects in the trash.
+func authorize(c *gin.Context, projID string, need projectRole) bool {
+	meta, ok := checkAccess(c, projID, need)
+	if ok && meta.DeletedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":      "project is in the trash",
+			"code":       "project_deleted",
+			"deletedAt":  meta.DeletedAt,
+			"purgeAfter": purgeAfter(*meta.DeletedAt),
+		})
+		return false
+	}
+	return ok
+}
+
+// requireRole guards a route of the project routeProjectID names.
+func requireRole(need projectRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authorize(c, routeProjectID(c), need) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+/* ---------- Collaborators ---------- */
+
+type Collaborator struct {
+	UserID string `json:"userId"`
+	Role   string `json:"role"`
+}
+
+func respondCollaborators(c *gin.Context, meta ProjectMeta) {
+	list := []Collaborator{}
+	for id, role := range meta.Collaborators {
+		list = append(list, Collaborator{UserID: id, Role: role})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].UserID < list[j].UserID })
+	c.JSON(http.StatusOK, gin.H{
+		"projectId":     meta.ProjectID,
+		"owner":         meta.Owner,
+		"public":        meta.Public,
+		"collaborators": list,
+		"role":          callerProjectRole(c, meta).String(),
+	})
+}
+
+// reloadCollaborators answers with the access settings after a change.
+func reloadCollaborators(c *gin.Context, projID string, err error) {
+	if err == nil {
+		var meta ProjectMeta
+		if meta, err = store.GetMeta(projID); err == nil {
+			respondCollaborators(c, meta)
+			return
+		}
+	}
+	if errors.Is(err, errNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// getCollaborators serves GET /api/projects/:id/collaborators.
+func getCollaborators(c *gin.Context) {
+	meta, err := store.GetMeta(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	respondCollaborators(c, meta)
+}
+
+// putCollaborator serves PUT /api/projects/:id/collaborators/:userId with
+// {"role": "viewer" | "editor" | "admin"}, which invites a user or changes
+// their role. Only the owner grants or takes away the admin role.
+func putCollaborator(c *gin.Context) {
+	projID, userID := c.Param("id"), c.Param("userId")
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role, ok := parseCollaboratorRole(req.Role)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be viewer, editor or admin"})
+		return
+	}
+	meta, err := store.GetMeta(projID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	switch {
+	case meta.Owner == "":
+		c.JSON(http.StatusConflict, gin.H{"error": "project has no owner, so it cannot have collaborators"})
+		return
+	case userID == meta.Owner:
+		c.JSON(http.StatusConflict, gin.H{"error": "the owner's role cannot be changed"})
+		return
+	}
+	current, _ := parseCollaboratorRole(meta.Collaborators[userID])
+	if (role == roleAdmin || current == roleAdmin) && callerProjectRole(c, meta) < roleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner can grant or revoke the admin role", "code": "forbidden"})
+		return
+	}
+	reloadCollaborators(c, projID, store.SetCollaborator(projID, userID, role.String()))
+}
+
+// deleteCollaborator serves DELETE /api/projects/:id/collaborators/:userId.
+// Collaborators may always remove themselves.
+func deleteCollaborator(c *gin.Context) {
+	projID, userID := c.Param("id"), c.Param("userId")
+	self := userID == currentUser(c)
+	need := roleAdmin
+	if self {
+		need = roleViewer
+	}
+	meta, ok := checkAccess(c, projID, need)
+	if !ok {
+		return
+	}
+	current, ok := parseCollaboratorRole(meta.Collaborators[userID])
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not a collaborator"})
+		return
+	}
+	if current == roleAdmin && !self && callerProjectRole(c, meta) < roleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner can grant or revoke the admin role", "code": "forbidden"})
+		return
+	}
+	reloadCollaborators(c, projID, store.SetCollaborator(projID, userID, ""))
+}
+
+// putVisibility serves PUT /api/projects/:id/visibility with
+// {"public": true}, which lets anyone read the project.
+func putVisibility(c *gin.Context) {
+	projID := c.Param("id")
+	var req struct {
+		Public *bool `json:"public" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reloadCollaborators(c, projID, store.SetPublic(projID, *req.Public))
+}
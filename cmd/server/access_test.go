@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func as(user string) http.Header {
+	if user == "" {
+		return nil
+	}
+	return http.Header{"X-User-Id": {user}}
+}
+
+func TestEveryProjectRouteChecksAccess(t *testing.T) {
+	r := newTestRouter(t)
+	trustUsers(t)
+	doJSONWithHeader(t, r, http.MethodPost, "/api/projects/private", gin.H{"tree": sampleTree()}, as("alice"))
+
+	replacer := strings.NewReplacer(":id", "private", ":projectId", "private", "*path", "main.sw", "*name", "v1",
+		":version", "00000000-0000-1000-8000-000000000000", ":userId", "bob")
+	checked := 0
+	for _, route := range r.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/projects/:id") && !strings.HasPrefix(route.Path, "/ws/") {
+			continue
+		}
+		url := replacer.Replace(route.Path)
+		if w := doJSON(t, r, route.Method, url, gin.H{}); w.Code != http.StatusUnauthorized {
+			t.Errorf("anonymous %s %s = %d, want 401", route.Method, url, w.Code)
+		}
+		checked++
+	}
+	if checked < 30 {
+		t.Errorf("checked %d project routes", checked)
+	}
+	for url, body := range map[string]gin.H{
+		"/api/session/s/save?project=private": nil,
+		"/api/search/similar":                 {"projectId": "private", "text": "andika"},
+	} {
+		if w := doJSON(t, r, http.MethodPost, url, body); w.Code != http.StatusUnauthorized {
+			t.Errorf("anonymous POST %s = %d, want 401", url, w.Code)
+		}
+	}
+	indexJobs.Store("private-job", &IndexJob{JobID: "private-job", ProjectID: "private"})
+	if w := doJSON(t, r, http.MethodGet, "/api/index/private-job", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous GET of index job = %d, want 401", w.Code)
+	}
+}
+
+// flakyMetaStore fails every metadata read, like a database timing out.
+type flakyMetaStore struct{ ProjectStore }
+
+func (flakyMetaStore) GetMeta(projectID string) (ProjectMeta, error) {
+	return ProjectMeta{ProjectID: projectID}, errors.New("read timeout")
+}
+
+func TestAccessCheckFailsClosed(t *testing.T) {
+	r := newTestRouter(t)
+	trustUsers(t)
+	doJSONWithHeader(t, r, http.MethodPost, "/api/projects/private", gin.H{"tree": sampleTree()}, as("alice"))
+	store = flakyMetaStore{store}
+	for _, url := range []string{"/api/projects/private", "/api/projects/private/files/main.sw"} {
+		if w := doJSON(t, r, http.MethodGet, url, nil); w.Code != http.StatusInternalServerError {
+			t.Errorf("GET %s with a failing store = %d, want 500", url, w.Code)
+		}
+	}
+}
+
+func TestCollaborators(t *testing.T) {
+	r := newTestRouter(t)
+	trustUsers(t)
+	call := func(user, method, url string, body interface{}) int {
+		t.Helper()
+		return doJSONWithHeader(t, r, method, url, body, as(user)).Code
+	}
+	save := gin.H{"tree": sampleTree()}
+	if code := call("alice", http.MethodPost, "/api/projects/demo", save); code != http.StatusCreated {
+		t.Fatalf("save as alice = %d", code)
+	}
+
+	if code := call("bob", http.MethodGet, "/api/projects/demo", nil); code != http.StatusNotFound {
+		t.Errorf("GET as stranger = %d, want 404", code)
+	}
+	if code := call("", http.MethodGet, "/api/projects/demo", nil); code != http.StatusUnauthorized {
+		t.Errorf("anonymous GET = %d, want 401", code)
+	}
+
+	call("alice", http.MethodPut, "/api/projects/demo/collaborators/bob", gin.H{"role": "viewer"})
+	if code := call("bob", http.MethodGet, "/api/projects/demo", nil); code != http.StatusOK {
+		t.Errorf("GET as viewer = %d, want 200", code)
+	}
+	if code := call("bob", http.MethodPost, "/api/projects/demo", save); code != http.StatusForbidden {
+		t.Errorf("save as viewer = %d, want 403", code)
+	}
+	call("alice", http.MethodPut, "/api/projects/demo/collaborators/bob", gin.H{"role": "editor"})
+	if code := call("bob", http.MethodPost, "/api/projects/demo", save); code != http.StatusCreated {
+		t.Errorf("save as editor = %d, want 201", code)
+	}
+	if code := call("bob", http.MethodDelete, "/api/projects/demo", nil); code != http.StatusForbidden {
+		t.Errorf("delete as editor = %d, want 403", code)
+	}
+	if code := call("bob", http.MethodPut, "/api/projects/demo/collaborators/carol", gin.H{"role": "viewer"}); code != http.StatusForbidden {
+		t.Errorf("invite as editor = %d, want 403", code)
+	}
+
+	// Admins manage collaborators, but only the owner hands out admin.
+	call("alice", http.MethodPut, "/api/projects/demo/collaborators/carol", gin.H{"role": "admin"})
+	if code := call("carol", http.MethodPut, "/api/projects/demo/collaborators/dave", gin.H{"role": "viewer"}); code != http.StatusOK {
+		t.Errorf("invite as admin = %d, want 200", code)
+	}
+	if code := call("carol", http.MethodPut, "/api/projects/demo/collaborators/bob", gin.H{"role": "admin"}); code != http.StatusForbidden {
+		t.Errorf("admin granting admin = %d, want 403", code)
+	}
+	if code := call("carol", http.MethodPut, "/api/projects/demo/collaborators/alice", gin.H{"role": "viewer"}); code != http.StatusConflict {
+		t.Errorf("changing the owner = %d, want 409", code)
+	}
+	if code := call("alice", http.MethodPut, "/api/projects/demo/collaborators/bob", gin.H{"role": "owner"}); code != http.StatusBadRequest {
+		t.Errorf("granting owner = %d, want 400", code)
+	}
+
+	if code := call("dave", http.MethodDelete, "/api/projects/demo/collaborators/bob", nil); code != http.StatusForbidden {
+		t.Errorf("viewer removing someone = %d, want 403", code)
+	}
+	if code := call("dave", http.MethodDelete, "/api/projects/demo/collaborators/dave", nil); code != http.StatusOK {
+		t.Errorf("viewer leaving = %d, want 200", code)
+	}
+	var res struct {
+		Owner         string         `json:"owner"`
+		Collaborators []Collaborator `json:"collaborators"`
+		Role          string         `json:"role"`
+	}
+	decodeJSON(t, doJSONWithHeader(t, r, http.MethodGet, "/api/projects/demo/collaborators", nil, as("bob")), &res)
+	if res.Owner != "alice" || res.Role != "editor" || len(res.Collaborators) != 2 || res.Collaborators[0] != (Collaborator{"bob", "editor"}) {
+		t.Errorf("collaborators = %+v", res)
+	}
+
+	// Public projects are readable by anyone, and only readable.
+	if code := call("bob", http.MethodPut, "/api/projects/demo/visibility", gin.H{"public": true}); code != http.StatusForbidden {
+		t.Errorf("visibility as editor = %d, want 403", code)
+	}
+	if code := call("alice", http.MethodPut, "/api/projects/demo/visibility", gin.H{"public": true}); code != http.StatusOK {
+		t.Fatalf("visibility as owner = %d", code)
+	}
+	if code := call("", http.MethodGet, "/api/projects/demo/files/main.sw", nil); code != http.StatusOK {
+		t.Errorf("anonymous GET of public project = %d, want 200", code)
+	}
+	if code := call("", http.MethodPost, "/api/projects/demo", save); code != http.StatusUnauthorized {
+		t.Errorf("anonymous save of public project = %d, want 401", code)
+	}
+	if code := call("eve", http.MethodPatch, "/api/projects/demo", gin.H{"ops": []gin.H{{"op": "delete", "path": "main.sw"}}}); code != http.StatusForbidden {
+		t.Errorf("stranger patching public project = %d, want 403", code)
+	}
+	var list struct {
+		Projects []ProjectMeta `json:"projects"`
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodGet, "/api/projects", nil), &list)
+	if len(list.Projects) != 1 {
+		t.Errorf("anonymous listing = %+v, want the public project", list.Projects)
+	}
+}
+
+func TestVersionAuthorIsCaller(t *testing.T) {
+	r := newTestRouter(t)
+	trustUsers(t)
+	t.Setenv("ADMIN_TOKEN", "secret")
+	latestAuthor := func() string {
+		t.Helper()
+		var page struct {
+			Versions []VersionInfo `json:"versions"`
+		}
+		decodeJSON(t, doJSONWithHeader(t, r, http.MethodGet, "/api/projects/demo/versions?limit=1", nil, as("alice")), &page)
+		if len(page.Versions) != 1 {
+			t.Fatalf("versions = %+v", page.Versions)
+		}
+		return page.Versions[0].Author
+	}
+
+	doJSONWithHeader(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree(), "author": "mallory"}, as("alice"))
+	if got := latestAuthor(); got != "alice" {
+		t.Errorf("author of alice's save = %q, want alice", got)
+	}
+	doJSONWithHeader(t, r, http.MethodPut, "/api/projects/demo/collaborators/bob", gin.H{"role": "editor"}, as("alice"))
+	doJSONWithHeader(t, r, http.MethodPut, "/api/projects/demo/files/notes.txt?author=mallory", gin.H{"content": "hi"}, as("bob"))
+	if got := latestAuthor(); got != "bob" {
+		t.Errorf("author of bob's file save = %q, want bob", got)
+	}
+	admin := http.Header{"Authorization": {"Bearer secret"}}
+	doJSONWithHeader(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree(), "author": "migration"}, admin)
+	if got := latestAuthor(); got != "migration" {
+		t.Errorf("author named by an admin = %q, want migration", got)
+	}
+}
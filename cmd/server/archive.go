@@ -0,0 +1,460 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+
+	"swalang-api-dualmode/internal/runner"
+)
+
+/* ============ ARCHIVE EXPORT & IMPORT ============ */
+
+const (
+	archiveZip   = "zip"
+	archiveTarGz = "tar.gz"
+)
+
+// walkTree calls fn for every node of a tree with its path, parents first.
+func walkTree(nodes []FileSystemNode, prefix string, fn func(p string, n *FileSystemNode) error) error {
+	for i := range nodes {
+		n := &nodes[i]
+		p := path.Join(prefix, n.Name)
+		if err := fn(p, n); err != nil {
+			return err
+		}
+		if n.Type == "folder" {
+			if err := walkTree(n.Children, p, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeArchive writes tree to w as a zip or gzipped tar. Nodes whose path
+// would escape the archive root are left out.
+func writeArchive(w io.Writer, format string, tree []FileSystemNode, modTime time.Time) error {
+	type entry struct {
+		path  string
+		isDir bool
+		data  []byte
+	}
+	var entries []entry
+	walkTree(tree, "", func(p string, n *FileSystemNode) error {
+		if _, err := runner.ValidatePath(p, 0); err != nil {
+			return nil
+		}
+		entries = append(entries, entry{path: p, isDir: n.Type == "folder", data: []byte(n.Content)})
+		return nil
+	})
+
+	switch format {
+	case archiveZip:
+		zw := zip.NewWriter(w)
+		for _, e := range entries {
+			h := &zip.FileHeader{Name: e.path, Method: zip.Deflate, Modified: modTime}
+			if e.isDir {
+				h.Name += "/"
+				h.Method = zip.Store
+				h.SetMode(os.ModeDir | 0755)
+			} else {
+				h.SetMode(0644)
+			}
+			f, err := zw.CreateHeader(h)
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(e.data); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	case archiveTarGz:
+		gz := gzip.NewWriter(w)
+		tw := tar.NewWriter(gz)
+		for _, e := range entries {
+			h := &tar.Header{Name: e.path, Mode: 0644, Size: int64(len(e.data)), ModTime: modTime, Typeflag: tar.TypeReg}
+			if e.isDir {
+				h.Name, h.Mode, h.Size, h.Typeflag = e.path+"/", 0755, 0, tar.TypeDir
+			}
+			if err := tw.WriteHeader(h); err != nil {
+				return err
+			}
+			if _, err := tw.Write(e.data); err != nil {
+				return err
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+	return fmt.Errorf("unsupported archive format %q", format)
+}
+
+// ImportSkip is an archive entry that was left out of an import.
+type ImportSkip struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"` // "link" or "unsupported"
+}
+
+// archiveImport collects the files and folders of an archive, enforcing
+// the import limits as entries are read.
+type archiveImport struct {
+	limits  ImportLimits
+	strip   int
+	files   map[string]string
+	folders map[string]bool
+	skipped []ImportSkip
+	total   int64
+}
+
+func newArchiveImport(limits ImportLimits, strip int) *archiveImport {
+	return &archiveImport{limits: limits, strip: strip, files: make(map[string]string), folders: make(map[string]bool), skipped: []ImportSkip{}}
+}
+
+// entryPath validates an entry name and applies strip. An empty result means
+// the entry is dropped.
+func (imp *archiveImport) entryPath(name string) (string, error) {
+	name = strings.TrimSuffix(name, "/")
+	if name == "" || name == "." {
+		return "", nil
+	}
+	p, err := runner.ValidatePath(name, 0)
+	if err != nil {
+		return "", fmt.Errorf("archive entry %q: %w", name, err)
+	}
+	if strings.HasPrefix(p, "__MACOSX/") || p == "__MACOSX" {
+		return "", nil
+	}
+	parts := strings.Split(p, "/")
+	if len(parts) <= imp.strip {
+		return "", nil
+	}
+	return strings.Join(parts[imp.strip:], "/"), nil
+}
+
+func (imp *archiveImport) addDir(name string) error {
+	p, err := imp.entryPath(name)
+	if p != "" {
+		imp.folders[p] = true
+	}
+	return err
+}
+
+func (imp *archiveImport) addFile(name string, r io.Reader) error {
+	p, err := imp.entryPath(name)
+	if p == "" {
+		return err
+	}
+	if _, dup := imp.files[p]; !dup && len(imp.files) >= imp.limits.MaxFiles {
+		return &QuotaError{Code: "too_many_files", Limit: int64(imp.limits.MaxFiles),
+			Msg: fmt.Sprintf("archive holds more than %d files", imp.limits.MaxFiles)}
+	}
+	data, err := io.ReadAll(io.LimitReader(r, imp.limits.MaxFileBytes+1))
+	if err != nil {
+		return fmt.Errorf("read %s: %w", p, err)
+	}
+	if int64(len(data)) > imp.limits.MaxFileBytes {
+		return &QuotaError{Code: "file_too_large", Limit: imp.limits.MaxFileBytes,
+			Msg: fmt.Sprintf("%s exceeds the %d byte limit", p, imp.limits.MaxFileBytes)}
+	}
+	imp.total += int64(len(data))
+	if imp.total > imp.limits.MaxTotalBytes {
+		return &QuotaError{Code: "import_too_large", Limit: imp.limits.MaxTotalBytes,
+			Msg: fmt.Sprintf("archive expands to more than %d bytes", imp.limits.MaxTotalBytes)}
+	}
+	imp.files[p] = string(data)
+	return nil
+}
+
+// skipEntry records an entry that is not imported. Its name must still be
+// safe, so a link named ../x fails the import like a file would.
+func (imp *archiveImport) skipEntry(name, reason string) error {
+	p, err := imp.entryPath(name)
+	if p != "" {
+		imp.skip(p, reason)
+	}
+	return err
+}
+
+func (imp *archiveImport) skip(p, reason string) {
+	imp.skipped = append(imp.skipped, ImportSkip{Path: p, Reason: reason})
+}
+
+// tree builds the imported tree, keeping empty folders. A path that is both
+// a file and a folder is an error.
+func (imp *archiveImport) tree() ([]FileSystemNode, error) {
+	for p := range imp.files {
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			if _, ok := imp.files[dir]; ok {
+				return nil, fmt.Errorf("%s is both a file and a folder", dir)
+			}
+		}
+		if imp.folders[p] {
+			return nil, fmt.Errorf("%s is both a file and a folder", p)
+		}
+	}
+	tree := filesToTree(imp.files)
+	folders := make([]string, 0, len(imp.folders))
+	for p := range imp.folders {
+		folders = append(folders, p)
+	}
+	sort.Strings(folders)
+	for _, p := range folders {
+		if findNode(tree, p) == nil {
+			tree = putNode(tree, p, FileSystemNode{Type: "folder", IsFolder: true})
+		}
+	}
+	sort.Slice(imp.skipped, func(i, j int) bool { return imp.skipped[i].Path < imp.skipped[j].Path })
+	return tree, nil
+}
+
+func detectArchiveFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return archiveZip
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return archiveTarGz
+	}
+	return ""
+}
+
+func readZip(data []byte, imp *archiveImport) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %w", err)
+	}
+	for _, f := range zr.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := imp.addDir(f.Name); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("open %s: %w", f.Name, err)
+			}
+			err = imp.addFile(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			if err := imp.skipEntry(f.Name, "link"); err != nil {
+				return err
+			}
+		default:
+			if err := imp.skipEntry(f.Name, "unsupported"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readTarGz(data []byte, imp *archiveImport) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invalid gzip stream: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = imp.addDir(h.Name)
+		case tar.TypeReg:
+			err = imp.addFile(h.Name, tr)
+		case tar.TypeSymlink, tar.TypeLink:
+			err = imp.skipEntry(h.Name, "link")
+		case tar.TypeXGlobalHeader:
+			// Archive-wide pax metadata, not an entry.
+		default:
+			err = imp.skipEntry(h.Name, "unsupported")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+/* ---------- Archive Handlers ---------- */
+
+// exportProject serves GET /api/projects/:id/export?format=zip|tar.gz,
+// with ?version= or ?ref= selecting the version (latest by default).
+func exportProject(c *gin.Context) {
+	projID := c.Param("id")
+	format := c.DefaultQuery("format", archiveZip)
+	if format != archiveZip && format != archiveTarGz {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `format must be "zip" or "tar.gz"`})
+		return
+	}
+	versionStr, status, err := queryVersion(c, projID)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if versionStr == "" {
+		meta, err := store.GetMeta(projID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+			return
+		}
+		versionStr = meta.LastVersion
+	}
+	versionUUID, err := gocql.ParseUUID(versionStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidVersion.Error()})
+		return
+	}
+	tree := loadFatWithCache(projID, &versionUUID)
+	if tree == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errProjectNotFound.Error()})
+		return
+	}
+
+	contentType := "application/zip"
+	if format == archiveTarGz {
+		contentType = "application/gzip"
+	}
+	filename := fmt.Sprintf("%s-%s.%s", path.Base(projID), versionStr[:8], format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Header("ETag", projectETag(versionStr))
+	c.Status(http.StatusOK)
+	if err := writeArchive(c.Writer, format, tree, versionUUID.Time()); err != nil {
+		// Headers are already sent; the truncated archive will not open.
+		c.Error(err)
+	}
+}
+
+// importProject serves POST /api/projects/:id/import. The archive is the
+// raw request body or the "file" field of a multipart form; its format is
+// detected from its content. It replaces the project tree as a new version.
+func importProject(c *gin.Context) {
+	projID := c.Param("id")
+	strip := 0
+	if v := c.Query("strip"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "strip must be a non-negative integer"})
+			return
+		}
+		strip = n
+	}
+
+	data, ok := readUpload(c)
+	if !ok {
+		return
+	}
+
+	imp := newArchiveImport(importLimits, strip)
+	format := detectArchiveFormat(data)
+	var err error
+	switch format {
+	case archiveZip:
+		err = readZip(data, imp)
+	case archiveTarGz:
+		err = readTarGz(data, imp)
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "body must be a zip or tar.gz archive"})
+		return
+	}
+	var tree []FileSystemNode
+	if err == nil {
+		tree, err = imp.tree()
+	}
+	var qe *QuotaError
+	if errors.As(err, &qe) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": qe.Msg, "code": qe.Code, "limit": qe.Limit})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(tree) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "archive contains no files"})
+		return
+	}
+
+	message := c.Query("message")
+	if message == "" {
+		message = "Import " + format + " archive"
+	}
+	base := baseVersionOf(c, "")
+	branch := c.Query("branch")
+	version, size, err := saveHybrid(projID, tree, SaveOptions{Owner: saveOwner(c, c.Query("owner")), Author: saveAuthor(c, c.Query("author")), Message: message, BaseVersion: base, Branch: branch})
+	if err != nil {
+		respondSaveError(c, projID, base, err)
+		return
+	}
+	broadcast(projID, updateMessage(version, size, branch))
+	c.Header("ETag", projectETag(version))
+	c.JSON(http.StatusCreated, gin.H{"projectId": projID, "version": version, "size": size, "fileCount": len(imp.files), "skipped": imp.skipped, "branch": branchName(branch)})
+}
+
+// readUpload reads an uploaded archive: the raw request body or the "file"
+// field of a multipart form. It writes the error response itself.
+func readUpload(c *gin.Context) ([]byte, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, importLimits.MaxArchiveBytes+1<<20)
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			respondArchiveReadError(c, fmt.Errorf("multipart form needs a \"file\" field: %w", err))
+			return nil, false
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		defer f.Close()
+		body = f
+	}
+	data, err := io.ReadAll(io.LimitReader(body, importLimits.MaxArchiveBytes+1))
+	if err == nil && int64(len(data)) > importLimits.MaxArchiveBytes {
+		err = &http.MaxBytesError{Limit: importLimits.MaxArchiveBytes}
+	}
+	if err != nil {
+		respondArchiveReadError(c, err)
+		return nil, false
+	}
+	return data, true
+}
+
+func respondArchiveReadError(c *gin.Context, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "archive too large", "code": "archive_too_large", "limit": importLimits.MaxArchiveBytes})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func postArchive(t *testing.T, r http.Handler, url, contentType string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func zipOf(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip create %s: %v", name, err)
+		}
+		f.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func tarGzOf(t *testing.T, headers []tar.Header, contents []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for i := range headers {
+		h := headers[i]
+		h.Size = int64(len(contents[i]))
+		if h.Mode == 0 {
+			h.Mode = 0644
+		}
+		if err := tw.WriteHeader(&h); err != nil {
+			t.Fatalf("tar header %s: %v", h.Name, err)
+		}
+		tw.Write([]byte(contents[i]))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	r := newTestRouter(t)
+	tree := putNode(sampleTree(), "assets", FileSystemNode{Type: "folder", IsFolder: true})
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": tree}); w.Code != http.StatusCreated {
+		t.Fatalf("save = %d", w.Code)
+	}
+
+	for _, format := range []string{"zip", "tar.gz"} {
+		w := doJSON(t, r, http.MethodGet, "/api/projects/demo/export?format="+format, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("export %s = %d %s", format, w.Code, w.Body)
+		}
+		w = postArchive(t, r, "/api/projects/copy-"+format+"/import", "application/octet-stream", w.Body.Bytes())
+		if w.Code != http.StatusCreated {
+			t.Fatalf("import %s = %d %s", format, w.Code, w.Body)
+		}
+		got := loadFatWithCache("copy-"+format, nil)
+		if !reflect.DeepEqual(got, tree) {
+			t.Errorf("%s round trip = %+v, want %+v", format, got, tree)
+		}
+	}
+
+	if w := doJSON(t, r, http.MethodGet, "/api/projects/demo/export?format=rar", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("export as rar = %d, want 400", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/projects/nope/export", nil); w.Code != http.StatusNotFound {
+		t.Errorf("export of unknown project = %d, want 404", w.Code)
+	}
+}
+
+func TestImportArchive(t *testing.T) {
+	r := newTestRouter(t)
+
+	// A multipart upload of a GitHub-style zip with one top-level folder.
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, _ := mw.CreateFormFile("file", "repo.zip")
+	fw.Write(zipOf(t, map[string]string{
+		"repo-main/main.sw":      "andika(1)",
+		"repo-main/lib/util.sw":  "kazi util() {}",
+		"repo-main/logo.png":     "\x89PNG\x00\x01",
+		"__MACOSX/repo-main/._x": "junk",
+		"repo-main/docs/":        "",
+		"repo-main/lib/../x.sw":  "",
+	}))
+	mw.Close()
+	w := postArchive(t, r, "/api/projects/demo/import?strip=1", mw.FormDataContentType(), form.Bytes())
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("import with .. entry = %d, want 400", w.Code)
+	}
+
+	form.Reset()
+	mw = multipart.NewWriter(&form)
+	fw, _ = mw.CreateFormFile("file", "repo.zip")
+	fw.Write(zipOf(t, map[string]string{
+		"repo-main/main.sw":      "andika(1)",
+		"repo-main/lib/util.sw":  "kazi util() {}",
+		"repo-main/logo.png":     "\x89PNG\x00\x01",
+		"__MACOSX/repo-main/._x": "junk",
+		"repo-main/docs/":        "",
+	}))
+	mw.Close()
+	w = postArchive(t, r, "/api/projects/demo/import?strip=1&message=Upload", mw.FormDataContentType(), form.Bytes())
+	var res struct {
+		FileCount int          `json:"fileCount"`
+		Skipped   []ImportSkip `json:"skipped"`
+	}
+	decodeJSON(t, w, &res)
+	if w.Code != http.StatusCreated || res.FileCount != 3 || len(res.Skipped) != 0 {
+		t.Fatalf("import zip = %d %s", w.Code, w.Body)
+	}
+	tree := loadFatWithCache("demo", nil)
+	if want := map[string]string{"main.sw": "andika(1)", "lib/util.sw": "kazi util() {}", "logo.png": "\x89PNG\x00\x01"}; !reflect.DeepEqual(treeToFiles(tree, ""), want) {
+		t.Errorf("imported files = %v, want %v", treeToFiles(tree, ""), want)
+	}
+	if n := findNode(tree, "docs"); n == nil || n.Type != "folder" {
+		t.Errorf("empty folder docs was not imported")
+	}
+
+	// Tar entries may not escape the project or link elsewhere.
+	for name, h := range map[string]tar.Header{
+		"absolute path": {Name: "/etc/passwd", Typeflag: tar.TypeReg},
+		"parent path":   {Name: "a/../../x", Typeflag: tar.TypeReg},
+		"link outside":  {Name: "../link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+	} {
+		w := postArchive(t, r, "/api/projects/demo/import", "application/gzip", tarGzOf(t, []tar.Header{h}, []string{"x"}))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("import with %s = %d, want 400", name, w.Code)
+		}
+	}
+	w = postArchive(t, r, "/api/projects/demo/import", "application/gzip", tarGzOf(t,
+		[]tar.Header{{Name: "./main.sw", Typeflag: tar.TypeReg}, {Name: "link", Typeflag: tar.TypeSymlink, Linkname: "main.sw"}},
+		[]string{"andika(2)", ""}))
+	decodeJSON(t, w, &res)
+	if w.Code != http.StatusCreated || !reflect.DeepEqual(res.Skipped, []ImportSkip{{Path: "link", Reason: "link"}}) {
+		t.Errorf("import tar.gz with link = %d %s", w.Code, w.Body)
+	}
+
+	if w := postArchive(t, r, "/api/projects/demo/import", "text/plain", []byte("not an archive")); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("import of plain text = %d, want 415", w.Code)
+	}
+}
+
+func TestImportLimits(t *testing.T) {
+	r := newTestRouter(t)
+	defer func(l ImportLimits) { importLimits = l }(importLimits)
+	importLimits = ImportLimits{MaxArchiveBytes: 1 << 20, MaxFiles: 2, MaxFileBytes: 100, MaxTotalBytes: 150}
+
+	for name, files := range map[string]map[string]string{
+		"too_many_files":   {"a": "1", "b": "2", "c": "3"},
+		"file_too_large":   {"a": string(bytes.Repeat([]byte("x"), 101))},
+		"import_too_large": {"a": string(bytes.Repeat([]byte("x"), 100)), "b": string(bytes.Repeat([]byte("x"), 51))},
+	} {
+		w := postArchive(t, r, "/api/projects/demo/import", "application/zip", zipOf(t, files))
+		var res struct {
+			Code string `json:"code"`
+		}
+		decodeJSON(t, w, &res)
+		if w.Code != http.StatusRequestEntityTooLarge || res.Code != name {
+			t.Errorf("%s: import = %d %s", name, w.Code, w.Body)
+		}
+	}
+	if _, err := store.GetMeta("demo"); err == nil {
+		t.Errorf("rejected imports saved a version")
+	}
+}
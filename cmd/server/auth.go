@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"swalang-api-dualmode/internal/auth"
+)
+
+/* ============ AUTHENTICATION ============ */
+
+// Callers authenticate with the access token Supabase gives a signed-in
+// user (Authorization: Bearer <jwt>). The token's subject becomes the user
+// ID that project access control works with.
+
+const userRoleKey = "userRole"
+
+// wsBearerProtocol is the WebSocket subprotocol that carries a bearer token.
+const wsBearerProtocol = "bearer"
+
+// Caller roles, as recorded under userRoleKey.
+const (
+	callerAnon          = "anon"
+	callerAuthenticated = "authenticated"
+	callerAdmin         = "admin"
+)
+
+// jwtVerifier checks bearer tokens; nil when no key is configured.
+var jwtVerifier *auth.Verifier
+
+// trustUserHeader makes the API take the user ID from X-User-ID when no
+// verifier is configured. Set TRUST_PROXY_USER_HEADER=1 only when a proxy in
+// front of the API authenticates users and sets the header itself.
+var trustUserHeader = os.Getenv("TRUST_PROXY_USER_HEADER") == "1"
+
+// loadJWTVerifier builds the verifier from SUPABASE_JWT_SECRET (HS256) and
+// SUPABASE_JWKS_FILE (a JWKS document with the project's public keys),
+// optionally requiring SUPABASE_JWT_ISSUER and SUPABASE_JWT_AUDIENCE.
+func loadJWTVerifier() (*auth.Verifier, error) {
+	secret, jwksFile := os.Getenv("SUPABASE_JWT_SECRET"), os.Getenv("SUPABASE_JWKS_FILE")
+	if secret == "" && jwksFile == "" {
+		return nil, nil
+	}
+	var jwks []byte
+	if jwksFile != "" {
+		var err error
+		if jwks, err = os.ReadFile(jwksFile); err != nil {
+			return nil, err
+		}
+	}
+	v, err := auth.NewVerifier([]byte(secret), jwks)
+	if err != nil {
+		return nil, err
+	}
+	v.Issuer = os.Getenv("SUPABASE_JWT_ISSUER")
+	v.Audience = os.Getenv("SUPABASE_JWT_AUDIENCE")
+	return v, nil
+}
+
+// callerRole maps token claims to a caller role. Supabase's service role
+// and users with app_metadata.role "admin" are admins.
+func callerRole(claims *auth.Claims) string {
+	switch {
+	case claims.Role == "service_role" || claims.AppMetadata["role"] == "admin":
+		return callerAdmin
+	case claims.Subject != "":
+		return callerAuthenticated
+	}
+	return callerAnon
+}
+
+// bearerToken returns the token of an Authorization: Bearer header. Browsers
+// cannot set headers on a WebSocket handshake, so upgrades may instead offer
+// the subprotocols "bearer, <token>"; the server then selects "bearer".
+func bearerToken(c *gin.Context) string {
+	h := c.GetHeader("Authorization")
+	if strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimSpace(h[len("Bearer "):])
+	}
+	if protocols := websocket.Subprotocols(c.Request); len(protocols) == 2 && protocols[0] == wsBearerProtocol {
+		return protocols[1]
+	}
+	return ""
+}
+
+// authenticate records the caller's user ID and role. ADMIN_TOKEN makes the
+// caller an admin. With a verifier, a bearer token must be a valid JWT and
+// X-User-ID is ignored; without one X-User-ID is only trusted when
+// trustUserHeader is set, and every caller is anonymous otherwise.
+func authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		adminToken := os.Getenv("ADMIN_TOKEN")
+		c.Set(userRoleKey, callerAnon)
+		switch {
+		case token != "" && adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1:
+			c.Set(userRoleKey, callerAdmin)
+		case jwtVerifier != nil:
+			if token == "" {
+				break
+			}
+			claims, err := jwtVerifier.Verify(token)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("invalid token: %v", err), "code": "invalid_token"})
+				return
+			}
+			if claims.Subject != "" {
+				c.Set(userIDKey, claims.Subject)
+			}
+			c.Set(userRoleKey, callerRole(claims))
+		case trustUserHeader:
+			if id := c.GetHeader("X-User-ID"); id != "" {
+				c.Set(userIDKey, id)
+				c.Set(userRoleKey, callerAuthenticated)
+			}
+		}
+		c.Next()
+	}
+}
+
+// authEnabled reports whether the API can tell users apart, with verified
+// tokens or a trusted proxy header.
+func authEnabled() bool {
+	return jwtVerifier != nil || trustUserHeader
+}
+
+// warnIfUnauthenticated logs when the API cannot tell users apart, which
+// leaves every project open to anonymous callers only.
+func warnIfUnauthenticated() {
+	if !authEnabled() {
+		log.Printf("WARNING: no SUPABASE_JWT_SECRET or SUPABASE_JWKS_FILE is set and TRUST_PROXY_USER_HEADER is off; " +
+			"every request is anonymous and X-User-ID headers are ignored")
+	}
+}
+
+// authLevel is what a route requires of the caller, before any project
+// access checks.
+type authLevel int
+
+const (
+	authAnonymous     authLevel = iota // anyone
+	authAuthenticated                  // a signed-in user or an admin
+	authAdmin                          // an admin
+)
+
+// authRequired guards a route with an authLevel.
+func authRequired(level authLevel) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString(userRoleKey)
+		switch {
+		case level == authAnonymous || role == callerAdmin:
+			c.Next()
+			return
+		case role == callerAnon || role == "":
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required", "code": "unauthenticated"})
+			return
+		case level == authAdmin:
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin role required", "code": "forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// adminAuth guards the admin API: callers need ADMIN_TOKEN or a token with
+// the admin role. It is disabled while neither can be checked.
+func adminAuth() gin.HandlerFunc {
+	requireAdmin := authRequired(authAdmin)
+	return func(c *gin.Context) {
+		if os.Getenv("ADMIN_TOKEN") == "" && jwtVerifier == nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin API disabled: ADMIN_TOKEN is not set"})
+			return
+		}
+		requireAdmin(c)
+	}
+}
+
+// getMe serves GET /api/me, the caller as the API sees them.
+func getMe(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"userId": currentUser(c), "role": c.GetString(userRoleKey)})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"swalang-api-dualmode/internal/auth"
+)
+
+// hs256Token signs claims the way Supabase does with its JWT secret.
+func hs256Token(secret string, claims map[string]interface{}) string {
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	body, _ := json.Marshal(claims)
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestSupabaseAuth(t *testing.T) {
+	r := newTestRouter(t)
+	v, err := auth.NewVerifier([]byte("jwt-secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtVerifier = v
+	t.Cleanup(func() { jwtVerifier = nil })
+	bearer := func(claims map[string]interface{}) http.Header {
+		if _, ok := claims["exp"]; !ok {
+			claims["exp"] = time.Now().Add(time.Hour).Unix()
+		}
+		return http.Header{"Authorization": {"Bearer " + hs256Token("jwt-secret", claims)}}
+	}
+	alice := bearer(map[string]interface{}{"sub": "alice", "role": "authenticated"})
+
+	var me struct {
+		UserID string `json:"userId"`
+		Role   string `json:"role"`
+	}
+	decodeJSON(t, doJSONWithHeader(t, r, http.MethodGet, "/api/me", nil, alice), &me)
+	if me.UserID != "alice" || me.Role != "authenticated" {
+		t.Errorf("GET /api/me = %+v", me)
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodGet, "/api/me", nil), &me)
+	if me.UserID != "" || me.Role != "anon" {
+		t.Errorf("anonymous GET /api/me = %+v", me)
+	}
+
+	if w := doJSONWithHeader(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree(), "owner": "mallory"}, alice); w.Code != http.StatusCreated {
+		t.Fatalf("save as alice = %d %s", w.Code, w.Body)
+	}
+	if meta, _ := store.GetMeta("demo"); meta.Owner != "alice" {
+		t.Errorf("owner = %q, want alice", meta.Owner)
+	}
+
+	for name, header := range map[string]http.Header{
+		"forged X-User-ID": {"X-User-Id": {"alice"}},
+		"anonymous":        nil,
+	} {
+		if w := doJSONWithHeader(t, r, http.MethodGet, "/api/projects/demo", nil, header); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s GET = %d, want 401", name, w.Code)
+		}
+	}
+	for name, header := range map[string]http.Header{
+		"wrong secret": {"Authorization": {"Bearer " + hs256Token("other", map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})}},
+		"expired":      bearer(map[string]interface{}{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()}),
+		"garbage":      {"Authorization": {"Bearer nope"}},
+	} {
+		w := doJSONWithHeader(t, r, http.MethodGet, "/api/session/new", nil, header)
+		var res struct {
+			Code string `json:"code"`
+		}
+		decodeJSON(t, w, &res)
+		if w.Code != http.StatusUnauthorized || res.Code != "invalid_token" {
+			t.Errorf("%s token = %d %s", name, w.Code, w.Body)
+		}
+	}
+
+	// Admins pass every project check and reach the admin API without
+	// ADMIN_TOKEN; other users do not.
+	admin := bearer(map[string]interface{}{"sub": "ops", "role": "authenticated", "app_metadata": gin.H{"role": "admin"}})
+	if w := doJSONWithHeader(t, r, http.MethodGet, "/api/projects/demo", nil, admin); w.Code != http.StatusOK {
+		t.Errorf("GET as admin = %d, want 200", w.Code)
+	}
+	if w := doJSONWithHeader(t, r, http.MethodGet, "/api/admin/gc", nil, admin); w.Code != http.StatusOK {
+		t.Errorf("GC as admin = %d %s", w.Code, w.Body)
+	}
+	if w := doJSONWithHeader(t, r, http.MethodGet, "/api/admin/gc", nil, alice); w.Code != http.StatusForbidden {
+		t.Errorf("GC as user = %d, want 403", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPut, "/api/projects/demo/visibility", gin.H{"public": true}); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous visibility change = %d, want 401", w.Code)
+	}
+}
+
+func TestUserHeaderNeedsOptIn(t *testing.T) {
+	r := newTestRouter(t)
+	trustUsers(t)
+	doJSONWithHeader(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree()}, as("alice"))
+
+	trustUserHeader = false
+	var me struct {
+		UserID string `json:"userId"`
+	}
+	decodeJSON(t, doJSONWithHeader(t, r, http.MethodGet, "/api/me", nil, as("alice")), &me)
+	if me.UserID != "" {
+		t.Errorf("GET /api/me without opt-in = %+v, want anonymous", me)
+	}
+	if w := doJSONWithHeader(t, r, http.MethodGet, "/api/projects/demo", nil, as("alice")); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET with X-User-ID and no opt-in = %d, want 401", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodOptions, "/api/projects/demo", nil); strings.Contains(w.Header().Get("Access-Control-Allow-Headers"), "X-User-ID") {
+		t.Errorf("CORS allows X-User-ID: %q", w.Header().Get("Access-Control-Allow-Headers"))
+	}
+}
+
+func TestWebSocketToken(t *testing.T) {
+	r := newTestRouter(t)
+	v, _ := auth.NewVerifier([]byte("jwt-secret"), nil)
+	jwtVerifier = v
+	t.Cleanup(func() { jwtVerifier = nil })
+	token := hs256Token("jwt-secret", map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+	doJSONWithHeader(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree()}, http.Header{"Authorization": {"Bearer " + token}})
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/demo"
+	ws, resp, err := (&websocket.Dialer{Subprotocols: []string{"bearer", token}}).Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial with token: %v", err)
+	}
+	if resp.Header.Get("Sec-WebSocket-Protocol") != "bearer" {
+		t.Errorf("selected subprotocol = %q, want bearer", resp.Header.Get("Sec-WebSocket-Protocol"))
+	}
+	ws.Close()
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous dial = %v, %v; want 401", resp, err)
+	}
+}
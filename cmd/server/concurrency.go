@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+/* ============ OPTIMISTIC CONCURRENCY ============ */
+
+// projectETag is the entity tag of a project version.
+func projectETag(version string) string {
+	return `"` + version + `"`
+}
+
+// baseVersionOf returns the version a save is based on: the If-Match header
+// when present, otherwise the baseVersion field of the request body.
+func baseVersionOf(c *gin.Context, fromBody string) string {
+	if tag := c.GetHeader("If-Match"); tag != "" && tag != "*" {
+		return strings.Trim(strings.TrimPrefix(tag, "W/"), `"`)
+	}
+	return fromBody
+}
+
+// etagMatches reports whether an If-None-Match header matches version.
+func etagMatches(header, version string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.Trim(strings.TrimPrefix(tag, "W/"), `"`) == version {
+			return true
+		}
+	}
+	return false
+}
+
+// respondSaveError writes the response for a failed save: 409 with the
+// current version and what changed since the base for conflicts, 404 for
+// unknown branches and 500 otherwise.
+func respondSaveError(c *gin.Context, projectID, base string, err error) {
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		c.JSON(refErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	respondConflict(c, projectID, base, conflict.CurrentVersion)
+}
+
+func respondConflict(c *gin.Context, projectID, base, current string) {
+	resp := gin.H{"error": "version conflict", "baseVersion": base, "currentVersion": current}
+	baseUUID, err1 := gocql.ParseUUID(base)
+	currentUUID, err2 := gocql.ParseUUID(current)
+	if err1 == nil && err2 == nil {
+		from := loadFatWithCache(projectID, &baseUUID)
+		to := loadFatWithCache(projectID, &currentUUID)
+		if from != nil && to != nil {
+			resp["diff"] = diffTrees(from, to, diffOptions{SummaryOnly: true})
+		}
+	}
+	if current != "" {
+		c.Header("ETag", projectETag(current))
+	}
+	c.JSON(http.StatusConflict, resp)
+}
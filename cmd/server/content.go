@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"swalang-api-dualmode/internal/diff"
+)
+
+/* ---------- Binary File Contents ---------- */
+
+// File contents are held as raw bytes in Go strings everywhere on the
+// server: in trees, blobs, split rows and sandboxes. Only JSON needs an
+// encoding, since it cannot carry arbitrary bytes. Text travels as is
+// ("utf8", the default) and binary contents as "base64".
+const (
+	encodingUTF8   = "utf8"
+	encodingBase64 = "base64"
+)
+
+// contentEncoding returns the encoding content is sent with.
+func contentEncoding(content string) string {
+	if diff.IsBinary(content) {
+		return encodingBase64
+	}
+	return encodingUTF8
+}
+
+// encodeContent returns content in the given encoding.
+func encodeContent(content, encoding string) string {
+	if encoding == encodingBase64 {
+		return base64.StdEncoding.EncodeToString([]byte(content))
+	}
+	return content
+}
+
+// decodeContent returns the raw bytes of content sent with encoding.
+func decodeContent(content, encoding string) (string, error) {
+	switch encoding {
+	case "", encodingUTF8:
+		return content, nil
+	case encodingBase64:
+		raw, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return "", fmt.Errorf("invalid base64 content: %w", err)
+		}
+		return string(raw), nil
+	}
+	return "", fmt.Errorf("unknown encoding %q (want utf8 or base64)", encoding)
+}
+
+// fileNodeJSON is the wire form of a FileSystemNode.
+type fileNodeJSON struct {
+	ID       string           `json:"id"`
+	Name     string           `json:"name"`
+	Type     string           `json:"type"`
+	Content  string           `json:"content,omitempty"`
+	Encoding string           `json:"encoding,omitempty"`
+	MimeType string           `json:"mimeType,omitempty"`
+	Children []FileSystemNode `json:"children,omitempty"`
+	IsFolder bool             `json:"isFolder,omitempty"`
+}
+
+// MarshalJSON sends binary contents base64-encoded with "encoding": "base64".
+func (n FileSystemNode) MarshalJSON() ([]byte, error) {
+	w := fileNodeJSON{ID: n.ID, Name: n.Name, Type: n.Type, Content: n.Content, MimeType: n.MimeType, Children: n.Children, IsFolder: n.IsFolder}
+	if enc := contentEncoding(n.Content); enc == encodingBase64 {
+		w.Content, w.Encoding = encodeContent(n.Content, enc), enc
+	}
+	return json.Marshal(w)
+}
+
+// UnmarshalJSON decodes contents sent with "encoding": "base64".
+func (n *FileSystemNode) UnmarshalJSON(data []byte) error {
+	var w fileNodeJSON
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	content, err := decodeContent(w.Content, w.Encoding)
+	if err != nil {
+		return fmt.Errorf("%s: %w", w.ID, err)
+	}
+	*n = FileSystemNode{ID: w.ID, Name: w.Name, Type: w.Type, Content: content, MimeType: w.MimeType, Children: w.Children, IsFolder: w.IsFolder}
+	return nil
+}
+
+// parseMimeType checks a MIME type given by a client and returns it in its
+// canonical form.
+func parseMimeType(s string) (string, error) {
+	t, params, err := mime.ParseMediaType(s)
+	if err != nil || !strings.Contains(t, "/") {
+		return "", fmt.Errorf("invalid mimeType %q", s)
+	}
+	return mime.FormatMediaType(t, params), nil
+}
+
+// fileContentType is the Content-Type a file is served with: its stored
+// MIME type, else the type of its extension, else a sniffed type for binary
+// contents and UTF-8 text for everything else.
+func fileContentType(name, mimeType, content string) string {
+	if t, err := parseMimeType(mimeType); err == nil {
+		return t
+	}
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	if diff.IsBinary(content) {
+		return http.DetectContentType([]byte(content))
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// servedInline reports whether a browser may display files of contentType
+// in place. Only passive types qualify: HTML, SVG, XML and anything else a
+// browser could run scripts from are sent as downloads.
+func servedInline(contentType string) bool {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch t {
+	case "text/plain", "text/csv", "text/markdown", "application/json", "application/octet-stream",
+		"image/png", "image/jpeg", "image/gif", "image/webp", "image/bmp", "image/x-icon", "image/vnd.microsoft.icon":
+		return true
+	}
+	return strings.HasPrefix(t, "audio/") || strings.HasPrefix(t, "video/")
+}
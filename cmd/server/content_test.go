@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const pngBytes = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\xff\xfe"
+
+func TestFileSystemNodeJSON(t *testing.T) {
+	tree := []FileSystemNode{
+		{ID: "main.sw", Name: "main.sw", Type: "file", Content: "andika(\"habari\")"},
+		{ID: "logo.png", Name: "logo.png", Type: "file", Content: pngBytes, MimeType: "image/png"},
+	}
+	raw, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var wire []map[string]string
+	json.Unmarshal(raw, &wire)
+	if wire[0]["encoding"] != "" || wire[1]["encoding"] != "base64" || wire[1]["content"] != base64.StdEncoding.EncodeToString([]byte(pngBytes)) {
+		t.Errorf("wire form = %s", raw)
+	}
+	var got []FileSystemNode
+	if err := json.Unmarshal(raw, &got); err != nil || !reflect.DeepEqual(got, tree) {
+		t.Errorf("round trip = %+v, %v", got, err)
+	}
+
+	for _, bad := range []string{
+		`{"name":"a","type":"file","content":"!!","encoding":"base64"}`,
+		`{"name":"a","type":"file","content":"x","encoding":"latin1"}`,
+	} {
+		var n FileSystemNode
+		if err := json.Unmarshal([]byte(bad), &n); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestBinaryFiles(t *testing.T) {
+	r := newTestRouter(t)
+	encoded := base64.StdEncoding.EncodeToString([]byte(pngBytes))
+	tree := []gin.H{
+		{"id": "main.sw", "name": "main.sw", "type": "file", "content": "andika(1)"},
+		{"id": "logo.png", "name": "logo.png", "type": "file", "content": encoded, "encoding": "base64"},
+		{"id": "data.bin", "name": "data.bin", "type": "file", "content": base64.StdEncoding.EncodeToString([]byte{0, 1, 2, 3, 4, 5, 6, 7}), "encoding": "base64", "mimeType": "application/x-sw-data"},
+	}
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": tree}); w.Code != http.StatusCreated {
+		t.Fatalf("save = %d %s", w.Code, w.Body)
+	}
+	if files, _ := splitFileContents("demo"); files["logo.png"] != pngBytes {
+		t.Errorf("split row = %q, want %q", files["logo.png"], pngBytes)
+	}
+
+	var got struct {
+		Tree []map[string]string `json:"tree"`
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodGet, "/api/projects/demo", nil), &got)
+	for _, n := range got.Tree {
+		if n["name"] == "logo.png" && (n["encoding"] != "base64" || n["content"] != encoded) {
+			t.Errorf("GET project returned %v", n)
+		}
+	}
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	for path, want := range map[string]string{
+		"/api/projects/demo/files/logo.png": "image/png",
+		"/api/projects/demo/files/data.bin": "application/x-sw-data",
+		"/api/projects/demo/files/main.sw":  "text/plain; charset=utf-8",
+	} {
+		w := get(path, nil)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != want {
+			t.Errorf("GET %s = %d %s", path, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+	w := get("/api/projects/demo/files/logo.png", nil)
+	if w.Body.String() != pngBytes {
+		t.Errorf("GET logo.png = %q", w.Body.String())
+	}
+	w = get("/api/projects/demo/files/data.bin", http.Header{"Range": {"bytes=2-4"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "\x02\x03\x04" || w.Header().Get("Content-Range") != "bytes 2-4/8" {
+		t.Errorf("range request = %d %q %s", w.Code, w.Body.String(), w.Header().Get("Content-Range"))
+	}
+	etag := w.Header().Get("ETag")
+	if w := get("/api/projects/demo/files/data.bin", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusNotModified {
+		t.Errorf("conditional GET = %d, want 304", w.Code)
+	}
+
+	w = doJSON(t, r, http.MethodPatch, "/api/projects/demo", gin.H{"ops": []PatchOp{{Op: "put", Path: "img/icon.png", Content: encoded, Encoding: "base64"}}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch = %d %s", w.Code, w.Body)
+	}
+	if files := treeToFiles(loadFatWithCache("demo", nil), ""); files["img/icon.png"] != pngBytes || files["logo.png"] != pngBytes {
+		t.Errorf("files after patch = %q", files)
+	}
+	if w := doJSON(t, r, http.MethodPatch, "/api/projects/demo", gin.H{"ops": []PatchOp{{Op: "put", Path: "x", Content: "x", Encoding: "hex"}}}); w.Code != http.StatusBadRequest {
+		t.Errorf("patch with unknown encoding = %d, want 400", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPatch, "/api/projects/demo", gin.H{"ops": []PatchOp{{Op: "put", Path: "x", Content: "x", MimeType: "text/html; charset"}}}); w.Code != http.StatusBadRequest {
+		t.Errorf("patch with invalid mimeType = %d, want 400", w.Code)
+	}
+}
+
+func TestFilesCannotRunScripts(t *testing.T) {
+	r := newTestRouter(t)
+	doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": filesToTree(map[string]string{
+		"page.html": "<script>alert(1)</script>",
+		"icon.svg":  "<svg onload='alert(1)'/>",
+		"notes.txt": "hello",
+	})})
+	req := httptest.NewRequest(http.MethodPut, "/api/projects/demo/files/fake.png?mimeType=text/html", strings.NewReader("<script>alert(1)</script>"))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	for path, inline := range map[string]bool{"page.html": false, "icon.svg": false, "fake.png": false, "notes.txt": true} {
+		w := doJSON(t, r, http.MethodGet, "/api/projects/demo/files/"+path, nil)
+		h := w.Header()
+		if w.Code != http.StatusOK || h.Get("X-Content-Type-Options") != "nosniff" || h.Get("Content-Security-Policy") != "sandbox" {
+			t.Errorf("GET %s = %d %v", path, w.Code, h)
+		}
+		if attached := strings.HasPrefix(h.Get("Content-Disposition"), "attachment"); attached == inline {
+			t.Errorf("GET %s: Content-Type %q, Content-Disposition %q", path, h.Get("Content-Type"), h.Get("Content-Disposition"))
+		}
+	}
+	if w := doJSON(t, r, http.MethodPut, "/api/projects/demo/files/x.txt?mimeType=not-a-type", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("PUT with invalid mimeType = %d, want 400", w.Code)
+	}
+}
+
+func TestPlaygroundBinaryUpload(t *testing.T) {
+	r := newTestRouter(t)
+	var session struct {
+		SessionID string `json:"session_id"`
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodPost, "/api/session/new", nil), &session)
+	url := "/api/session/" + session.SessionID + "/files"
+	if w := doJSON(t, r, http.MethodPost, url, gin.H{"path": "logo.png", "content": base64.StdEncoding.EncodeToString([]byte(pngBytes)), "encoding": "base64"}); w.Code != http.StatusCreated {
+		t.Fatalf("upload = %d %s", w.Code, w.Body)
+	}
+	if w := doJSON(t, r, http.MethodPost, url, gin.H{"path": "x.png", "content": "%%%", "encoding": "base64"}); w.Code != http.StatusBadRequest {
+		t.Errorf("upload of invalid base64 = %d, want 400", w.Code)
+	}
+	ps, _ := playgroundSessions.Load(session.SessionID)
+	if files := snapshotSessionFiles(ps.(*PlaygroundSession)); files["logo.png"] != pngBytes {
+		t.Errorf("session file = %q", files["logo.png"])
+	}
+
+	var share struct {
+		Slug string `json:"slug"`
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodPost, "/api/session/"+session.SessionID+"/share", nil), &share)
+	w := doJSON(t, r, http.MethodGet, "/api/share/"+share.Slug, nil)
+	var shared struct {
+		Files     map[string]string `json:"files"`
+		Encodings map[string]string `json:"encodings"`
+	}
+	decodeJSON(t, w, &shared)
+	if shared.Encodings["logo.png"] != "base64" || !strings.HasPrefix(shared.Files["logo.png"], "iVBORw0KGgo") {
+		t.Errorf("share = %s", w.Body)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"swalang-api-dualmode/internal/diff"
+)
+
+/* ============ VERSION DIFFS ============ */
+
+// Files larger than this are reported as modified without hunks.
+const maxDiffFileBytes = 1 << 20
+
+type FileDiff struct {
+	Path     string      `json:"path"`
+	OldPath  string      `json:"oldPath,omitempty"`
+	Status   string      `json:"status"` // added, removed, modified, renamed
+	Binary   bool        `json:"binary,omitempty"`
+	TooLarge bool        `json:"tooLarge,omitempty"`
+	Hunks    []diff.Hunk `json:"hunks,omitempty"`
+}
+
+type DiffSummary struct {
+	Added    int `json:"added"`
+	Removed  int `json:"removed"`
+	Modified int `json:"modified"`
+	Renamed  int `json:"renamed"`
+}
+
+type TreeDiff struct {
+	Summary DiffSummary `json:"summary"`
+	Files   []FileDiff  `json:"files"`
+}
+
+type diffOptions struct {
+	SummaryOnly bool   // statuses only, no hunks
+	Path        string // restrict to one file (matches the old or new path)
+	Context     int    // unchanged lines around each change
+}
+
+// diffTrees compares the files of two snapshots. A removed and an added file
+// with identical, non-empty content are reported as a rename.
+func diffTrees(from, to []FileSystemNode, opts diffOptions) TreeDiff {
+	oldFiles := treeToFiles(from, "")
+	newFiles := treeToFiles(to, "")
+
+	var added, removed []string
+	for p := range newFiles {
+		if _, ok := oldFiles[p]; !ok {
+			added = append(added, p)
+		}
+	}
+	for p := range oldFiles {
+		if _, ok := newFiles[p]; !ok {
+			removed = append(removed, p)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	removedBySum := make(map[string][]string)
+	for _, p := range removed {
+		if oldFiles[p] != "" {
+			sum := checksum(oldFiles[p])
+			removedBySum[sum] = append(removedBySum[sum], p)
+		}
+	}
+
+	var files []FileDiff
+	renamedFrom := make(map[string]bool)
+	for _, p := range added {
+		sum := checksum(newFiles[p])
+		if candidates := removedBySum[sum]; newFiles[p] != "" && len(candidates) > 0 {
+			removedBySum[sum] = candidates[1:]
+			renamedFrom[candidates[0]] = true
+			files = append(files, FileDiff{Path: p, OldPath: candidates[0], Status: "renamed"})
+			continue
+		}
+		files = append(files, fileDiff(p, "", newFiles[p], "added", opts))
+	}
+	for _, p := range removed {
+		if !renamedFrom[p] {
+			files = append(files, fileDiff(p, oldFiles[p], "", "removed", opts))
+		}
+	}
+	for p, content := range newFiles {
+		if old, ok := oldFiles[p]; ok && old != content {
+			files = append(files, fileDiff(p, old, content, "modified", opts))
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	result := TreeDiff{Files: []FileDiff{}}
+	for _, f := range files {
+		if opts.Path != "" && f.Path != opts.Path && f.OldPath != opts.Path {
+			continue
+		}
+		switch f.Status {
+		case "added":
+			result.Summary.Added++
+		case "removed":
+			result.Summary.Removed++
+		case "modified":
+			result.Summary.Modified++
+		case "renamed":
+			result.Summary.Renamed++
+		}
+		result.Files = append(result.Files, f)
+	}
+	return result
+}
+
+func fileDiff(p, oldContent, newContent, status string, opts diffOptions) FileDiff {
+	f := FileDiff{Path: p, Status: status}
+	if diff.IsBinary(oldContent) || diff.IsBinary(newContent) {
+		f.Binary = true
+		return f
+	}
+	if opts.SummaryOnly || (opts.Path != "" && p != opts.Path) {
+		return f
+	}
+	if len(oldContent) > maxDiffFileBytes || len(newContent) > maxDiffFileBytes {
+		f.TooLarge = true
+		return f
+	}
+	f.Hunks = diff.Hunks(diff.Lines(diff.SplitLines(oldContent), diff.SplitLines(newContent)), opts.Context)
+	return f
+}
+
+// getDiff serves GET /api/projects/:id/diff?from=&to=&summary=&path=&context=.
+// Both accept version UUIDs or ref names; "to" defaults to the latest version.
+func getDiff(c *gin.Context) {
+	projID := c.Param("id")
+	if c.Query("from") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query parameter 'from' must be a version UUID or ref"})
+		return
+	}
+	fromUUID, err := versionOrRef(projID, c.Query("from"))
+	if err != nil {
+		c.JSON(refErrorStatus(err), gin.H{"error": "from: " + err.Error()})
+		return
+	}
+	toStr := c.Query("to")
+	if toStr == "" {
+		toStr = defaultBranch
+	}
+	toUUID, err := versionOrRef(projID, toStr)
+	if err != nil {
+		c.JSON(refErrorStatus(err), gin.H{"error": "to: " + err.Error()})
+		return
+	}
+	opts := diffOptions{Path: c.Query("path"), Context: 3}
+	opts.SummaryOnly, _ = strconv.ParseBool(c.Query("summary"))
+	if ctx, ok := queryInt(c, "context", 3); ok {
+		opts.Context = ctx
+	}
+
+	fromTree := loadFatWithCache(projID, &fromUUID)
+	toTree := loadFatWithCache(projID, &toUUID)
+	if fromTree == nil || toTree == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project or version not found"})
+		return
+	}
+	result := diffTrees(fromTree, toTree, opts)
+	c.JSON(http.StatusOK, gin.H{"projectId": projID, "from": fromUUID.String(), "to": toUUID.String(), "summary": result.Summary, "files": result.Files})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDiffTrees(t *testing.T) {
+	from := filesToTree(map[string]string{
+		"main.sw":       "line 1\nline 2\nline 3\n",
+		"old/name.sw":   "same content\n",
+		"gone.sw":       "bye\n",
+		"img/logo.png":  "PNG\x00old",
+		"unchanged.txt": "x\n",
+	})
+	to := filesToTree(map[string]string{
+		"main.sw":       "line 1\nline two\nline 3\n",
+		"new/name.sw":   "same content\n",
+		"added.sw":      "hello\n",
+		"img/logo.png":  "PNG\x00new",
+		"unchanged.txt": "x\n",
+	})
+
+	got := diffTrees(from, to, diffOptions{Context: 3})
+	want := DiffSummary{Added: 1, Removed: 1, Modified: 2, Renamed: 1}
+	if got.Summary != want {
+		t.Fatalf("summary = %+v, want %+v", got.Summary, want)
+	}
+	byPath := make(map[string]FileDiff)
+	for _, f := range got.Files {
+		byPath[f.Path] = f
+	}
+	if f := byPath["new/name.sw"]; f.Status != "renamed" || f.OldPath != "old/name.sw" {
+		t.Errorf("rename = %+v", f)
+	}
+	if f := byPath["img/logo.png"]; !f.Binary || f.Hunks != nil {
+		t.Errorf("binary file = %+v", f)
+	}
+	main := byPath["main.sw"]
+	if len(main.Hunks) != 1 || main.Hunks[0].Header != "@@ -1,3 +1,3 @@" {
+		t.Errorf("main.sw hunks = %+v", main.Hunks)
+	}
+
+	summary := diffTrees(from, to, diffOptions{SummaryOnly: true})
+	for _, f := range summary.Files {
+		if f.Hunks != nil {
+			t.Errorf("summary mode returned hunks for %s", f.Path)
+		}
+	}
+
+	single := diffTrees(from, to, diffOptions{Path: "old/name.sw"})
+	if len(single.Files) != 1 || single.Files[0].Path != "new/name.sw" {
+		t.Errorf("path filter = %+v", single.Files)
+	}
+}
+
+func TestDiffEndpoint(t *testing.T) {
+	r := newTestRouter(t)
+	var v1, v2 struct {
+		Version string `json:"version"`
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": filesToTree(map[string]string{"main.sw": "a\n"})}), &v1)
+	decodeJSON(t, doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": filesToTree(map[string]string{"main.sw": "b\n"})}), &v2)
+
+	w := doJSON(t, r, http.MethodGet, "/api/projects/demo/diff?from="+v1.Version, nil)
+	var res struct {
+		To      string      `json:"to"`
+		Summary DiffSummary `json:"summary"`
+		Files   []FileDiff  `json:"files"`
+	}
+	decodeJSON(t, w, &res)
+	if w.Code != http.StatusOK || res.To != v2.Version || res.Summary.Modified != 1 || len(res.Files[0].Hunks) != 1 {
+		t.Errorf("GET diff = %d %s", w.Code, w.Body)
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/projects/demo/diff", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("diff without from = %d, want 400", w.Code)
+	}
+}
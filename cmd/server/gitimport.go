@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"swalang-api-dualmode/internal/gitrepo"
+	"swalang-api-dualmode/internal/runner"
+)
+
+/* ============ GIT IMPORT ============ */
+
+// maxGitImportCommits bounds the commits one import may turn into versions.
+var maxGitImportCommits = envInt("IMPORT_GIT_MAX_COMMITS", 500)
+
+// GitImportRequest selects what to import. Path is only accepted on the
+// admin route.
+type GitImportRequest struct {
+	Path   string `json:"path,omitempty"`
+	Rev    string `json:"rev,omitempty"`    // branch, tag or commit; HEAD by default
+	Since  string `json:"since,omitempty"`  // only import commits after this one
+	Branch string `json:"branch,omitempty"` // project branch to save to
+	Owner  string `json:"owner,omitempty"`
+}
+
+// GitImportedCommit maps a commit to the version it became.
+type GitImportedCommit struct {
+	Commit  string       `json:"commit"`
+	Version string       `json:"version"`
+	Skipped []ImportSkip `json:"skipped,omitempty"`
+	size    int
+}
+
+// checkGitTree applies the import limits to a commit before any blob is
+// read, so an oversized commit late in the history fails the import up front.
+func checkGitTree(commit string, entries []gitrepo.Entry, limits ImportLimits) error {
+	files, total := 0, int64(0)
+	for _, e := range entries {
+		if _, err := runner.ValidatePath(e.Path, 0); err != nil {
+			return fmt.Errorf("commit %.12s: %s: %w", commit, e.Path, err)
+		}
+		if !e.IsRegular() {
+			continue
+		}
+		files++
+		total += e.Size
+		switch {
+		case files > limits.MaxFiles:
+			return &QuotaError{Code: "too_many_files", Limit: int64(limits.MaxFiles),
+				Msg: fmt.Sprintf("commit %.12s holds more than %d files", commit, limits.MaxFiles)}
+		case e.Size > limits.MaxFileBytes:
+			return &QuotaError{Code: "file_too_large", Limit: limits.MaxFileBytes,
+				Msg: fmt.Sprintf("%s in commit %.12s exceeds the %d byte limit", e.Path, commit, limits.MaxFileBytes)}
+		case total > limits.MaxTotalBytes:
+			return &QuotaError{Code: "import_too_large", Limit: limits.MaxTotalBytes,
+				Msg: fmt.Sprintf("commit %.12s holds more than %d bytes", commit, limits.MaxTotalBytes)}
+		}
+	}
+	return nil
+}
+
+// gitCommitTree builds the project tree of a commit from its entries and
+// their blobs. Symlinks and submodules are skipped.
+func gitCommitTree(entries []gitrepo.Entry, blobs map[string][]byte) ([]FileSystemNode, []ImportSkip, error) {
+	imp := newArchiveImport(importLimits, 0)
+	for _, e := range entries {
+		var err error
+		switch {
+		case e.IsRegular():
+			err = imp.addFile(e.Path, bytes.NewReader(blobs[e.Hash]))
+		case e.IsSymlink():
+			err = imp.skipEntry(e.Path, "link")
+		default:
+			err = imp.skipEntry(e.Path, "unsupported")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	tree, err := imp.tree()
+	return tree, imp.skipped, err
+}
+
+// importGitHistory saves each commit on the first-parent line of req.Rev as
+// a version, oldest first, keeping the commit's author, time and message.
+// Every save is based on the previous one, so a concurrent save stops the
+// import; the commits imported until then are returned with the error.
+func importGitHistory(ctx context.Context, projectID string, repo gitrepo.Repo, req GitImportRequest, base string) ([]GitImportedCommit, error) {
+	rev := req.Rev
+	if rev == "" {
+		rev = "HEAD"
+	}
+	head, err := repo.Resolve(ctx, rev)
+	if err != nil {
+		return nil, err
+	}
+	since := ""
+	if req.Since != "" {
+		if since, err = repo.Resolve(ctx, req.Since); err != nil {
+			return nil, err
+		}
+	}
+	n, err := repo.CountCommits(ctx, head, since)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxGitImportCommits {
+		return nil, &QuotaError{Code: "too_many_commits", Limit: int64(maxGitImportCommits),
+			Msg: fmt.Sprintf("%d commits exceed the limit of %d per import; use since to import in steps", n, maxGitImportCommits)}
+	}
+	commits, err := repo.FirstParentLog(ctx, head, since)
+	if err != nil {
+		return nil, err
+	}
+	trees := make([][]gitrepo.Entry, len(commits))
+	for i, commit := range commits {
+		if trees[i], err = repo.Tree(ctx, commit.Hash); err != nil {
+			return nil, err
+		}
+		if err := checkGitTree(commit.Hash, trees[i], importLimits); err != nil {
+			return nil, err
+		}
+	}
+
+	imported := []GitImportedCommit{}
+	cache := make(map[string][]byte)
+	for i, commit := range commits {
+		// Blobs of the previous commit are reused; only changed files are read.
+		var missing []string
+		seen := make(map[string]bool)
+		for _, e := range trees[i] {
+			if _, ok := cache[e.Hash]; e.IsRegular() && !ok && !seen[e.Hash] {
+				seen[e.Hash] = true
+				missing = append(missing, e.Hash)
+			}
+		}
+		fetched, err := repo.Blobs(ctx, missing)
+		if err != nil {
+			return imported, err
+		}
+		blobs := make(map[string][]byte, len(trees[i]))
+		for _, e := range trees[i] {
+			if data, ok := cache[e.Hash]; ok {
+				blobs[e.Hash] = data
+			} else if data, ok := fetched[e.Hash]; ok {
+				blobs[e.Hash] = data
+			}
+		}
+		cache = blobs
+
+		tree, skipped, err := gitCommitTree(trees[i], blobs)
+		if err != nil {
+			return imported, err
+		}
+		opts := SaveOptions{
+			Owner:       req.Owner,
+			Author:      fmt.Sprintf("%s <%s>", commit.AuthorName, commit.AuthorEmail),
+			Message:     commit.Message,
+			BaseVersion: base,
+			Branch:      req.Branch,
+			Timestamp:   commit.Time,
+		}
+		version, size, err := saveHybrid(projectID, tree, opts)
+		if err != nil {
+			return imported, err
+		}
+		base = version
+		imported = append(imported, GitImportedCommit{Commit: commit.Hash, Version: version, Skipped: skipped, size: size})
+	}
+	return imported, nil
+}
+
+// respondGitImport writes the result of importGitHistory.
+func respondGitImport(c *gin.Context, projectID string, req GitImportRequest, base string, imported []GitImportedCommit, err error) {
+	if len(imported) > 0 {
+		last := imported[len(imported)-1]
+		broadcast(projectID, updateMessage(last.Version, last.size, req.Branch))
+		c.Header("ETag", projectETag(last.Version))
+	}
+	if err == nil {
+		status := http.StatusCreated
+		if len(imported) == 0 {
+			status = http.StatusOK
+		}
+		c.JSON(status, gin.H{"projectId": projectID, "branch": branchName(req.Branch), "commits": imported})
+		return
+	}
+
+	resp := gin.H{"error": err.Error(), "commits": imported}
+	var qe *QuotaError
+	var conflict *ConflictError
+	status := refErrorStatus(err)
+	switch {
+	case errors.As(err, &qe):
+		status = http.StatusRequestEntityTooLarge
+		resp["error"], resp["code"], resp["limit"] = qe.Msg, qe.Code, qe.Limit
+	case errors.As(err, &conflict):
+		status = http.StatusConflict
+		resp["error"], resp["baseVersion"], resp["currentVersion"] = "version conflict", base, conflict.CurrentVersion
+		if len(imported) > 0 {
+			resp["baseVersion"] = imported[len(imported)-1].Version
+		}
+	case errors.Is(err, gitrepo.ErrInvalidRev), errors.Is(err, runner.ErrInvalidPath):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, resp)
+}
+
+/* ---------- Git Import Handlers ---------- */
+
+// importGitBundle serves POST /api/projects/:id/import/git. The body is a
+// git bundle (raw or as the "file" field of a multipart form); rev, since,
+// branch and owner are query parameters.
+func importGitBundle(c *gin.Context) {
+	projID := c.Param("id")
+	req := GitImportRequest{Rev: c.Query("rev"), Since: c.Query("since"), Branch: c.Query("branch"), Owner: saveOwner(c, c.Query("owner"))}
+	data, ok := readUpload(c)
+	if !ok {
+		return
+	}
+	if !bytes.HasPrefix(data, []byte("# v2 git bundle\n")) && !bytes.HasPrefix(data, []byte("# v3 git bundle\n")) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "body must be a git bundle (git bundle create)"})
+		return
+	}
+
+	tmp, err := os.MkdirTemp("", "git-import-*")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.RemoveAll(tmp)
+	bundle := filepath.Join(tmp, "import.bundle")
+	if err := os.WriteFile(bundle, data, 0600); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	repo, err := gitrepo.OpenBundle(c.Request.Context(), bundle, filepath.Join(tmp, "repo.git"))
+	if err != nil {
+		// Incomplete bundles (with prerequisites) fail here too.
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	base := baseVersionOf(c, "")
+	imported, err := importGitHistory(c.Request.Context(), projID, repo, req, base)
+	respondGitImport(c, projID, req, base, imported, err)
+}
+
+// adminImportGit serves POST /api/admin/projects/:id/import/git, which
+// imports from a repository on the server's disk. With GIT_IMPORT_ROOT set,
+// only repositories below that directory are accepted.
+func adminImportGit(c *gin.Context) {
+	projID := c.Param("id")
+	var req GitImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !filepath.IsAbs(req.Path) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path must be an absolute path to a local repository"})
+		return
+	}
+	dir := filepath.Clean(req.Path)
+	if root := os.Getenv("GIT_IMPORT_ROOT"); root != "" {
+		if rel, err := filepath.Rel(filepath.Clean(root), dir); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "path is outside GIT_IMPORT_ROOT"})
+			return
+		}
+	}
+	repo, err := gitrepo.Open(c.Request.Context(), dir)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	base := baseVersionOf(c, "")
+	imported, err := importGitHistory(c.Request.Context(), projID, repo, req, base)
+	respondGitImport(c, projID, req, base, imported, err)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gitCommitFiles writes files into the work tree at dir and commits them at
+// the given date.
+func gitCommitFiles(t *testing.T, dir, date, message string, files map[string]string) {
+	t.Helper()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Amina", "-c", "user.email=amina@example.com", "-c", "init.defaultBranch=main"}, args...)...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date, "GIT_CONFIG_GLOBAL="+os.DevNull)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		git("init", "-q")
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	git("add", "-A")
+	git("commit", "-q", "-m", message)
+}
+
+type gitImportResult struct {
+	Commits []GitImportedCommit `json:"commits"`
+	Code    string              `json:"code"`
+}
+
+func TestImportGitBundle(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	r := newTestRouter(t)
+	dir := t.TempDir()
+	gitCommitFiles(t, dir, "2024-01-02T03:04:05Z", "First lesson", map[string]string{"main.sw": "andika(1)"})
+	gitCommitFiles(t, dir, "2024-01-03T00:00:00Z", "Add util", map[string]string{"lib/util.sw": "kazi util() {}", "logo.png": "\x89PNG\x00"})
+	bundle := func() []byte {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "repo.bundle")
+		if out, err := exec.Command("git", "-C", dir, "bundle", "create", "-q", path, "--all").CombinedOutput(); err != nil {
+			t.Fatalf("git bundle: %v\n%s", err, out)
+		}
+		data, _ := os.ReadFile(path)
+		return data
+	}
+
+	w := postArchive(t, r, "/api/projects/demo/import/git", "application/octet-stream", bundle())
+	var res gitImportResult
+	decodeJSON(t, w, &res)
+	if w.Code != http.StatusCreated || len(res.Commits) != 2 {
+		t.Fatalf("import bundle = %d %s", w.Code, w.Body)
+	}
+	if len(res.Commits[1].Skipped) != 0 {
+		t.Errorf("skipped = %+v", res.Commits[1].Skipped)
+	}
+	versions, _, _ := store.ListVersions("demo", 10, "")
+	if len(versions) != 2 {
+		t.Fatalf("versions = %+v", versions)
+	}
+	first := versions[1]
+	if first.Version != res.Commits[0].Version || first.Author != "Amina <amina@example.com>" || first.Message != "First lesson" ||
+		!first.Timestamp.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("first version = %+v", first)
+	}
+	// Commit times date the versions, not the project's last update.
+	if meta, _ := store.GetMeta("demo"); time.Since(meta.LastUpdated) > time.Minute {
+		t.Errorf("lastUpdated = %v, want the import time", meta.LastUpdated)
+	}
+	if want := map[string]string{"main.sw": "andika(1)", "lib/util.sw": "kazi util() {}", "logo.png": "\x89PNG\x00"}; !reflect.DeepEqual(treeToFiles(loadFatWithCache("demo", nil), ""), want) {
+		t.Errorf("imported files = %v, want %v", treeToFiles(loadFatWithCache("demo", nil), ""), want)
+	}
+
+	// An interrupted or repeated import continues after the last imported commit.
+	gitCommitFiles(t, dir, "2024-01-04T00:00:00Z", "Third", map[string]string{"main.sw": "andika(3)"})
+	w = postArchive(t, r, "/api/projects/demo/import/git?since="+res.Commits[1].Commit, "application/octet-stream", bundle())
+	decodeJSON(t, w, &res)
+	if w.Code != http.StatusCreated || len(res.Commits) != 1 {
+		t.Fatalf("import since = %d %s", w.Code, w.Body)
+	}
+	if meta, _ := store.GetMeta("demo"); meta.LastVersion != res.Commits[0].Version {
+		t.Errorf("latest = %s, want %s", meta.LastVersion, res.Commits[0].Version)
+	}
+
+	defer func(n int) { maxGitImportCommits = n }(maxGitImportCommits)
+	maxGitImportCommits = 2
+	w = postArchive(t, r, "/api/projects/other/import/git", "application/octet-stream", bundle())
+	decodeJSON(t, w, &res)
+	if w.Code != http.StatusRequestEntityTooLarge || res.Code != "too_many_commits" {
+		t.Errorf("import over commit limit = %d %s", w.Code, w.Body)
+	}
+	if w := postArchive(t, r, "/api/projects/other/import/git?rev=nope", "application/octet-stream", bundle()); w.Code != http.StatusBadRequest {
+		t.Errorf("import unknown rev = %d, want 400", w.Code)
+	}
+	if w := postArchive(t, r, "/api/projects/other/import/git", "application/zip", zipOf(t, map[string]string{"a": "b"})); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("import zip as bundle = %d, want 415", w.Code)
+	}
+}
+
+func TestAdminImportGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	r := newTestRouter(t)
+	t.Setenv("ADMIN_TOKEN", "secret")
+	admin := http.Header{"Authorization": {"Bearer secret"}}
+	root := t.TempDir()
+	dir := filepath.Join(root, "repo")
+	os.Mkdir(dir, 0755)
+	gitCommitFiles(t, dir, "2024-01-02T03:04:05Z", "Initial", map[string]string{"main.sw": "andika(1)"})
+
+	if w := doJSON(t, r, http.MethodPost, "/api/admin/projects/demo/import/git", gin.H{"path": dir}); w.Code != http.StatusUnauthorized {
+		t.Errorf("import without token = %d, want 401", w.Code)
+	}
+	if w := doJSONWithHeader(t, r, http.MethodPost, "/api/admin/projects/demo/import/git", gin.H{"path": "repo"}, admin); w.Code != http.StatusBadRequest {
+		t.Errorf("import relative path = %d, want 400", w.Code)
+	}
+	t.Setenv("GIT_IMPORT_ROOT", filepath.Join(root, "allowed"))
+	if w := doJSONWithHeader(t, r, http.MethodPost, "/api/admin/projects/demo/import/git", gin.H{"path": dir}, admin); w.Code != http.StatusForbidden {
+		t.Errorf("import outside GIT_IMPORT_ROOT = %d, want 403", w.Code)
+	}
+	t.Setenv("GIT_IMPORT_ROOT", root)
+	w := doJSONWithHeader(t, r, http.MethodPost, "/api/admin/projects/demo/import/git", gin.H{"path": dir, "rev": "main"}, admin)
+	var res gitImportResult
+	decodeJSON(t, w, &res)
+	if w.Code != http.StatusCreated || len(res.Commits) != 1 {
+		t.Fatalf("admin import = %d %s", w.Code, w.Body)
+	}
+	if files, _ := splitFileContents("demo"); files["main.sw"] != "andika(1)" {
+		t.Errorf("split rows after import = %v", files)
+	}
+}
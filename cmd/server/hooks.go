@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"swalang-api-dualmode/internal/hooks"
+)
+
+/* ---------- Session Event Hooks ---------- */
+
+var sessionHooks = hooks.NewDispatcher()
+
+// configureHooks registers a webhook for every URL in WEBHOOK_URLS
+// (comma-separated). WEBHOOK_SECRET enables HMAC signing and WEBHOOK_EVENTS
+// optionally restricts which event types are sent. WEBHOOK_WORKERS and
+// WEBHOOK_QUEUE_SIZE bound the deliveries in flight per webhook.
+func configureHooks() {
+	urls := os.Getenv("WEBHOOK_URLS")
+	if urls == "" {
+		return
+	}
+	sessionHooks.Workers = envInt("WEBHOOK_WORKERS", sessionHooks.Workers)
+	sessionHooks.QueueSize = envInt("WEBHOOK_QUEUE_SIZE", sessionHooks.QueueSize)
+	secret := os.Getenv("WEBHOOK_SECRET")
+	var events []hooks.EventType
+	for _, e := range strings.Split(os.Getenv("WEBHOOK_EVENTS"), ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			events = append(events, hooks.EventType(e))
+		}
+	}
+	for _, u := range strings.Split(urls, ",") {
+		if u = strings.TrimSpace(u); u == "" {
+			continue
+		}
+		wh := hooks.NewWebhook(u, secret)
+		wh.Events = events
+		wh.MaxRetries = envIntMin("WEBHOOK_MAX_RETRIES", wh.MaxRetries, 0)
+		sessionHooks.Register(wh)
+	}
+	if secret == "" {
+		log.Println("⚠️  WEBHOOK_SECRET not set. Webhook payloads will be unsigned.")
+	}
+	log.Printf("🔔 %d webhook(s) configured", sessionHooks.Len())
+}
+
+func emitRunFinished(sessionID, projectID, entry string, outcome *RunOutcome) {
+	sessionHooks.Emit(hooks.Event{
+		Type:      hooks.RunFinished,
+		SessionID: sessionID,
+		ProjectID: projectID,
+		Data: map[string]interface{}{
+			"entry":      entry,
+			"exitCode":   outcome.ExitCode,
+			"durationMs": outcome.DurationMs,
+			"error":      outcome.Error,
+		},
+	})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+/* ---------- Playground Quotas ---------- */
+
+type SessionLimits struct {
+	MaxFiles        int   // files per session
+	MaxFileBytes    int64 // bytes per file
+	MaxSessionBytes int64 // bytes across all files of a session
+	MaxPathDepth    int   // path segments, e.g. src/lib/a.sw is 3
+}
+
+var playgroundLimits = loadSessionLimits()
+
+func loadSessionLimits() SessionLimits {
+	return SessionLimits{
+		MaxFiles:        envInt("PLAYGROUND_MAX_FILES", 200),
+		MaxFileBytes:    int64(envInt("PLAYGROUND_MAX_FILE_BYTES", 1<<20)),
+		MaxSessionBytes: int64(envInt("PLAYGROUND_MAX_SESSION_BYTES", 10<<20)),
+		MaxPathDepth:    envInt("PLAYGROUND_MAX_PATH_DEPTH", 16),
+	}
+}
+
+// envInt reads a positive integer setting.
+func envInt(name string, def int) int {
+	return envIntMin(name, def, 1)
+}
+
+// envIntMin reads an integer setting no smaller than least, e.g. 0 for a count
+// that can be switched off.
+func envIntMin(name string, def, least int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < least {
+		log.Printf("⚠️  Ignoring invalid %s=%q, using %d", name, v, def)
+		return def
+	}
+	return n
+}
+
+// QuotaError describes which session limit an upload would exceed.
+type QuotaError struct {
+	Code  string
+	Limit int64
+	Msg   string
+}
+
+func (e *QuotaError) Error() string { return e.Msg }
+
+// checkQuota reports whether storing size bytes at filePath keeps the session
+// within limits. The caller must hold s.mu.
+func (l SessionLimits) checkQuota(s *PlaygroundSession, filePath string, size int64) error {
+	if size > l.MaxFileBytes {
+		return &QuotaError{Code: "file_too_large", Limit: l.MaxFileBytes,
+			Msg: fmt.Sprintf("file exceeds the %d byte limit", l.MaxFileBytes)}
+	}
+	count, total := 0, int64(0)
+	replacing := false
+	s.Files.Range(func(key, value interface{}) bool {
+		if key.(string) == filePath {
+			replacing = true
+			return true
+		}
+		count++
+		total += int64(len(value.(string)))
+		return true
+	})
+	if !replacing && count+1 > l.MaxFiles {
+		return &QuotaError{Code: "too_many_files", Limit: int64(l.MaxFiles),
+			Msg: fmt.Sprintf("session already holds the maximum of %d files", l.MaxFiles)}
+	}
+	if total+size > l.MaxSessionBytes {
+		return &QuotaError{Code: "session_quota_exceeded", Limit: l.MaxSessionBytes,
+			Msg: fmt.Sprintf("session would exceed its %d byte quota", l.MaxSessionBytes)}
+	}
+	return nil
+}
+
+// checkFiles validates a whole path -> content map against the limits, e.g.
+// when a session is preloaded from a stored project.
+func (l SessionLimits) checkFiles(files map[string]string) error {
+	if len(files) > l.MaxFiles {
+		return &QuotaError{Code: "too_many_files", Limit: int64(l.MaxFiles),
+			Msg: fmt.Sprintf("%d files exceed the limit of %d per session", len(files), l.MaxFiles)}
+	}
+	total := int64(0)
+	for p, content := range files {
+		size := int64(len(content))
+		if size > l.MaxFileBytes {
+			return &QuotaError{Code: "file_too_large", Limit: l.MaxFileBytes,
+				Msg: fmt.Sprintf("%s exceeds the %d byte limit", p, l.MaxFileBytes)}
+		}
+		total += size
+	}
+	if total > l.MaxSessionBytes {
+		return &QuotaError{Code: "session_quota_exceeded", Limit: l.MaxSessionBytes,
+			Msg: fmt.Sprintf("files exceed the %d byte session quota", l.MaxSessionBytes)}
+	}
+	return nil
+}
+
+/* ---------- Share Limits ---------- */
+
+// ShareLimits bound the shares held in memory, which outlive sessions.
+type ShareLimits struct {
+	TTL           time.Duration // how long a share can be read and forked
+	MaxShares     int           // live shares across all sessions
+	MaxTotalBytes int64         // bytes across all live shares
+}
+
+var shareLimits = loadShareLimits()
+
+func loadShareLimits() ShareLimits {
+	return ShareLimits{
+		TTL:           time.Duration(envInt("SHARE_TTL_HOURS", 7*24)) * time.Hour,
+		MaxShares:     envInt("SHARE_MAX_COUNT", 10000),
+		MaxTotalBytes: int64(envInt("SHARE_MAX_TOTAL_BYTES", 256<<20)),
+	}
+}
+
+/* ---------- Project Import Limits ---------- */
+
+// ImportLimits bound archive imports. Sizes are checked while decompressing,
+// so an archive cannot expand past MaxTotalBytes whatever its headers claim.
+type ImportLimits struct {
+	MaxArchiveBytes int64 // size of the uploaded archive
+	MaxFiles        int   // files in the archive
+	MaxFileBytes    int64 // bytes per file after decompression
+	MaxTotalBytes   int64 // bytes across all files after decompression
+}
+
+var importLimits = loadImportLimits()
+
+func loadImportLimits() ImportLimits {
+	return ImportLimits{
+		MaxArchiveBytes: int64(envInt("IMPORT_MAX_ARCHIVE_BYTES", 50<<20)),
+		MaxFiles:        envInt("IMPORT_MAX_FILES", 5000),
+		MaxFileBytes:    int64(envInt("IMPORT_MAX_FILE_BYTES", 5<<20)),
+		MaxTotalBytes:   int64(envInt("IMPORT_MAX_TOTAL_BYTES", 100<<20)),
+	}
+}
@@ -2,38 +2,42 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
+	"mime"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path"
-	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
-	gocqlastra "github.com/datastax/gocql-astra"
 	"github.com/gin-gonic/gin"
 	"github.com/gocql/gocql"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+
+	"swalang-api-dualmode/internal/diff"
+	"swalang-api-dualmode/internal/hooks"
+	"swalang-api-dualmode/internal/runner"
 )
 
 /* ---------- Project domain types ---------- */
 
+// FileSystemNode is a file or folder of a project. Content holds the raw
+// bytes of a file; see content.go for how binary files are sent as JSON.
 type FileSystemNode struct {
 	ID       string           `json:"id"`
 	Name     string           `json:"name"`
 	Type     string           `json:"type"`
 	Content  string           `json:"content,omitempty"`
+	MimeType string           `json:"mimeType,omitempty"`
 	Children []FileSystemNode `json:"children,omitempty"`
 	IsFolder bool             `json:"isFolder,omitempty"`
 }
@@ -66,6 +70,8 @@ type PlaygroundSession struct {
 	Files     *sync.Map
 	Logs      string
 	CreatedAt time.Time
+
+	mu sync.Mutex // serialises quota checks with writes to Files
 }
 
 /* ---------- Snapshot Cache ---------- */
@@ -80,12 +86,12 @@ var (
 	// In-memory store for playground sessions
 	playgroundSessions = &sync.Map{}
 
-	// Astra DB for persistent projects
-	session *gocql.Session
+	// Persistent projects (Astra DB or local disk), nil when disabled
+	store ProjectStore
 
 	// WebSockets
-	upgrader     = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
-	projectConns = sync.Map{} // projectID -> map[connID]*websocket.Conn
+	upgrader     = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }, Subprotocols: []string{wsBearerProtocol}}
+	projectConns = sync.Map{} // projectID -> map[connID]*wsConn
 	indexJobs    = sync.Map{} // jobID -> *IndexJob
 
 	// Embedding
@@ -128,34 +134,10 @@ func corsMiddleware() gin.HandlerFunc {
 	}
 }
 
-/* ---------- Astra DB Connection ---------- */
-
-func connectAstra() {
-	bundle := os.Getenv("ASTRA_BUNDLE")
-	token := os.Getenv("ASTRA_TOKEN")
-
-	if token == "" || bundle == "" {
-		log.Println("⚠️  ASTRA_TOKEN or ASTRA_BUNDLE not set. Project features disabled.")
-		return
-	}
-
-	cluster, err := gocqlastra.NewClusterFromBundle(bundle, "token", token, 10*time.Second)
-	if err != nil {
-		log.Fatalf("Failed to create Astra cluster: %v", err)
-	}
-	cluster.Keyspace = "codeks"
-	cluster.NumConns = 4
-	cluster.ProtoVersion = 4
-
-	session, err = gocql.NewSession(*cluster)
-	if err != nil {
-		log.Fatalf("Failed to connect to Astra: %v", err)
-	}
-	log.Println("✅ Connected to Astra DB")
-}
-
 /* ---------- Playground Session Cleanup ---------- */
 
+// startSessionCleanup expires sessions older than maxAge and shares past
+// their TTL every interval.
 func startSessionCleanup(interval time.Duration, maxAge time.Duration) {
 	ticker := time.NewTicker(interval)
 	go func() {
@@ -169,6 +151,7 @@ func startSessionCleanup(interval time.Duration, maxAge time.Duration) {
 				}
 				return true
 			})
+			expireShares(time.Now())
 		}
 	}()
 }
@@ -177,110 +160,204 @@ func startSessionCleanup(interval time.Duration, maxAge time.Duration) {
 
 func main() {
 	startSessionCleanup(5*time.Minute, 15*time.Minute)
-	connectAstra()
+	var err error
+	store, err = openProjectStore()
+	if err != nil {
+		log.Fatalf("Failed to open project store: %v", err)
+	}
 	defer func() {
-		if session != nil {
-			session.Close()
+		if store != nil {
+			store.Close()
 		}
 	}()
 
+	if len(os.Args) > 1 && os.Args[1] == "repair-splits" {
+		if err := runRepairCommand(os.Args[2:]); err != nil {
+			log.Fatalf("repair-splits: %v", err)
+		}
+		return
+	}
+
+	if jwtVerifier, err = loadJWTVerifier(); err != nil {
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
+	warnIfUnauthenticated()
 	embedder = &MockEmbedder{}
+	configureHooks()
+	startRetentionGC()
 
 	gin.SetMode(gin.ReleaseMode)
+	r := newRouter()
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		log.Println("Shutting down server...")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	log.Printf("🚀 Server starting on port %s", port)
+	if store != nil {
+		log.Println("✨ Persistent Project features enabled")
+	}
+	log.Fatal(srv.ListenAndServe())
+}
+
+// newRouter wires all routes. Project routes are only registered when a
+// project store is configured.
+func newRouter() *gin.Engine {
 	r := gin.New()
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
 	r.Use(corsMiddleware())
+	r.Use(authenticate())
 
 	r.GET("/", func(c *gin.Context) { c.File("static/index.html") })
 
-	sessionAPI := r.Group("/api")
+	r.GET("/api/me", getMe)
+
+	sessionAPI := r.Group("/api", authRequired(authAnonymous))
 	{
 		sessionAPI.POST("/session/new", newPlaygroundSessionHandler)
 		sessionAPI.POST("/session/:id/files", uploadPlaygroundFileHandler)
 		sessionAPI.GET("/session/:id/ws", wsPlaygroundHandler)
 		sessionAPI.POST("/session/:id/run", runPlaygroundHandler)
 		sessionAPI.GET("/session/:id/logs", logsPlaygroundHandler)
+		sessionAPI.POST("/session/:id/share", shareSessionHandler)
+		sessionAPI.GET("/share/:slug", getShareHandler)
+		sessionAPI.POST("/share/:slug/fork", forkShareHandler)
 	}
 
-	if session != nil {
-		projectAPI := r.Group("/api")
+	if store != nil {
+		// Project routes name the role they need; see access.go.
+		viewer, editor, admin := requireRole(roleViewer), requireRole(roleEditor), requireRole(roleAdmin)
+		signedIn := authRequired(authAuthenticated)
+		projectAPI := r.Group("/api", authRequired(authAnonymous))
 		{
-			projectAPI.GET("/projects/:id", getProject)
-			projectAPI.GET("/projects/:id/size", getSize)
-			projectAPI.GET("/projects/:id/files/*path", getFile)
-			projectAPI.POST("/projects/:id", postProject)
-			projectAPI.POST("/projects/:id/index", postIndex)
+			projectAPI.GET("/projects", listProjects)
+			projectAPI.GET("/projects/:id", viewer, getProject)
+			projectAPI.GET("/projects/:id/size", viewer, getSize)
+			projectAPI.GET("/projects/:id/files", viewer, getFiles)
+			projectAPI.GET("/projects/:id/files/*path", viewer, getFile)
+			projectAPI.GET("/projects/:id/versions", viewer, getVersions)
+			projectAPI.GET("/projects/:id/snapshots/:version", viewer, getSnapshot)
+			projectAPI.GET("/projects/:id/diff", viewer, getDiff)
+			projectAPI.POST("/projects/:id/restore", editor, postRestore)
+			projectAPI.POST("/projects/:id", editor, postProject)
+			projectAPI.PATCH("/projects/:id", editor, patchProject)
+			projectAPI.DELETE("/projects/:id", admin, deleteProject)
+			// Restoring is the one thing a project in the trash allows.
+			projectAPI.POST("/projects/:id/undelete", undeleteProject)
+			projectAPI.PUT("/projects/:id/files/*path", editor, putProjectFile)
+			projectAPI.PATCH("/projects/:id/files/*path", editor, moveProjectFile)
+			projectAPI.DELETE("/projects/:id/files/*path", editor, deleteProjectFile)
+			projectAPI.POST("/projects/:id/index", editor, postIndex)
 			projectAPI.GET("/index/:jobId", getIndexStatus)
 			projectAPI.POST("/search/similar", postSearchSimilar)
+			projectAPI.POST("/session/:id/save", editor, saveSessionAsProject)
+			projectAPI.POST("/projects/:id/session", viewer, openProjectSession)
+			projectAPI.POST("/projects/:id/run", viewer, postProjectRun)
+			projectAPI.GET("/projects/:id/retention", viewer, getRetention)
+			projectAPI.PUT("/projects/:id/retention", admin, putRetention)
+			projectAPI.DELETE("/projects/:id/retention", admin, putRetention)
+			projectAPI.GET("/projects/:id/export", viewer, exportProject)
+			projectAPI.POST("/projects/:id/import", editor, importProject)
+			projectAPI.POST("/projects/:id/import/git", editor, importGitBundle)
+			projectAPI.GET("/projects/:id/refs", viewer, getRefs)
+			projectAPI.POST("/projects/:id/refs", editor, postRef)
+			projectAPI.DELETE("/projects/:id/refs/*name", admin, deleteRef)
+			projectAPI.GET("/projects/:id/collaborators", viewer, getCollaborators)
+			projectAPI.PUT("/projects/:id/collaborators/:userId", signedIn, admin, putCollaborator)
+			projectAPI.DELETE("/projects/:id/collaborators/:userId", signedIn, viewer, deleteCollaborator)
+			projectAPI.PUT("/projects/:id/visibility", signedIn, admin, putVisibility)
+		}
+		adminAPI := r.Group("/api/admin", adminAuth())
+		{
+			adminAPI.GET("/gc", adminGC)
+			adminAPI.POST("/gc", adminGC)
+			adminAPI.POST("/projects/:id/import/git", adminImportGit)
 		}
-		r.GET("/ws/:projectId", handleWS)
+		r.GET("/ws/:projectId", viewer, handleWS)
 	}
 
 	r.GET("/healthz", func(c *gin.Context) { c.JSON(200, gin.H{"status": "ok"}) })
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	srv := &http.Server{Addr: ":" + port, Handler: r}
-	go func() {
-		sig := make(chan os.Signal, 1)
-		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-		<-sig
-		log.Println("Shutting down server...")
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		srv.Shutdown(ctx)
-	}()
-
-	log.Printf("🚀 Server starting on port %s", port)
-	if session != nil {
-		log.Println("✨ Persistent Project features (Astra DB) enabled")
-	}
-	log.Fatal(srv.ListenAndServe())
+	return r
 }
 
 /* ============ PLAYGROUND API HANDLERS (In-Memory) ============ */
 
 func newPlaygroundSessionHandler(c *gin.Context) {
-	sessionID := uuid.New().String()
-	playgroundSessions.Store(sessionID, &PlaygroundSession{Files: &sync.Map{}, CreatedAt: time.Now()})
-	wsScheme := "ws"
-	if c.Request.TLS != nil {
-		wsScheme = "wss"
-	}
-	wsURL := fmt.Sprintf("%s://%s/api/session/%s/ws", wsScheme, c.Request.Host, sessionID)
-	c.JSON(http.StatusOK, gin.H{"session_id": sessionID, "ws_url": wsURL})
+	sessionID, _ := createPlaygroundSession(nil, "new")
+	c.JSON(http.StatusOK, gin.H{"session_id": sessionID, "ws_url": sessionWSURL(c, sessionID)})
 }
 
 func uploadPlaygroundFileHandler(c *gin.Context) {
 	sessionID := c.Param("id")
+	session, ok := playgroundSessions.Load(sessionID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	// Leave headroom for the JSON envelope and escaping around the content.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 2*playgroundLimits.MaxFileBytes+4096)
 	var req struct {
-		Path    string `json:"path"`
-		Content string `json:"content"`
+		Path     string `json:"path"`
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"` // "utf8" (default) or "base64"
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large", "code": "file_too_large", "limit": playgroundLimits.MaxFileBytes})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
-	session, ok := playgroundSessions.Load(sessionID)
-	if !ok {
-		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+	content, err := decodeContent(req.Content, req.Encoding)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cleanPath, err := runner.ValidatePath(req.Path, playgroundLimits.MaxPathDepth)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_path"})
+		return
+	}
+	ps := session.(*PlaygroundSession)
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if err := playgroundLimits.checkQuota(ps, cleanPath, int64(len(content))); err != nil {
+		qe := err.(*QuotaError)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": qe.Msg, "code": qe.Code, "limit": qe.Limit})
 		return
 	}
-	session.(*PlaygroundSession).Files.Store(filepath.Clean(req.Path), req.Content)
+	ps.Files.Store(cleanPath, content)
+	sessionHooks.Emit(hooks.Event{
+		Type:      hooks.FilesChanged,
+		SessionID: sessionID,
+		Data:      map[string]interface{}{"path": cleanPath, "size": len(content)},
+	})
 	c.Status(http.StatusCreated)
 }
 
 func wsPlaygroundHandler(c *gin.Context) {
 	sessionID := c.Param("id")
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		return
 	}
-	defer conn.Close()
+	defer ws.Close()
+	conn := &wsConn{Conn: ws}
 	for {
 		var msg map[string]string
 		if err := conn.ReadJSON(&msg); err != nil {
@@ -292,110 +369,33 @@ func wsPlaygroundHandler(c *gin.Context) {
 	}
 }
 
-func executeAndStream(conn *websocket.Conn, sessionID string) {
+func executeAndStream(conn *wsConn, sessionID string) {
 	sessionVal, ok := playgroundSessions.Load(sessionID)
 	if !ok {
 		sendJSONError(conn, "session not found", nil)
 		return
 	}
 
-	// Access the session data
-	sessionData := sessionVal.(*PlaygroundSession)
-
-	// Create a temporary directory for execution
-	tempDir, err := os.MkdirTemp("", "swalang-exec-*")
-	if err != nil {
-		sendJSONError(conn, "failed to create execution directory", err)
-		return
-	}
-	defer os.RemoveAll(tempDir)
-
-	var hasEntry bool = false
-	var writeErr error
-
-	// Iterate over all files in the session and write them to disk
-	sessionData.Files.Range(func(key, value interface{}) bool {
-		relPath, ok := key.(string)
-		if !ok {
-			return true
-		}
-		content, ok := value.(string)
-		if !ok {
-			return true
-		}
-
-		// Clean the path and ensure it doesn't traverse directories dangerously
-		cleanPath := filepath.Clean(relPath)
-		if strings.Contains(cleanPath, "..") || strings.HasPrefix(cleanPath, "/") || strings.HasPrefix(cleanPath, "\\") {
-			log.Printf("Skipping potentially unsafe file path: %s", relPath)
-			return true
-		}
-
-		fullPath := filepath.Join(tempDir, cleanPath)
-		dir := filepath.Dir(fullPath)
-
-		// Create subdirectories if needed
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			writeErr = fmt.Errorf("failed to create directory %s: %w", dir, err)
-			return false // Stop iteration on error
-		}
-
-		// Write the file content
-		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
-			writeErr = fmt.Errorf("failed to write file %s: %w", fullPath, err)
-			return false // Stop iteration on error
-		}
-
-		// Check if this is the entry point
-		if cleanPath == "main.sw" {
-			hasEntry = true
-		}
-
-		return true
-	})
-
-	if writeErr != nil {
-		sendJSONError(conn, "failed to prepare project files", writeErr)
-		return
-	}
-
-	if !hasEntry {
+	files := snapshotSessionFiles(sessionVal.(*PlaygroundSession))
+	if _, ok := files["main.sw"]; !ok {
 		sendJSONError(conn, "file 'main.sw' not found in uploaded files", nil)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	var swalang_binary = "/usr/local/bin/swalang"
-	if os.Getenv("SWALANG_PATH") != "" {
-		swalang_binary = os.Getenv("SWALANG_PATH")
-	}
-
-	// Run swalang with main.sw as the entry point, inside the tempDir
-	cmd := exec.CommandContext(ctx, swalang_binary, "main.sw")
-	cmd.Dir = tempDir
-	stdoutPipe, _ := cmd.StdoutPipe()
-	stderrPipe, _ := cmd.StderrPipe()
-
-	if err := cmd.Start(); err != nil {
-		sendJSONError(conn, "failed to start execution", err)
-		return
-	}
-
-	go streamPipe(conn, stdoutPipe, "stdout")
-	go streamPipe(conn, stderrPipe, "stderr")
-	cmd.Wait()
-}
+	sessionHooks.Emit(hooks.Event{Type: hooks.RunStarted, SessionID: sessionID, Data: map[string]interface{}{"entry": "main.sw"}})
 
-func streamPipe(conn *websocket.Conn, pipe io.ReadCloser, streamType string) {
-	scanner := bufio.NewScanner(pipe)
-	for scanner.Scan() {
-		conn.WriteJSON(map[string]string{"type": streamType, "content": scanner.Text()})
+	// Run swalang with main.sw as the entry point inside a fresh sandbox
+	outcome, err := runFiles(files, "main.sw", nil, func(stream, line string) {
+		conn.WriteJSON(map[string]string{"type": stream, "content": line})
+	})
+	if err != nil {
+		sendJSONError(conn, "failed to prepare project files", err)
+		outcome = &RunOutcome{ExitCode: -1, Error: err.Error()}
 	}
+	emitRunFinished(sessionID, "", "main.sw", outcome)
 }
 
-func sendJSONError(conn *websocket.Conn, message string, err error) {
+func sendJSONError(conn *wsConn, message string, err error) {
 	errMsg := message
 	if err != nil {
 		errMsg = message + ": " + err.Error()
@@ -411,23 +411,24 @@ func logsPlaygroundHandler(c *gin.Context) {
 	c.JSON(http.StatusNotImplemented, gin.H{"error": "Please use WebSocket"})
 }
 
-/* ============ PROJECT API HANDLERS (Astra DB) ============ */
+/* ============ PROJECT API HANDLERS ============ */
 
 func getProject(c *gin.Context) {
 	projID := c.Param("id")
-	versionStr := c.Query("version")
+	versionStr, status, err := queryVersion(c, projID)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
 
 	if versionStr != "" {
-		versionUUID, err := gocql.ParseUUID(versionStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version UUID format"})
-			return
-		}
+		versionUUID, _ := gocql.ParseUUID(versionStr)
 		tree := loadFatWithCache(projID, &versionUUID)
 		if tree == nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "project or version not found"})
 			return
 		}
+		c.Header("ETag", projectETag(versionUUID.String()))
 		raw, _ := json.Marshal(tree)
 		size := len(raw)
 		if size < 1*1024*1024 {
@@ -439,18 +440,38 @@ func getProject(c *gin.Context) {
 		return
 	}
 
-	size, err := projectSize(projID)
+	meta, err := store.GetMeta(projID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
 		return
 	}
+	c.Header("ETag", projectETag(meta.LastVersion))
+	if etagMatches(c.GetHeader("If-None-Match"), meta.LastVersion) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	size := meta.LastSize
 	if size < 1*1024*1024 {
 		tree := loadFatWithCache(projID, nil)
-		c.JSON(http.StatusOK, gin.H{"strategy": "fat", "size": size, "tree": tree})
+		c.JSON(http.StatusOK, gin.H{"strategy": "fat", "size": size, "tree": tree, "version": meta.LastVersion})
+		return
+	}
+	// Split projects are too large for one response: the first page of the
+	// listing comes with the cursor of the rest (see getFiles).
+	q, err := fileQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	files := listFiles(projID)
-	c.JSON(http.StatusOK, gin.H{"strategy": "split", "size": size, "fileCount": len(files), "files": files})
+	files, next, ok := listFileEntries(c, projID, q)
+	if !ok {
+		return
+	}
+	resp := gin.H{"strategy": "split", "size": size, "fileCount": meta.FileCount, "files": files, "version": meta.LastVersion}
+	if next != "" {
+		resp["nextCursor"] = next
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 func getSize(c *gin.Context) {
@@ -466,14 +487,14 @@ func getSize(c *gin.Context) {
 func getFile(c *gin.Context) {
 	projID := c.Param("id")
 	filePath := c.Param("path")[1:]
-	versionStr := c.Query("version")
+	versionStr, status, err := queryVersion(c, projID)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
 
 	if versionStr != "" {
-		versionUUID, err := gocql.ParseUUID(versionStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version UUID format"})
-			return
-		}
+		versionUUID, _ := gocql.ParseUUID(versionStr)
 		tree := loadFatWithCache(projID, &versionUUID)
 		if tree == nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "project or version not found"})
@@ -484,7 +505,7 @@ func getFile(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "file not found in this version"})
 			return
 		}
-		c.Data(http.StatusOK, "text/plain", []byte(foundFile.Content))
+		serveFileContent(c, *foundFile)
 		return
 	}
 
@@ -493,25 +514,61 @@ func getFile(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
 		return
 	}
-	c.Data(http.StatusOK, "text/plain", []byte(node.Content))
+	serveFileContent(c, node)
+}
+
+// serveFileContent writes the raw bytes of a file with its content type.
+// Range and conditional requests are answered against an ETag of the
+// contents. Files are user content on the API's origin, so browsers must not
+// sniff their type or run them, and only passive types are shown inline.
+func serveFileContent(c *gin.Context, n FileSystemNode) {
+	ctype := fileContentType(n.Name, n.MimeType, n.Content)
+	c.Header("Content-Type", ctype)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+	if !servedInline(ctype) {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": n.Name}))
+	}
+	c.Header("ETag", `"`+checksum(n.Content)+`"`)
+	http.ServeContent(c.Writer, c.Request, n.Name, time.Time{}, strings.NewReader(n.Content))
 }
 
 func postProject(c *gin.Context) {
 	projID := c.Param("id")
 	var req struct {
-		Tree []FileSystemNode `json:"tree"`
+		Tree        []FileSystemNode `json:"tree"`
+		Owner       string           `json:"owner,omitempty"`
+		Author      string           `json:"author,omitempty"`
+		Message     string           `json:"message,omitempty"`
+		BaseVersion string           `json:"baseVersion,omitempty"`
+		Branch      string           `json:"branch,omitempty"`
+		Merge       bool             `json:"merge,omitempty"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	version, size, err := saveHybrid(projID, req.Tree)
+	if c.Query("merge") == "true" {
+		req.Merge = true
+	}
+	if b := c.Query("branch"); b != "" {
+		req.Branch = b
+	}
+	base := baseVersionOf(c, req.BaseVersion)
+	opts := SaveOptions{Owner: saveOwner(c, req.Owner), Author: saveAuthor(c, req.Author), Message: req.Message, BaseVersion: base, Branch: req.Branch}
+	version, size, err := saveHybrid(projID, req.Tree, opts)
+	var conflict *ConflictError
+	if req.Merge && errors.As(err, &conflict) {
+		mergeAndSave(c, projID, base, conflict.CurrentVersion, req.Tree, opts)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondSaveError(c, projID, base, err)
 		return
 	}
-	broadcast(projID, map[string]interface{}{"type": "update", "version": version, "size": size})
-	c.JSON(http.StatusCreated, gin.H{"projectId": projID, "version": version, "size": size})
+	broadcast(projID, updateMessage(version, size, req.Branch))
+	c.Header("ETag", projectETag(version))
+	c.JSON(http.StatusCreated, gin.H{"projectId": projID, "version": version, "size": size, "branch": branchName(req.Branch)})
 }
 
 func postIndex(c *gin.Context) {
@@ -535,6 +592,9 @@ func getIndexStatus(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
 		return
 	}
+	if !authorize(c, job.(*IndexJob).ProjectID, roleViewer) {
+		return
+	}
 	c.JSON(http.StatusOK, job)
 }
 
@@ -544,6 +604,9 @@ func postSearchSimilar(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !authorize(c, q.ProjectID, roleViewer) {
+		return
+	}
 	if q.Limit <= 0 {
 		q.Limit = 10
 	}
@@ -575,21 +638,42 @@ func postSearchSimilar(c *gin.Context) {
 
 func handleWS(c *gin.Context) {
 	projID := c.Param("projectId")
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("ws upgrade: %v", err)
 		return
 	}
-	defer conn.Close()
+	defer ws.Close()
+	conn := &wsConn{Conn: ws}
 	conns, _ := projectConns.LoadOrStore(projID, &sync.Map{})
 	connID := uuid.New().String()
 	conns.(*sync.Map).Store(connID, conn)
 	defer conns.(*sync.Map).Delete(connID)
 	conn.WriteJSON(map[string]interface{}{"type": "hello", "projectId": projID, "connId": connID[:8]})
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var msg ProjectWSMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			switch msg.Action {
+			case "run":
+				runProjectOverWS(conn, projID, connID, msg.ProjectRunRequest)
+			default:
+				sendJSONError(conn, fmt.Sprintf("unknown action %q", msg.Action), nil)
+			}
+		}
+	}()
+
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 	for {
 		select {
+		case <-closed:
+			return
 		case <-ticker.C:
 			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
@@ -599,9 +683,17 @@ func handleWS(c *gin.Context) {
 }
 
 func broadcast(projectID string, msg interface{}) {
+	broadcastExcept(projectID, "", msg)
+}
+
+// broadcastExcept sends msg to every viewer of a project except connID.
+func broadcastExcept(projectID, connID string, msg interface{}) {
 	if conns, ok := projectConns.Load(projectID); ok {
 		conns.(*sync.Map).Range(func(key, value interface{}) bool {
-			conn := value.(*websocket.Conn)
+			if key.(string) == connID {
+				return true
+			}
+			conn := value.(*wsConn)
 			if err := conn.WriteJSON(msg); err != nil {
 				conns.(*sync.Map).Delete(key)
 			}
@@ -610,36 +702,19 @@ func broadcast(projectID string, msg interface{}) {
 	}
 }
 
-/* ============ Astra Data Helpers ============ */
+/* ============ Project Data Helpers ============ */
 
 func projectSize(projectID string) (int, error) {
-	var size int
-	err := session.Query(`SELECT size FROM project_snapshots WHERE project_id=? ORDER BY version DESC LIMIT 1`, projectID).Scan(&size)
-	return size, err
+	meta, err := store.GetMeta(projectID)
+	return meta.LastSize, err
 }
 
 func loadFat(projectID string, version *gocql.UUID) []FileSystemNode {
-	var raw string
-	var err error
-	var q *gocql.Query
-	cql := `SELECT snapshot FROM project_snapshots WHERE project_id = ?`
-	if version != nil {
-		cql += ` AND version = ? LIMIT 1`
-		q = session.Query(cql, projectID, *version)
-	} else {
-		cql += ` ORDER BY version DESC LIMIT 1`
-		q = session.Query(cql, projectID)
-	}
-	err = q.Consistency(gocql.One).Scan(&raw)
+	tree, err := store.LoadSnapshot(projectID, version)
 	if err != nil {
 		log.Printf("Failed to load snapshot for project %s (version: %v): %v", projectID, version, err)
 		return nil
 	}
-	var tree []FileSystemNode
-	if err := json.Unmarshal([]byte(raw), &tree); err != nil {
-		log.Printf("Failed to unmarshal snapshot for project %s: %v", projectID, err)
-		return nil
-	}
 	return tree
 }
 
@@ -668,64 +743,65 @@ func loadFatWithCache(projectID string, version *gocql.UUID) []FileSystemNode {
 	return tree
 }
 
-func listFiles(projectID string) []FileSystemNode {
-	iter := session.Query(`SELECT path,name,is_folder FROM project_files WHERE project_id=?`, projectID).Iter()
-	var nodes []FileSystemNode
-	var p, name string
-	var folder bool
-	for iter.Scan(&p, &name, &folder) {
-		nodes = append(nodes, FileSystemNode{Name: name, Type: map[bool]string{true: "folder", false: "file"}[folder], IsFolder: folder})
+// splitFileContents reads every file row of a project's split table, which
+// always mirrors the latest version.
+func splitFileContents(projectID string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := store.ForEachFile(projectID, func(f SplitFile) bool {
+		if !f.IsFolder {
+			files[f.Path] = f.Content
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
-	iter.Close()
-	return nodes
+	return files, nil
 }
 
 func getSplitFile(projectID, filePath string) FileSystemNode {
 	var f FileSystemNode
-	session.Query(`SELECT name,is_folder,content FROM project_files WHERE project_id=? AND path=?`, projectID, filePath).Scan(&f.Name, &f.IsFolder, &f.Content)
+	if sf, err := store.GetFile(projectID, filePath); err == nil {
+		f = FileSystemNode{Name: sf.Name, IsFolder: sf.IsFolder, Content: sf.Content, MimeType: sf.MimeType}
+	}
 	f.Type = map[bool]string{true: "folder", false: "file"}[f.IsFolder]
 	return f
 }
 
-func saveHybrid(projectID string, tree []FileSystemNode) (string, int, error) {
-	raw, _ := json.Marshal(tree)
-	ver := gocql.TimeUUID()
-	size := len(raw)
-	batch := session.NewBatch(gocql.LoggedBatch)
-	batch.Query(`INSERT INTO project_snapshots (project_id,version,snapshot,size,updated_at) VALUES (?,?,?,?,?)`, projectID, ver, string(raw), size, time.Now())
-	insertSplitBatch(projectID, tree, "", batch, time.Now())
-	if err := session.ExecuteBatch(batch); err != nil {
-		return "", 0, err
+func saveHybrid(projectID string, tree []FileSystemNode, opts SaveOptions) (string, int, error) {
+	if opts.Branch == defaultBranch {
+		opts.Branch = ""
+	}
+	if opts.Branch != "" {
+		v, err := saveToBranch(projectID, tree, opts)
+		return v.Version, v.Size, err
 	}
-	// Invalidate cache on save
+	meta, err := store.SaveSnapshot(projectID, tree, opts)
+	// Invalidate cache on save, and on errors too: a save can fail after its
+	// version was committed, e.g. while writing the split rows.
 	snapshotCache.Delete(fmt.Sprintf("%s@latest", projectID))
 	log.Printf("CACHE INVALIDATED for %s@latest", projectID)
-	return ver.String(), size, nil
-}
-
-func insertSplitBatch(projectID string, nodes []FileSystemNode, prefix string, batch *gocql.Batch, now time.Time) {
-	for _, n := range nodes {
-		p := path.Join(prefix, n.Name)
-		batch.Query(`INSERT INTO project_files (project_id,path,name,is_folder,content,checksum,updated_at) VALUES (?,?,?,?,?,?,?)`, projectID, p, n.Name, n.Type == "folder", n.Content, checksum(n.Content), now)
-		if n.Type == "folder" {
-			insertSplitBatch(projectID, n.Children, p, batch, now)
-		}
+	if err != nil {
+		return "", 0, err
 	}
+	return meta.LastVersion, meta.LastSize, nil
 }
 
 func runIndex(jobID, projectID string) {
 	job, _ := indexJobs.Load(jobID)
 	job.(*IndexJob).Status = "running"
 
-	iter := session.Query(`SELECT path,content FROM project_files WHERE project_id=?`, projectID).Iter()
 	type task struct{ path, content string }
 	tasks := make(chan task, 100)
 	go func() {
-		var p, content string
-		for iter.Scan(&p, &content) {
-			if content != "" {
-				tasks <- task{path: p, content: content}
+		err := store.ForEachFile(projectID, func(f SplitFile) bool {
+			if f.Content != "" && !diff.IsBinary(f.Content) {
+				tasks <- task{path: f.Path, content: f.Content}
 			}
+			return true
+		})
+		if err != nil {
+			log.Printf("Failed to scan files of project %s for indexing: %v", projectID, err)
 		}
 		close(tasks)
 	}()
@@ -743,7 +819,7 @@ func runIndex(jobID, projectID string) {
 				if err != nil {
 					continue
 				}
-				session.Query(`UPDATE project_files SET embedding=? WHERE project_id=? AND path=?`, vec, projectID, t.path).Exec()
+				store.SetEmbedding(projectID, t.path, vec)
 				mu.Lock()
 				done++
 				job.(*IndexJob).Progress = done
@@ -752,7 +828,6 @@ func runIndex(jobID, projectID string) {
 		}()
 	}
 	wg.Wait()
-	iter.Close()
 	mu.Lock()
 	job.(*IndexJob).Status = "done"
 	job.(*IndexJob).Total = done
@@ -760,26 +835,15 @@ func runIndex(jobID, projectID string) {
 }
 
 func getEmbedding(projectID, filePath string) ([]float32, error) {
-	var vec []float32
-	err := session.Query(`SELECT embedding FROM project_files WHERE project_id=? AND path=?`, projectID, filePath).Scan(&vec)
-	if err != nil || vec == nil {
+	vec, err := store.GetEmbedding(projectID, filePath)
+	if err != nil {
 		return nil, fmt.Errorf("not indexed")
 	}
 	return vec, nil
 }
 
 func searchSimilar(projectID string, queryVec []float32, limit int) ([]SimilarResult, error) {
-	iter := session.Query(`SELECT path,name, similarity_cosine(embedding,?) AS sim FROM project_files WHERE project_id=? AND embedding IS NOT NULL ORDER BY embedding ANN OF ? LIMIT ?`, queryVec, projectID, queryVec, limit).Iter()
-	var results []SimilarResult
-	var p, name string
-	var sim float32
-	for iter.Scan(&p, &name, &sim) {
-		results = append(results, SimilarResult{Path: p, Name: name, Similarity: sim})
-	}
-	if err := iter.Close(); err != nil {
-		return nil, err
-	}
-	return results, nil
+	return store.SearchSimilar(projectID, queryVec, limit)
 }
 
 func checksum(s string) string {
@@ -828,4 +892,4 @@ func findFileInTree(nodes []FileSystemNode, targetPath string) *FileSystemNode {
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
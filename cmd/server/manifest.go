@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+/* ---------- Content-Addressed Snapshots ---------- */
+
+// Snapshots are stored as manifests: the tree with every file's content
+// replaced by the SHA-256 of that content. The contents themselves are
+// stored once per project as blobs keyed by hash, so a save only adds the
+// files that changed.
+const snapshotFormatManifest = "manifest"
+
+type manifestNode struct {
+	ID       string         `json:"id"`
+	Name     string         `json:"name"`
+	Type     string         `json:"type"`
+	IsFolder bool           `json:"isFolder,omitempty"`
+	Hash     string         `json:"hash,omitempty"`
+	MimeType string         `json:"mimeType,omitempty"`
+	Children []manifestNode `json:"children,omitempty"`
+}
+
+func blobHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// toManifest converts tree to a manifest and adds every file content to blobs
+// (hash -> content).
+func toManifest(tree []FileSystemNode, blobs map[string]string) []manifestNode {
+	out := make([]manifestNode, 0, len(tree))
+	for _, n := range tree {
+		m := manifestNode{ID: n.ID, Name: n.Name, Type: n.Type, IsFolder: n.IsFolder}
+		if n.Type == "folder" {
+			m.Children = toManifest(n.Children, blobs)
+		} else {
+			m.Hash, m.MimeType = blobHash(n.Content), n.MimeType
+			blobs[m.Hash] = n.Content
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// manifestHashes returns the distinct blob hashes a manifest refers to.
+func manifestHashes(nodes []manifestNode, into map[string]bool) map[string]bool {
+	if into == nil {
+		into = make(map[string]bool)
+	}
+	for _, n := range nodes {
+		if n.Type == "folder" {
+			manifestHashes(n.Children, into)
+		} else {
+			into[n.Hash] = true
+		}
+	}
+	return into
+}
+
+// fromManifest rebuilds the full tree from a manifest and its blobs.
+func fromManifest(nodes []manifestNode, blobs map[string]string) ([]FileSystemNode, error) {
+	out := make([]FileSystemNode, 0, len(nodes))
+	for _, m := range nodes {
+		n := FileSystemNode{ID: m.ID, Name: m.Name, Type: m.Type, IsFolder: m.IsFolder}
+		if m.Type == "folder" {
+			children, err := fromManifest(m.Children, blobs)
+			if err != nil {
+				return nil, err
+			}
+			n.Children = children
+		} else {
+			content, ok := blobs[m.Hash]
+			if !ok {
+				return nil, fmt.Errorf("blob %s of %s is missing", m.Hash, m.ID)
+			}
+			n.Content, n.MimeType = content, m.MimeType
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	tree := filesToTree(map[string]string{
+		"main.sw":     "andika(\"hello\")",
+		"copy.sw":     "andika(\"hello\")",
+		"lib/util.sw": "kazi util() {}",
+		"empty.txt":   "",
+	})
+	blobs := make(map[string]string)
+	manifest := toManifest(tree, blobs)
+	if len(blobs) != 3 {
+		t.Errorf("toManifest() stored %d blobs, want 3 (duplicates shared)", len(blobs))
+	}
+	if hashes := manifestHashes(manifest, nil); len(hashes) != 3 {
+		t.Errorf("manifestHashes() = %v", hashes)
+	}
+	got, err := fromManifest(manifest, blobs)
+	if err != nil || !reflect.DeepEqual(got, tree) {
+		t.Errorf("fromManifest() = %+v, %v", got, err)
+	}
+	delete(blobs, blobHash("kazi util() {}"))
+	if _, err := fromManifest(manifest, blobs); err == nil {
+		t.Error("fromManifest() with a missing blob succeeded")
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+
+	"swalang-api-dualmode/internal/diff"
+)
+
+/* ============ THREE-WAY MERGE ============ */
+
+// FileConflict describes a file that could not be merged automatically.
+// Kind is one of "content" (overlapping edits), "add_add" (both sides added
+// the file), "modify_delete" (one side changed a file the other deleted),
+// "binary" or "file_folder" (a file on one side is a folder on the other).
+type FileConflict struct {
+	Path      string          `json:"path"`
+	Kind      string          `json:"kind"`
+	Conflicts []diff.Conflict `json:"conflicts,omitempty"`
+}
+
+// mergeTrees merges the client's changes (base -> client) into the stored
+// latest version (base -> stored), node by node. Files and folders keep the
+// node of the side their state comes from, with its ID and mimeType, and
+// empty folders survive. The merged files contain conflict markers wherever
+// a conflict was reported.
+func mergeTrees(base, stored, client []FileSystemNode, storedLabel string) ([]FileSystemNode, []FileConflict) {
+	b, s, cl := treeNodes(base), treeNodes(stored), treeNodes(client)
+	paths := make(map[string]bool)
+	for _, m := range []map[string]FileSystemNode{b, s, cl} {
+		for p := range m {
+			paths[p] = true
+		}
+	}
+
+	merged := make(map[string]FileSystemNode)
+	var conflicts []FileConflict
+	for p := range paths {
+		bn, inB := b[p]
+		sn, inS := s[p]
+		cn, inC := cl[p]
+		switch {
+		case inS == inC && sameNode(sn, cn):
+			// Same result on both sides.
+		case inB == inC && sameNode(bn, cn):
+			// Only the stored side changed.
+			inC, cn = inS, sn
+		case inB == inS && sameNode(bn, sn):
+			// Only the client changed; cn already holds its state.
+		case !inS || !inC:
+			conflicts = append(conflicts, FileConflict{Path: p, Kind: "modify_delete"})
+			if !inC {
+				inC, cn = true, sn
+			}
+		case sn.Type == "folder" || cn.Type == "folder":
+			// Keep the folder, so the files below it stay reachable.
+			conflicts = append(conflicts, FileConflict{Path: p, Kind: "file_folder"})
+			if cn.Type != "folder" {
+				cn = sn
+			}
+		case diff.IsBinary(bn.Content) || diff.IsBinary(sn.Content) || diff.IsBinary(cn.Content):
+			conflicts = append(conflicts, FileConflict{Path: p, Kind: "binary"})
+		default:
+			text, cs := diff.MergeText(bn.Content, sn.Content, cn.Content, storedLabel, "yours")
+			cn.Content = text
+			if cn.MimeType == bn.MimeType {
+				cn.MimeType = sn.MimeType
+			}
+			if cs != nil {
+				kind := "content"
+				if !inB {
+					kind = "add_add"
+				}
+				conflicts = append(conflicts, FileConflict{Path: p, Kind: kind, Conflicts: cs})
+			}
+		}
+		if inC {
+			merged[p] = cn
+		}
+	}
+
+	// A file that one side kept where the other side filled a folder gives
+	// way to the folder.
+	parents := make(map[string]bool)
+	for p := range merged {
+		for d := path.Dir(p); d != "."; d = path.Dir(d) {
+			parents[d] = true
+		}
+	}
+	for p, n := range merged {
+		if n.Type != "folder" && parents[p] {
+			delete(merged, p)
+			conflicts = append(conflicts, FileConflict{Path: p, Kind: "file_folder"})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	return nodesToTree(merged), conflicts
+}
+
+// treeNodes flattens a tree into a path -> node map of its files and
+// folders. Folder nodes are returned without their children.
+func treeNodes(tree []FileSystemNode) map[string]FileSystemNode {
+	nodes := make(map[string]FileSystemNode)
+	for _, r := range splitRows(tree, "") {
+		n := r.Node
+		n.Children = nil
+		nodes[r.Path] = n
+	}
+	return nodes
+}
+
+// sameNode reports whether two nodes hold the same state. IDs are not
+// compared: clients assign their own.
+func sameNode(a, b FileSystemNode) bool {
+	if a.Type == "folder" || b.Type == "folder" {
+		return a.Type == b.Type
+	}
+	return a.Content == b.Content && a.MimeType == b.MimeType
+}
+
+// nodesToTree rebuilds a tree from a path -> node map, creating parent
+// folders that are missing from it.
+func nodesToTree(nodes map[string]FileSystemNode) []FileSystemNode {
+	paths := make([]string, 0, len(nodes))
+	for p := range nodes {
+		paths = append(paths, p)
+	}
+	// Parents sort before their children.
+	sort.Strings(paths)
+	var root []FileSystemNode
+	for _, p := range paths {
+		root = insertNode(root, "", strings.Split(p, "/"), nodes[p])
+	}
+	sortTree(root)
+	return root
+}
+
+func insertNode(nodes []FileSystemNode, prefix string, parts []string, node FileSystemNode) []FileSystemNode {
+	name := parts[0]
+	p := path.Join(prefix, name)
+	if len(parts) == 1 {
+		node.Name = name
+		return append(nodes, node)
+	}
+	for i := range nodes {
+		if nodes[i].Name == name && nodes[i].Type == "folder" {
+			nodes[i].Children = insertNode(nodes[i].Children, p, parts[1:], node)
+			return nodes
+		}
+	}
+	folder := FileSystemNode{ID: p, Name: name, Type: "folder", IsFolder: true}
+	folder.Children = insertNode(nil, p, parts[1:], node)
+	return append(nodes, folder)
+}
+
+// mergeAndSave resolves a conflicting save with merge=true: the client tree,
+// based on base, is merged with the current version of the branch and saved
+// on top of it.
+func mergeAndSave(c *gin.Context, projectID, base, current string, client []FileSystemNode, opts SaveOptions) {
+	baseUUID, err1 := gocql.ParseUUID(base)
+	currentUUID, err2 := gocql.ParseUUID(current)
+	if err1 != nil || err2 != nil {
+		respondConflict(c, projectID, base, current)
+		return
+	}
+	baseTree := loadFatWithCache(projectID, &baseUUID)
+	storedTree := loadFatWithCache(projectID, &currentUUID)
+	if baseTree == nil || storedTree == nil {
+		respondConflict(c, projectID, base, current)
+		return
+	}
+
+	tree, conflicts := mergeTrees(baseTree, storedTree, client, current)
+	if len(conflicts) > 0 {
+		c.Header("ETag", projectETag(current))
+		c.JSON(http.StatusConflict, gin.H{"error": "merge conflict", "baseVersion": base, "currentVersion": current, "conflicts": conflicts, "mergedTree": tree})
+		return
+	}
+
+	opts.BaseVersion = current
+	version, size, err := saveHybrid(projectID, tree, opts)
+	if err != nil {
+		respondSaveError(c, projectID, current, err)
+		return
+	}
+	broadcast(projectID, updateMessage(version, size, opts.Branch))
+	c.Header("ETag", projectETag(version))
+	c.JSON(http.StatusCreated, gin.H{"projectId": projectID, "version": version, "size": size, "merged": true, "baseVersion": base, "mergedWith": current})
+}
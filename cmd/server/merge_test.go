@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMergeTrees(t *testing.T) {
+	base := filesToTree(map[string]string{
+		"main.sw":  "a\nb\nc\nd\n",
+		"both.sw":  "x\n",
+		"gone.sw":  "bye\n",
+		"keep.sw":  "keep\n",
+		"mixed.sw": "1\n",
+	})
+	stored := filesToTree(map[string]string{
+		"main.sw":   "A\nb\nc\nd\n",
+		"both.sw":   "stored\n",
+		"keep.sw":   "keep\n",
+		"mixed.sw":  "1\n",
+		"stored.sw": "new on server\n",
+	})
+	client := filesToTree(map[string]string{
+		"main.sw":   "a\nb\nc\nD\n",
+		"both.sw":   "client\n",
+		"gone.sw":   "bye\n",
+		"mixed.sw":  "2\n",
+		"client.sw": "new in tab\n",
+	})
+
+	tree, conflicts := mergeTrees(base, stored, client, "stored")
+	files := treeToFiles(tree, "")
+	want := map[string]string{
+		"main.sw":   "A\nb\nc\nD\n",
+		"both.sw":   "<<<<<<< stored\nstored\n=======\nclient\n>>>>>>> yours\n",
+		"mixed.sw":  "2\n",
+		"stored.sw": "new on server\n",
+		"client.sw": "new in tab\n",
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("merged files = %q, want %q", files, want)
+	}
+	if len(conflicts) != 1 || conflicts[0].Path != "both.sw" || conflicts[0].Kind != "content" {
+		t.Errorf("conflicts = %+v", conflicts)
+	}
+
+	// Deleted on the server, changed in the tab.
+	_, conflicts = mergeTrees(base, stored, filesToTree(map[string]string{"gone.sw": "changed\n"}), "stored")
+	var kinds []string
+	for _, c := range conflicts {
+		kinds = append(kinds, c.Path+":"+c.Kind)
+	}
+	if !reflect.DeepEqual(kinds, []string{"both.sw:modify_delete", "gone.sw:modify_delete", "main.sw:modify_delete"}) {
+		t.Errorf("conflict kinds = %v", kinds)
+	}
+}
+
+func TestMergeTreesKeepsNodes(t *testing.T) {
+	base := []FileSystemNode{
+		{ID: "f1", Name: "logo.png", Type: "file", Content: "\x89PNG", MimeType: "image/png"},
+		{ID: "f2", Name: "main.sw", Type: "file", Content: "a\n"},
+		{ID: "d1", Name: "assets", Type: "folder", IsFolder: true},
+	}
+	stored := append([]FileSystemNode{{ID: "d2", Name: "docs", Type: "folder", IsFolder: true}}, base...)
+	stored[2].Content = "A\n"
+	client := append([]FileSystemNode{{ID: "d3", Name: "tests", Type: "folder", IsFolder: true}}, base...)
+	client[2].MimeType = "text/x-swahili"
+
+	tree, conflicts := mergeTrees(base, stored, client, "stored")
+	if len(conflicts) != 0 {
+		t.Fatalf("conflicts = %+v", conflicts)
+	}
+	want := []FileSystemNode{
+		{ID: "d1", Name: "assets", Type: "folder", IsFolder: true},
+		{ID: "d2", Name: "docs", Type: "folder", IsFolder: true},
+		{ID: "d3", Name: "tests", Type: "folder", IsFolder: true},
+		{ID: "f1", Name: "logo.png", Type: "file", Content: "\x89PNG", MimeType: "image/png"},
+		{ID: "f2", Name: "main.sw", Type: "file", Content: "A\n", MimeType: "text/x-swahili"},
+	}
+	if !reflect.DeepEqual(tree, want) {
+		t.Errorf("merged tree = %+v, want %+v", tree, want)
+	}
+
+	// The server turned a file into a folder the tab still edits as a file.
+	stored = filesToTree(map[string]string{"main.sw/part.sw": "x\n"})
+	client = filesToTree(map[string]string{"main.sw": "b\n"})
+	tree, conflicts = mergeTrees(filesToTree(map[string]string{"main.sw": "a\n"}), stored, client, "stored")
+	if len(conflicts) != 1 || conflicts[0].Kind != "file_folder" || !reflect.DeepEqual(tree, stored) {
+		t.Errorf("file/folder merge = %+v, %+v", tree, conflicts)
+	}
+}
+
+func TestMergeOnSave(t *testing.T) {
+	r := newTestRouter(t)
+	save := func(body gin.H) *httptestResponse {
+		w := doJSON(t, r, http.MethodPost, "/api/projects/demo?merge=true", body)
+		return &httptestResponse{code: w.Code, etag: strings.Trim(w.Header().Get("ETag"), `"`), body: w.Body.String()}
+	}
+	v1 := save(gin.H{"tree": filesToTree(map[string]string{"main.sw": "a\nb\nc\n", "util.sw": "u\n"})}).etag
+	save(gin.H{"tree": filesToTree(map[string]string{"main.sw": "A\nb\nc\n", "util.sw": "u\n"}), "baseVersion": v1})
+
+	// A second tab, still on v1, edits a different line: merged cleanly.
+	res := save(gin.H{"tree": filesToTree(map[string]string{"main.sw": "a\nb\nC\n", "util.sw": "u\n"}), "baseVersion": v1})
+	if res.code != http.StatusCreated || !strings.Contains(res.body, `"merged":true`) {
+		t.Fatalf("clean merge = %d %s", res.code, res.body)
+	}
+	if got := treeToFiles(loadFat("demo", nil), ""); got["main.sw"] != "A\nb\nC\n" {
+		t.Errorf("merged main.sw = %q", got["main.sw"])
+	}
+
+	// Editing the same line conflicts and saves nothing.
+	before, _ := store.GetMeta("demo")
+	res = save(gin.H{"tree": filesToTree(map[string]string{"main.sw": "x\nb\nc\n", "util.sw": "u\n"}), "baseVersion": v1})
+	if res.code != http.StatusConflict || !strings.Contains(res.body, `"conflicts"`) || !strings.Contains(res.body, "=======") {
+		t.Errorf("conflicting merge = %d %s", res.code, res.body)
+	}
+	if after, _ := store.GetMeta("demo"); after.LastVersion != before.LastVersion {
+		t.Error("conflicting merge created a version")
+	}
+}
+
+type httptestResponse struct {
+	code       int
+	etag, body string
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"swalang-api-dualmode/internal/runner"
+)
+
+/* ============ SINGLE-FILE EDITS ============ */
+
+// The routes below are shorthands for a PATCH with one op. Each saves a new
+// version on the branch (?branch=, main by default) and honours If-Match
+// like PATCH does.
+
+func fileEditRequest(c *gin.Context) PatchRequest {
+	return PatchRequest{Author: c.Query("author"), Message: c.Query("message"), Branch: c.Query("branch")}
+}
+
+// putProjectFile serves PUT /api/projects/:id/files/*path. The request body
+// is the raw file content; ?mimeType= sets the type it is served with.
+func putProjectFile(c *gin.Context) {
+	path := c.Param("path")[1:]
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, importLimits.MaxFileBytes)
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file too large", "code": "file_too_large", "limit": importLimits.MaxFileBytes})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req := fileEditRequest(c)
+	if req.Message == "" {
+		req.Message = "Update " + path
+	}
+	mimeType := c.Query("mimeType")
+	// Ops carry content in its JSON encoding.
+	enc := contentEncoding(string(data))
+	req.Ops = []PatchOp{{Op: "put", Path: path, Content: encodeContent(string(data), enc), Encoding: enc, MimeType: mimeType}}
+	commitPatch(c, c.Param("id"), req)
+}
+
+// deleteProjectFile serves DELETE /api/projects/:id/files/*path. Deleting a
+// folder deletes everything in it.
+func deleteProjectFile(c *gin.Context) {
+	path := c.Param("path")[1:]
+	req := fileEditRequest(c)
+	if req.Message == "" {
+		req.Message = "Delete " + path
+	}
+	req.Ops = []PatchOp{{Op: "delete", Path: path}}
+	commitPatch(c, c.Param("id"), req)
+}
+
+// moveProjectFile serves PATCH /api/projects/:id/files/*path with
+// {"to": "new/path"}, which moves or renames a file or folder.
+func moveProjectFile(c *gin.Context) {
+	path := c.Param("path")[1:]
+	var body struct {
+		To          string `json:"to" binding:"required"`
+		BaseVersion string `json:"baseVersion,omitempty"`
+		Author      string `json:"author,omitempty"`
+		Message     string `json:"message,omitempty"`
+		Branch      string `json:"branch,omitempty"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req := PatchRequest{BaseVersion: body.BaseVersion, Author: body.Author, Message: body.Message, Branch: body.Branch}
+	if req.Message == "" {
+		req.Message = "Move " + path + " to " + body.To
+	}
+	req.Ops = []PatchOp{{Op: "move", From: path, To: body.To}}
+	commitPatch(c, c.Param("id"), req)
+}
+
+/* ============ FILE LISTING ============ */
+
+const (
+	defaultFileListLimit = 500
+	maxFileListLimit     = 5000
+)
+
+// FileEntry is one file or folder of a split listing.
+type FileEntry struct {
+	Path      string    `json:"path"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Size      int       `json:"size"`
+	MimeType  string    `json:"mimeType,omitempty"`
+	Checksum  string    `json:"checksum,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// fileQuery reads ?prefix=, ?dir=, ?limit= and ?cursor=. ?dir= lists one
+// level of the tree: the direct children of a folder, or of the root when
+// it is empty.
+func fileQuery(c *gin.Context) (FileQuery, error) {
+	q := FileQuery{Prefix: c.Query("prefix"), Cursor: c.Query("cursor")}
+	limit, ok := queryInt(c, "limit", defaultFileListLimit)
+	if !ok || limit == 0 {
+		return q, errors.New("limit must be a positive integer")
+	}
+	if limit > maxFileListLimit {
+		limit = maxFileListLimit
+	}
+	q.Limit = limit
+	if dir, ok := c.GetQuery("dir"); ok {
+		if q.Prefix != "" {
+			return q, errors.New("use either prefix or dir")
+		}
+		if dir = strings.Trim(dir, "/"); dir != "" {
+			p, err := runner.ValidatePath(dir, 0)
+			if err != nil {
+				return q, err
+			}
+			q.Prefix = p + "/"
+		}
+		q.OneLevel = true
+	}
+	return q, nil
+}
+
+// listFileEntries lists the split rows q selects, answering errors itself.
+func listFileEntries(c *gin.Context, projID string, q FileQuery) ([]FileEntry, string, bool) {
+	files, next, err := store.ListFiles(projID, q)
+	switch {
+	case errors.Is(err, errInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, "", false
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, "", false
+	}
+	entries := make([]FileEntry, 0, len(files))
+	for _, f := range files {
+		e := FileEntry{Path: f.Path, Name: f.Name, Type: "file", Size: f.Size, MimeType: f.MimeType, Checksum: f.Checksum, UpdatedAt: f.UpdatedAt}
+		if f.IsFolder {
+			e.Type, e.Checksum = "folder", ""
+		}
+		entries = append(entries, e)
+	}
+	return entries, next, true
+}
+
+// getFiles serves GET /api/projects/:id/files, the split rows of the latest
+// version in path order.
+func getFiles(c *gin.Context) {
+	projID := c.Param("id")
+	q, err := fileQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	meta, err := store.GetMeta(projID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	files, next, ok := listFileEntries(c, projID, q)
+	if !ok {
+		return
+	}
+	resp := gin.H{"projectId": projID, "version": meta.LastVersion, "files": files}
+	if next != "" {
+		resp["nextCursor"] = next
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+
+	"swalang-api-dualmode/internal/runner"
+)
+
+/* ============ INCREMENTAL SAVES ============ */
+
+const maxPatchOps = 1000
+
+// PatchOp is one edit of a PATCH /api/projects/:id request:
+//
+//	{"op": "put", "path": "main.sw", "content": "..."}
+//	{"op": "put", "path": "logo.png", "content": "iVBORw0...", "encoding": "base64", "mimeType": "image/png"}
+//	{"op": "delete", "path": "old"}
+//	{"op": "move", "from": "a.sw", "to": "lib/a.sw"}
+//	{"op": "mkdir", "path": "lib"}
+type PatchOp struct {
+	Op       string `json:"op"`
+	Path     string `json:"path,omitempty"`
+	Content  string `json:"content,omitempty"`
+	Encoding string `json:"encoding,omitempty"` // of content: "utf8" (default) or "base64"
+	MimeType string `json:"mimeType,omitempty"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+}
+
+type PatchRequest struct {
+	BaseVersion string    `json:"baseVersion,omitempty"`
+	Ops         []PatchOp `json:"ops"`
+	Author      string    `json:"author,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	Branch      string    `json:"branch,omitempty"`
+}
+
+// errPathNotFound, errPathExists and errParentIsFile are wrapped by
+// applyPatch errors about the paths an op names.
+var (
+	errPathNotFound = errors.New("does not exist")
+	errPathExists   = errors.New("already exists")
+	errParentIsFile = errors.New("is a file")
+)
+
+// checkParents refuses to place a node below a file, which putNode would
+// otherwise replace with a folder.
+func checkParents(tree []FileSystemNode, p string) error {
+	if f := fileAncestor(tree, p); f != "" {
+		return fmt.Errorf("%s %w", f, errParentIsFile)
+	}
+	return nil
+}
+
+// applyPatch applies ops in order to tree and returns the new tree. tree
+// itself is left unchanged.
+func applyPatch(tree []FileSystemNode, ops []PatchOp) ([]FileSystemNode, error) {
+	for i, op := range ops {
+		var err error
+		if tree, err = applyPatchOp(tree, op); err != nil {
+			return nil, fmt.Errorf("ops[%d] (%s): %w", i, op.Op, err)
+		}
+	}
+	return tree, nil
+}
+
+func applyPatchOp(tree []FileSystemNode, op PatchOp) ([]FileSystemNode, error) {
+	switch op.Op {
+	case "put":
+		p, err := runner.ValidatePath(op.Path, 0)
+		if err != nil {
+			return nil, err
+		}
+		if n := findNode(tree, p); n != nil && n.Type == "folder" {
+			return nil, fmt.Errorf("%s is a folder", p)
+		}
+		if err := checkParents(tree, p); err != nil {
+			return nil, err
+		}
+		content, err := decodeContent(op.Content, op.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		mimeType := op.MimeType
+		if mimeType != "" {
+			if mimeType, err = parseMimeType(mimeType); err != nil {
+				return nil, err
+			}
+		}
+		return putNode(tree, p, FileSystemNode{Type: "file", Content: content, MimeType: mimeType}), nil
+	case "mkdir":
+		p, err := runner.ValidatePath(op.Path, 0)
+		if err != nil {
+			return nil, err
+		}
+		if n := findNode(tree, p); n != nil {
+			if n.Type != "folder" {
+				return nil, fmt.Errorf("%s is a file", p)
+			}
+			return tree, nil
+		}
+		if err := checkParents(tree, p); err != nil {
+			return nil, err
+		}
+		return putNode(tree, p, FileSystemNode{Type: "folder", IsFolder: true}), nil
+	case "delete":
+		p, err := runner.ValidatePath(op.Path, 0)
+		if err != nil {
+			return nil, err
+		}
+		out, ok := removeNode(tree, p)
+		if !ok {
+			return nil, fmt.Errorf("%s %w", p, errPathNotFound)
+		}
+		return out, nil
+	case "move":
+		from, err := runner.ValidatePath(op.From, 0)
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		to, err := runner.ValidatePath(op.To, 0)
+		if err != nil {
+			return nil, fmt.Errorf("to: %w", err)
+		}
+		n := findNode(tree, from)
+		if n == nil {
+			return nil, fmt.Errorf("%s %w", from, errPathNotFound)
+		}
+		if findNode(tree, to) != nil {
+			return nil, fmt.Errorf("%s %w", to, errPathExists)
+		}
+		if strings.HasPrefix(to+"/", from+"/") {
+			return nil, fmt.Errorf("cannot move %s into itself", from)
+		}
+		if err := checkParents(tree, to); err != nil {
+			return nil, err
+		}
+		node := *n
+		out, _ := removeNode(tree, from)
+		return putNode(out, to, node), nil
+	default:
+		return nil, fmt.Errorf("unknown op %q", op.Op)
+	}
+}
+
+// patchProject serves PATCH /api/projects/:id. The ops are applied to the
+// head of the branch (main by default) server-side; only split rows whose checksum changed are
+// rewritten.
+func patchProject(c *gin.Context) {
+	projID := c.Param("id")
+	var req PatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Ops) == 0 || len(req.Ops) > maxPatchOps {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("between 1 and %d ops are required", maxPatchOps)})
+		return
+	}
+	commitPatch(c, projID, req)
+}
+
+// commitPatch applies req.Ops to the head of req.Branch, saves the result as
+// a new version and responds with it. The per-file routes answer 404 and 409
+// when the path they address is missing or taken; PATCH answers 400.
+func commitPatch(c *gin.Context, projID string, req PatchRequest) {
+	if b := c.Query("branch"); b != "" {
+		req.Branch = b
+	}
+	head, err := branchHead(projID, req.Branch)
+	if err != nil {
+		c.JSON(refErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	// Ops are relative to the base version; applying them on top of a newer
+	// version would silently drop its changes. Without an explicit base the
+	// version loaded here is the base, so a concurrent save still conflicts.
+	base := baseVersionOf(c, req.BaseVersion)
+	if base == "" {
+		base = head
+	}
+	if base != head {
+		respondConflict(c, projID, base, head)
+		return
+	}
+	baseUUID, _ := gocql.ParseUUID(base)
+	baseTree := loadFatWithCache(projID, &baseUUID)
+	if baseTree == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	tree, err := applyPatch(baseTree, req.Ops)
+	if err != nil {
+		status := http.StatusBadRequest
+		if c.Param("path") != "" {
+			switch {
+			case errors.Is(err, errPathNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, errPathExists), errors.Is(err, errParentIsFile):
+				status = http.StatusConflict
+			}
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	version, size, err := saveHybrid(projID, tree, SaveOptions{Author: saveAuthor(c, req.Author), Message: req.Message, BaseVersion: base, Branch: req.Branch})
+	if err != nil {
+		respondSaveError(c, projID, base, err)
+		return
+	}
+	broadcast(projID, updateMessage(version, size, req.Branch))
+	c.Header("ETag", projectETag(version))
+	c.JSON(http.StatusOK, gin.H{"projectId": projID, "version": version, "size": size, "baseVersion": base, "branch": branchName(req.Branch)})
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestApplyPatch(t *testing.T) {
+	base := sampleTree()
+	tree, err := applyPatch(base, []PatchOp{
+		{Op: "put", Path: "main.sw", Content: "changed"},
+		{Op: "mkdir", Path: "empty"},
+		{Op: "move", From: "lib", To: "pkg/lib"},
+		{Op: "put", Path: "pkg/new.sw", Content: "new"},
+		{Op: "delete", Path: "pkg/lib/util.sw"},
+	})
+	if err != nil {
+		t.Fatalf("applyPatch() error = %v", err)
+	}
+	want := map[string]string{"main.sw": "changed", "pkg/new.sw": "new"}
+	if got := treeToFiles(tree, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	if n := findNode(tree, "empty"); n == nil || n.Type != "folder" {
+		t.Errorf("mkdir node = %+v", n)
+	}
+	if got := treeToFiles(base, ""); got["main.sw"] != "andika(\"hello\")" {
+		t.Errorf("base tree was modified: %v", got)
+	}
+
+	for _, ops := range [][]PatchOp{
+		{{Op: "delete", Path: "missing.sw"}},
+		{{Op: "put", Path: "lib", Content: "x"}},
+		{{Op: "mkdir", Path: "main.sw"}},
+		{{Op: "move", From: "lib", To: "lib/inner"}},
+		{{Op: "move", From: "main.sw", To: "lib/util.sw"}},
+		{{Op: "put", Path: "main.sw/x", Content: "x"}},
+		{{Op: "mkdir", Path: "main.sw/sub"}},
+		{{Op: "move", From: "lib", To: "main.sw/lib"}},
+		{{Op: "put", Path: "../escape.sw"}},
+		{{Op: "chmod", Path: "main.sw"}},
+	} {
+		if _, err := applyPatch(base, ops); err == nil {
+			t.Errorf("applyPatch(%+v) succeeded, want error", ops)
+		}
+	}
+}
+
+func TestPatchProject(t *testing.T) {
+	r := newTestRouter(t)
+	var saved struct {
+		Version string `json:"version"`
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree()}), &saved)
+	before, _ := store.GetFile("demo", "main.sw")
+
+	w := doJSON(t, r, http.MethodPatch, "/api/projects/demo", gin.H{
+		"baseVersion": saved.Version,
+		"ops":         []gin.H{{"op": "move", "from": "lib/util.sw", "to": "util.sw"}},
+		"message":     "flatten",
+	})
+	var patched struct {
+		Version     string `json:"version"`
+		BaseVersion string `json:"baseVersion"`
+	}
+	decodeJSON(t, w, &patched)
+	if w.Code != http.StatusOK || patched.BaseVersion != saved.Version || patched.Version == saved.Version {
+		t.Fatalf("PATCH = %d %s", w.Code, w.Body)
+	}
+
+	files, _, _ := store.ListFiles("demo", FileQuery{})
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	if want := []string{"lib", "main.sw", "util.sw"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("split rows = %v, want %v", paths, want)
+	}
+	if after, _ := store.GetFile("demo", "main.sw"); !after.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Error("unchanged main.sw row was rewritten")
+	}
+
+	if w := doJSON(t, r, http.MethodPatch, "/api/projects/demo", gin.H{"baseVersion": saved.Version, "ops": []gin.H{{"op": "delete", "path": "main.sw"}}}); w.Code != http.StatusConflict {
+		t.Errorf("PATCH on stale base = %d, want 409", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPatch, "/api/projects/demo", gin.H{"ops": []gin.H{{"op": "delete", "path": "nope"}}}); w.Code != http.StatusBadRequest {
+		t.Errorf("PATCH with bad op = %d, want 400", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPatch, "/api/projects/missing", gin.H{"ops": []gin.H{{"op": "mkdir", "path": "x"}}}); w.Code != http.StatusNotFound {
+		t.Errorf("PATCH on missing project = %d, want 404", w.Code)
+	}
+}
+
+func TestProjectFileRoutes(t *testing.T) {
+	r := newTestRouter(t)
+	doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree()})
+	send := func(method, url, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(http.MethodPut, "/api/projects/demo/files/assets/logo.png?mimeType=image/x-custom&message=Add+logo", pngBytes); w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", w.Code, w.Body)
+	}
+	if w := send(http.MethodGet, "/api/projects/demo/files/assets/logo.png", ""); w.Body.String() != pngBytes || w.Header().Get("Content-Type") != "image/x-custom" {
+		t.Errorf("GET logo.png = %q %s", w.Body, w.Header().Get("Content-Type"))
+	}
+	if w := send(http.MethodPut, "/api/projects/demo/files/main.sw", "andika(2)"); w.Code != http.StatusOK {
+		t.Fatalf("PUT main.sw = %d %s", w.Code, w.Body)
+	}
+	if w := doJSON(t, r, http.MethodPatch, "/api/projects/demo/files/main.sw", gin.H{"to": "app/main.sw"}); w.Code != http.StatusOK {
+		t.Fatalf("move = %d %s", w.Code, w.Body)
+	}
+	if w := send(http.MethodDelete, "/api/projects/demo/files/lib", ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE folder = %d %s", w.Code, w.Body)
+	}
+
+	want := map[string]string{"app/main.sw": "andika(2)", "assets/logo.png": pngBytes}
+	if files, _ := splitFileContents("demo"); !reflect.DeepEqual(files, want) {
+		t.Errorf("split rows = %q, want %q", files, want)
+	}
+	versions, _ := allVersions("demo")
+	if len(versions) != 5 || versions[0].Message != "Delete lib" || versions[1].Message != "Move main.sw to app/main.sw" || versions[3].Message != "Add logo" {
+		t.Errorf("versions = %+v", versions)
+	}
+
+	if w := send(http.MethodDelete, "/api/projects/demo/files/nope", ""); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE missing file = %d, want 404", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPatch, "/api/projects/demo/files/app/main.sw", gin.H{"to": "assets/logo.png"}); w.Code != http.StatusConflict {
+		t.Errorf("move onto existing file = %d, want 409", w.Code)
+	}
+	// A file in the way of the target is an error, not replaced by a folder.
+	if w := send(http.MethodPut, "/api/projects/demo/files/app/main.sw/x.sw", "x"); w.Code != http.StatusConflict {
+		t.Errorf("PUT below a file = %d %s, want 409", w.Code, w.Body)
+	}
+	if w := doJSON(t, r, http.MethodPatch, "/api/projects/demo/files/assets/logo.png", gin.H{"to": "app/main.sw/logo.png"}); w.Code != http.StatusConflict {
+		t.Errorf("move below a file = %d %s, want 409", w.Code, w.Body)
+	}
+	if files, _ := splitFileContents("demo"); files["app/main.sw"] != "andika(2)" {
+		t.Errorf("app/main.sw after writes below it = %q", files["app/main.sw"])
+	}
+	if w := send(http.MethodPut, "/api/projects/missing/files/a.sw", "x"); w.Code != http.StatusNotFound {
+		t.Errorf("PUT into missing project = %d, want 404", w.Code)
+	}
+	defer func(l ImportLimits) { importLimits = l }(importLimits)
+	importLimits.MaxFileBytes = 4
+	if w := send(http.MethodPut, "/api/projects/demo/files/big.sw", "12345"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("PUT of oversized file = %d, want 413", w.Code)
+	}
+}
+
+func TestGetFiles(t *testing.T) {
+	r := newTestRouter(t)
+	doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": filesToTree(map[string]string{
+		"main.sw":        "andika(1)",
+		"lib/a.sw":       "a",
+		"lib/b.sw":       "bb",
+		"lib/deep/c.sw":  "ccc",
+		"lib2/other.sw":  "x",
+		"assets/logo.sw": pngBytes,
+	})})
+
+	type listing struct {
+		Files      []FileEntry `json:"files"`
+		NextCursor string      `json:"nextCursor"`
+	}
+	paths := func(l listing) []string {
+		var out []string
+		for _, f := range l.Files {
+			out = append(out, f.Path)
+		}
+		return out
+	}
+
+	var all []string
+	url := "/api/projects/demo/files?limit=3"
+	for pages := 0; ; pages++ {
+		var page listing
+		decodeJSON(t, doJSON(t, r, http.MethodGet, url, nil), &page)
+		if len(page.Files) > 3 || pages > 5 {
+			t.Fatalf("page %d = %+v", pages, page)
+		}
+		all = append(all, paths(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		url = "/api/projects/demo/files?limit=3&cursor=" + page.NextCursor
+	}
+	want := []string{"assets", "assets/logo.sw", "lib", "lib/a.sw", "lib/b.sw", "lib/deep", "lib/deep/c.sw", "lib2", "lib2/other.sw", "main.sw"}
+	if !reflect.DeepEqual(all, want) {
+		t.Errorf("paged listing = %v, want %v", all, want)
+	}
+
+	var l listing
+	decodeJSON(t, doJSON(t, r, http.MethodGet, "/api/projects/demo/files?dir=lib", nil), &l)
+	if want := []string{"lib/a.sw", "lib/b.sw", "lib/deep"}; !reflect.DeepEqual(paths(l), want) {
+		t.Errorf("dir=lib = %v, want %v", paths(l), want)
+	}
+	if b := l.Files[1]; b.Name != "b.sw" || b.Type != "file" || b.Size != 2 || b.Checksum != checksum("bb") || b.UpdatedAt.IsZero() {
+		t.Errorf("lib/b.sw = %+v", b)
+	}
+	if d := l.Files[2]; d.Type != "folder" || d.Checksum != "" {
+		t.Errorf("lib/deep = %+v", d)
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodGet, "/api/projects/demo/files?dir=", nil), &l)
+	if want := []string{"assets", "lib", "lib2", "main.sw"}; !reflect.DeepEqual(paths(l), want) {
+		t.Errorf("root level = %v, want %v", paths(l), want)
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodGet, "/api/projects/demo/files?prefix=lib/", nil), &l)
+	if want := []string{"lib/a.sw", "lib/b.sw", "lib/deep", "lib/deep/c.sw"}; !reflect.DeepEqual(paths(l), want) {
+		t.Errorf("prefix=lib/ = %v, want %v", paths(l), want)
+	}
+
+	for url, code := range map[string]int{
+		"/api/projects/demo/files?cursor=!!":           http.StatusBadRequest,
+		"/api/projects/demo/files?dir=../x":            http.StatusBadRequest,
+		"/api/projects/demo/files?dir=lib&prefix=lib/": http.StatusBadRequest,
+		"/api/projects/missing/files":                  http.StatusNotFound,
+	} {
+		if w := doJSON(t, r, http.MethodGet, url, nil); w.Code != code {
+			t.Errorf("GET %s = %d, want %d", url, w.Code, code)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+
+	"swalang-api-dualmode/internal/hooks"
+	"swalang-api-dualmode/internal/runner"
+)
+
+/* ============ RUN PERSISTED PROJECTS ============ */
+
+const maxRunArgs = 32
+
+type ProjectRunRequest struct {
+	Version string   `json:"version,omitempty"`
+	Ref     string   `json:"ref,omitempty"`
+	Entry   string   `json:"entry,omitempty"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// ProjectWSMessage is a client -> server message on /ws/:projectId.
+type ProjectWSMessage struct {
+	Action string `json:"action"`
+	ProjectRunRequest
+}
+
+var (
+	errInvalidVersion  = errors.New("invalid version UUID format")
+	errProjectNotFound = errors.New("project or version not found")
+)
+
+// loadProjectFiles returns the path -> content map of a stored version. The
+// latest version of a large project is read from the split rows directly so
+// the whole snapshot never has to be decoded.
+func loadProjectFiles(projectID, versionStr string) (map[string]string, error) {
+	if versionStr != "" {
+		versionUUID, err := gocql.ParseUUID(versionStr)
+		if err != nil {
+			return nil, errInvalidVersion
+		}
+		tree := loadFatWithCache(projectID, &versionUUID)
+		if tree == nil {
+			return nil, errProjectNotFound
+		}
+		return treeToFiles(tree, ""), nil
+	}
+
+	size, err := projectSize(projectID)
+	if err != nil {
+		return nil, errProjectNotFound
+	}
+	if size >= 1*1024*1024 {
+		if files, err := splitFileContents(projectID); err == nil && len(files) > 0 {
+			return files, nil
+		}
+	}
+	tree := loadFatWithCache(projectID, nil)
+	if tree == nil {
+		return nil, errProjectNotFound
+	}
+	return treeToFiles(tree, ""), nil
+}
+
+// prepareProjectRun validates a run request and loads the files to execute.
+func prepareProjectRun(projectID string, req *ProjectRunRequest) (map[string]string, int, error) {
+	if req.Entry == "" {
+		req.Entry = "main.sw"
+	}
+	entry, err := runner.ValidatePath(req.Entry, 0)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("entry: %w", err)
+	}
+	req.Entry = entry
+	if len(req.Args) > maxRunArgs {
+		return nil, http.StatusBadRequest, fmt.Errorf("at most %d args are allowed", maxRunArgs)
+	}
+
+	if req.Ref != "" {
+		if req.Version != "" {
+			return nil, http.StatusBadRequest, errors.New("use either version or ref, not both")
+		}
+		v, err := resolveRef(projectID, req.Ref)
+		if err != nil {
+			return nil, refErrorStatus(err), err
+		}
+		req.Version = v
+	}
+	files, err := loadProjectFiles(projectID, req.Version)
+	if err != nil {
+		if errors.Is(err, errInvalidVersion) {
+			return nil, http.StatusBadRequest, err
+		}
+		return nil, http.StatusNotFound, err
+	}
+	if _, ok := files[req.Entry]; !ok {
+		return nil, http.StatusBadRequest, fmt.Errorf("entry file '%s' not found in project", req.Entry)
+	}
+	return files, http.StatusOK, nil
+}
+
+func runResultMessage(projectID string, req ProjectRunRequest, outcome *RunOutcome, out *outputCapture) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "run_result",
+		"projectId":  projectID,
+		"version":    req.Version,
+		"entry":      req.Entry,
+		"exitCode":   outcome.ExitCode,
+		"durationMs": outcome.DurationMs,
+		"error":      outcome.Error,
+		"stdout":     out.stdout.String(),
+		"stderr":     out.stderr.String(),
+	}
+}
+
+// postProjectRun runs a stored version and streams output to the caller as
+// newline-delimited JSON using the same message shapes as the websockets.
+func postProjectRun(c *gin.Context) {
+	projID := c.Param("id")
+	var req ProjectRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Version == "" {
+		req.Version = c.Query("version")
+	}
+	if req.Ref == "" {
+		req.Ref = c.Query("ref")
+	}
+	files, status, err := prepareProjectRun(projID, &req)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessionHooks.Emit(hooks.Event{Type: hooks.RunStarted, ProjectID: projID, Data: map[string]interface{}{"entry": req.Entry, "version": req.Version}})
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	out := &outputCapture{}
+	outcome, err := runFiles(files, req.Entry, req.Args, func(stream, line string) {
+		out.add(stream, line)
+		enc.Encode(map[string]string{"type": stream, "content": line})
+		c.Writer.Flush()
+	})
+	if err != nil {
+		enc.Encode(map[string]string{"type": "error", "content": "failed to prepare project files: " + err.Error()})
+		emitRunFinished("", projID, req.Entry, &RunOutcome{ExitCode: -1, Error: err.Error()})
+		return
+	}
+	emitRunFinished("", projID, req.Entry, outcome)
+	enc.Encode(map[string]interface{}{"type": "exit", "exitCode": outcome.ExitCode, "durationMs": outcome.DurationMs, "error": outcome.Error})
+	broadcast(projID, runResultMessage(projID, req, outcome, out))
+}
+
+// runProjectOverWS handles the "run" action on /ws/:projectId. Output goes
+// to the requesting connection; the other viewers receive the result.
+func runProjectOverWS(conn *wsConn, projectID, connID string, req ProjectRunRequest) {
+	files, _, err := prepareProjectRun(projectID, &req)
+	if err != nil {
+		sendJSONError(conn, err.Error(), nil)
+		return
+	}
+	sessionHooks.Emit(hooks.Event{Type: hooks.RunStarted, ProjectID: projectID, Data: map[string]interface{}{"entry": req.Entry, "version": req.Version}})
+	out := &outputCapture{}
+	outcome, err := runFiles(files, req.Entry, req.Args, func(stream, line string) {
+		out.add(stream, line)
+		conn.WriteJSON(map[string]string{"type": stream, "content": line})
+	})
+	if err != nil {
+		sendJSONError(conn, "failed to prepare project files", err)
+		emitRunFinished("", projectID, req.Entry, &RunOutcome{ExitCode: -1, Error: err.Error()})
+		return
+	}
+	emitRunFinished("", projectID, req.Entry, outcome)
+	conn.WriteJSON(map[string]interface{}{"type": "exit", "exitCode": outcome.ExitCode, "durationMs": outcome.DurationMs, "error": outcome.Error})
+	msg := runResultMessage(projectID, req, outcome, out)
+	msg["by"] = connID[:8]
+	broadcastExcept(projectID, connID, msg)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// fakeSwalang installs a stand-in interpreter that prints its arguments and
+// the entry file, writes one line to stderr and exits with status 3.
+func fakeSwalang(t *testing.T) {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "swalang")
+	script := "#!/bin/sh\necho \"args: $*\"\ncat \"$1\"\necho\necho oops >&2\nexit 3\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SWALANG_PATH", bin)
+}
+
+func TestProjectRun(t *testing.T) {
+	fakeSwalang(t)
+	r := newTestRouter(t)
+	w := doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": filesToTree(map[string]string{"main.sw": "one", "lib/other.sw": "two"})})
+	var saved struct {
+		Version string `json:"version"`
+	}
+	decodeJSON(t, w, &saved)
+	doJSON(t, r, http.MethodPost, "/api/projects/demo/refs", gin.H{"name": "v1", "type": "tag"})
+	doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": filesToTree(map[string]string{"main.sw": "latest"})})
+
+	run := func(url string, body gin.H) (int, []map[string]interface{}) {
+		t.Helper()
+		w := doJSON(t, r, http.MethodPost, url, body)
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		var events []map[string]interface{}
+		sc := bufio.NewScanner(w.Body)
+		for sc.Scan() {
+			var ev map[string]interface{}
+			if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+				t.Fatalf("line %q is not JSON: %v", sc.Text(), err)
+			}
+			events = append(events, ev)
+		}
+		return w.Code, events
+	}
+	lines := func(events []map[string]interface{}, stream string) []string {
+		var out []string
+		for _, ev := range events {
+			if ev["type"] == stream {
+				out = append(out, ev["content"].(string))
+			}
+		}
+		return out
+	}
+
+	code, events := run("/api/projects/demo/run", gin.H{"args": []string{"a", "b"}})
+	if code != http.StatusOK || len(events) == 0 {
+		t.Fatalf("run latest = %d, %v", code, events)
+	}
+	if got := lines(events, "stdout"); !reflect.DeepEqual(got, []string{"args: main.sw a b", "latest"}) {
+		t.Errorf("stdout = %q", got)
+	}
+	if got := lines(events, "stderr"); !reflect.DeepEqual(got, []string{"oops"}) {
+		t.Errorf("stderr = %q", got)
+	}
+	if last := events[len(events)-1]; last["type"] != "exit" || last["exitCode"] != float64(3) {
+		t.Errorf("last event = %v, want exit with code 3", last)
+	}
+
+	for _, tc := range []struct {
+		url  string
+		body gin.H
+		want string
+	}{
+		{"/api/projects/demo/run", gin.H{"version": saved.Version}, "one"},
+		{"/api/projects/demo/run?ref=v1", nil, "one"},
+		{"/api/projects/demo/run", gin.H{"ref": "v1", "entry": "lib/other.sw"}, "two"},
+	} {
+		code, events := run(tc.url, tc.body)
+		if got := lines(events, "stdout"); code != http.StatusOK || len(got) != 2 || got[1] != tc.want {
+			t.Errorf("run %s %v = %d, stdout %q; want %q", tc.url, tc.body, code, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		url  string
+		body gin.H
+		want int
+	}{
+		{"/api/projects/demo/run", gin.H{"version": saved.Version, "ref": "v1"}, http.StatusBadRequest},
+		{"/api/projects/demo/run", gin.H{"version": "not-a-uuid"}, http.StatusBadRequest},
+		{"/api/projects/demo/run", gin.H{"version": "00000000-0000-1000-8000-000000000000"}, http.StatusNotFound},
+		{"/api/projects/demo/run", gin.H{"ref": "nope"}, http.StatusNotFound},
+		{"/api/projects/demo/run", gin.H{"entry": "../etc/passwd"}, http.StatusBadRequest},
+		{"/api/projects/demo/run", gin.H{"entry": "missing.sw"}, http.StatusBadRequest},
+		{"/api/projects/demo/run", gin.H{"args": make([]string, maxRunArgs+1)}, http.StatusBadRequest},
+		{"/api/projects/nope/run", nil, http.StatusNotFound},
+	} {
+		if code, _ := run(tc.url, tc.body); code != tc.want {
+			t.Errorf("run %s %v = %d, want %d", tc.url, tc.body, code, tc.want)
+		}
+	}
+}
+
+func TestProjectRunOverWebSocket(t *testing.T) {
+	fakeSwalang(t)
+	r := newTestRouter(t)
+	doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": filesToTree(map[string]string{"main.sw": "hello"})})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/demo", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+	read := func() map[string]interface{} {
+		t.Helper()
+		var msg map[string]interface{}
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return msg
+	}
+	if hello := read(); hello["type"] != "hello" {
+		t.Fatalf("first message = %v", hello)
+	}
+
+	ws.WriteJSON(gin.H{"action": "run", "entry": "../main.sw"})
+	if msg := read(); msg["type"] != "error" {
+		t.Errorf("run with invalid entry = %v, want error", msg)
+	}
+
+	ws.WriteJSON(gin.H{"action": "run", "args": []string{"x"}})
+	var stdout []string
+	for {
+		msg := read()
+		if msg["type"] == "stdout" {
+			stdout = append(stdout, msg["content"].(string))
+		}
+		if msg["type"] == "exit" {
+			if msg["exitCode"] != float64(3) {
+				t.Errorf("exit = %v, want code 3", msg)
+			}
+			break
+		}
+	}
+	if !reflect.DeepEqual(stdout, []string{"args: main.sw x", "hello"}) {
+		t.Errorf("stdout = %q", stdout)
+	}
+
+	ws.WriteJSON(gin.H{"action": "jump"})
+	if msg := read(); msg["type"] != "error" || !strings.Contains(msg["content"].(string), "jump") {
+		t.Errorf("unknown action = %v", msg)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* ============ PROJECT LISTING ============ */
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// listScanLimit bounds how many projects a sorted listing reads. Sorting,
+// access checks and paging happen after the read, so each such listing costs
+// a scan of every project it selects; past the limit it is refused.
+var listScanLimit = envInt("PROJECT_LIST_SCAN_LIMIT", 10000)
+
+// listScanPage is the page size of the scan behind sorted listings.
+const listScanPage = 500
+
+var errTooManyProjects = errors.New("too many projects to sort")
+
+// projectListItem is a project in a listing: its metadata without the access
+// control fields, which the collaborators endpoint serves to those allowed to
+// see them, plus the caller's own role.
+type projectListItem struct {
+	ProjectID   string     `json:"projectId"`
+	LastVersion string     `json:"lastVersion"`
+	LastSize    int        `json:"lastSize"`
+	LastUpdated time.Time  `json:"lastUpdated"`
+	FileCount   int        `json:"fileCount"`
+	DeletedAt   *time.Time `json:"deletedAt,omitempty"`
+	Role        string     `json:"role"`
+}
+
+func newProjectListItem(m ProjectMeta, role projectRole) projectListItem {
+	return projectListItem{ProjectID: m.ProjectID, LastVersion: m.LastVersion, LastSize: m.LastSize, LastUpdated: m.LastUpdated,
+		FileCount: m.FileCount, DeletedAt: m.DeletedAt, Role: role.String()}
+}
+
+var projectSorts = map[string]func(a, b ProjectMeta) bool{
+	"updated": func(a, b ProjectMeta) bool { return a.LastUpdated.Before(b.LastUpdated) },
+	"name":    func(a, b ProjectMeta) bool { return a.ProjectID < b.ProjectID },
+	"size":    func(a, b ProjectMeta) bool { return a.LastSize < b.LastSize },
+	"files":   func(a, b ProjectMeta) bool { return a.FileCount < b.FileCount },
+}
+
+// queryInt parses a non-negative integer query parameter.
+func queryInt(c *gin.Context, name string, def int) (int, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// listProjects serves GET /api/projects?prefix=&owner=&sort=updated|name|size|files
+// &order=asc|desc&limit=&offset=, or with ?cursor= the projects in storage
+// order, one page at a time. Only projects the caller can read are listed.
+// Projects in the trash are listed only, and instead of the others, with
+// ?deleted=true.
+func listProjects(c *gin.Context) {
+	q := MetaQuery{Prefix: c.Query("prefix"), Owner: c.Query("owner")}
+	if q.Owner == "me" {
+		if q.Owner = currentUser(c); q.Owner == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "owner=me requires a signed-in caller", "code": "unauthenticated"})
+			return
+		}
+	}
+	limit, ok := queryInt(c, "limit", defaultListLimit)
+	if !ok || limit == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	deleted, _ := strconv.ParseBool(c.Query("deleted"))
+	visible := func(m ProjectMeta) bool {
+		return (m.DeletedAt != nil) == deleted && callerProjectRole(c, m) >= roleViewer
+	}
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		listProjectsPage(c, q, cursor, limit, visible)
+		return
+	}
+
+	sortKey := c.DefaultQuery("sort", "updated")
+	less, ok := projectSorts[sortKey]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of updated, name, size, files"})
+		return
+	}
+	order := c.Query("order")
+	if order == "" {
+		order = "desc"
+		if sortKey == "name" {
+			order = "asc"
+		}
+	}
+	if order != "asc" && order != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+		return
+	}
+	offset, ok := queryInt(c, "offset", 0)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	all, err := scanProjects(q)
+	if errors.Is(err, errTooManyProjects) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("more than %d projects to sort; filter with owner or page with cursor", listScanLimit),
+			"code":  "too_many_projects",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	metas := all[:0]
+	for _, m := range all {
+		if visible(m) {
+			metas = append(metas, m)
+		}
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		a, b := metas[i], metas[j]
+		if order == "desc" {
+			a, b = b, a
+		}
+		if less(a, b) != less(b, a) {
+			return less(a, b)
+		}
+		return metas[i].ProjectID < metas[j].ProjectID
+	})
+
+	total := len(metas)
+	page := []projectListItem{}
+	for i := offset; i < total && i < offset+limit; i++ {
+		page = append(page, newProjectListItem(metas[i], callerProjectRole(c, metas[i])))
+	}
+	resp := gin.H{"projects": page, "total": total, "limit": limit, "offset": offset}
+	if offset+limit < total {
+		resp["nextOffset"] = offset + limit
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// scanProjects reads every project q selects, or fails with
+// errTooManyProjects once it has scanned listScanLimit of them.
+func scanProjects(q MetaQuery) ([]ProjectMeta, error) {
+	q.Limit = min(listScanPage, listScanLimit)
+	var all []ProjectMeta
+	for scanned := 0; ; scanned += q.Limit {
+		if scanned >= listScanLimit {
+			return nil, errTooManyProjects
+		}
+		metas, next, err := store.ListMeta(q)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, metas...)
+		if next == "" {
+			return all, nil
+		}
+		q.Cursor = next
+	}
+}
+
+// listProjectsPage answers a ?cursor= listing with one page of the store's
+// scan. Projects the caller cannot see are left out, so a page can hold
+// fewer than limit projects while more follow.
+func listProjectsPage(c *gin.Context, q MetaQuery, cursor string, limit int, visible func(ProjectMeta) bool) {
+	if c.Query("sort") != "" || c.Query("order") != "" || c.Query("offset") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cursor pages in storage order and cannot be combined with sort, order or offset"})
+		return
+	}
+	q.Limit, q.Cursor = limit, cursor
+	metas, next, err := store.ListMeta(q)
+	if errors.Is(err, errInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	page := []projectListItem{}
+	for _, m := range metas {
+		if visible(m) {
+			page = append(page, newProjectListItem(m, callerProjectRole(c, m)))
+		}
+	}
+	resp := gin.H{"projects": page, "limit": limit}
+	if next != "" {
+		resp["nextCursor"] = next
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+/* ============ TAGS & BRANCHES ============ */
+
+// defaultBranch is the implicit branch that project_meta, the split rows and
+// "latest" follow. It is not stored as a ref.
+const defaultBranch = "main"
+
+var refNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,99}$`)
+
+var (
+	errRefNotFound    = errors.New("ref not found")
+	errBranchNotFound = errors.New("branch not found")
+)
+
+func validRefName(name string) error {
+	if !refNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid ref name %q: use up to 100 letters, digits, '.', '_', '-' or '/'", name)
+	}
+	return nil
+}
+
+// resolveRef returns the version a tag or branch points to.
+func resolveRef(projectID, name string) (string, error) {
+	if name == defaultBranch {
+		meta, err := store.GetMeta(projectID)
+		if err != nil {
+			return "", errProjectNotFound
+		}
+		return meta.LastVersion, nil
+	}
+	r, err := store.GetRef(projectID, name)
+	if errors.Is(err, errNotFound) {
+		return "", errRefNotFound
+	}
+	return r.Version, err
+}
+
+// branchHead is resolveRef for saves: the name must be a branch, and ""
+// means the default branch.
+func branchHead(projectID, branch string) (string, error) {
+	if branch == "" || branch == defaultBranch {
+		return resolveRef(projectID, defaultBranch)
+	}
+	r, err := store.GetRef(projectID, branch)
+	if errors.Is(err, errNotFound) || (err == nil && r.Type != "branch") {
+		return "", errBranchNotFound
+	}
+	return r.Version, err
+}
+
+// queryVersion returns the version selected by ?version= or ?ref=, or ""
+// when neither is given. On failure it also returns the HTTP status.
+func queryVersion(c *gin.Context, projectID string) (string, int, error) {
+	versionStr, ref := c.Query("version"), c.Query("ref")
+	if versionStr != "" && ref != "" {
+		return "", http.StatusBadRequest, errors.New("use either version or ref, not both")
+	}
+	if ref != "" {
+		v, err := resolveRef(projectID, ref)
+		if err != nil {
+			return "", refErrorStatus(err), err
+		}
+		return v, http.StatusOK, nil
+	}
+	if versionStr != "" {
+		if _, err := gocql.ParseUUID(versionStr); err != nil {
+			return "", http.StatusBadRequest, errInvalidVersion
+		}
+	}
+	return versionStr, http.StatusOK, nil
+}
+
+// versionOrRef accepts either a version UUID or a ref name.
+func versionOrRef(projectID, s string) (gocql.UUID, error) {
+	if u, err := gocql.ParseUUID(s); err == nil {
+		return u, nil
+	}
+	v, err := resolveRef(projectID, s)
+	if err != nil {
+		return gocql.UUID{}, err
+	}
+	return gocql.ParseUUID(v)
+}
+
+func refErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errRefNotFound), errors.Is(err, errBranchNotFound), errors.Is(err, errProjectNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errInvalidVersion):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// saveToBranch stores tree as a version on a branch other than the default
+// one and advances the branch. Without a base version the save is based on
+// the head it read.
+func saveToBranch(projectID string, tree []FileSystemNode, opts SaveOptions) (VersionInfo, error) {
+	head, err := branchHead(projectID, opts.Branch)
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	base := opts.BaseVersion
+	if base == "" {
+		base = head
+	}
+	if base != head {
+		return VersionInfo{}, &ConflictError{CurrentVersion: head}
+	}
+	v, err := store.SaveVersion(projectID, tree, opts)
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	if err := store.MoveRef(projectID, opts.Branch, v.Version, base); err != nil {
+		// The unreferenced version is left for GC. The branch can have been
+		// deleted since branchHead read it.
+		if errors.Is(err, errNotFound) {
+			err = errBranchNotFound
+		}
+		return VersionInfo{}, err
+	}
+	return v, nil
+}
+
+func branchName(branch string) string {
+	if branch == "" {
+		return defaultBranch
+	}
+	return branch
+}
+
+// updateMessage is the websocket notification of a new version.
+func updateMessage(version string, size int, branch string) map[string]interface{} {
+	return map[string]interface{}{"type": "update", "version": version, "size": size, "branch": branchName(branch)}
+}
+
+/* ---------- Ref Handlers ---------- */
+
+type CreateRefRequest struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Version string `json:"version,omitempty"`
+	Ref     string `json:"ref,omitempty"` // start from this tag or branch instead
+}
+
+// getRefs serves GET /api/projects/:id/refs. The default branch is listed
+// first.
+func getRefs(c *gin.Context) {
+	projID := c.Param("id")
+	meta, err := store.GetMeta(projID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	refs, err := store.ListRefs(projID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	head := Ref{Name: defaultBranch, Type: "branch", Version: meta.LastVersion, UpdatedAt: meta.LastUpdated}
+	c.JSON(http.StatusOK, gin.H{"projectId": projID, "refs": append([]Ref{head}, refs...)})
+}
+
+// postRef serves POST /api/projects/:id/refs. The new ref points at
+// version, at what ref points to, or at the latest version.
+func postRef(c *gin.Context) {
+	projID := c.Param("id")
+	var req CreateRefRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validRefName(req.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Type != "tag" && req.Type != "branch" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `type must be "tag" or "branch"`})
+		return
+	}
+	if req.Version != "" && req.Ref != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "use either version or ref, not both"})
+		return
+	}
+	if req.Name == defaultBranch {
+		c.JSON(http.StatusConflict, gin.H{"error": errRefExists.Error(), "name": req.Name})
+		return
+	}
+
+	source := req.Ref
+	if req.Version == "" && source == "" {
+		source = defaultBranch
+	}
+	version := req.Version
+	if source != "" {
+		v, err := resolveRef(projID, source)
+		if err != nil {
+			c.JSON(refErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		version = v
+	}
+	versionUUID, err := gocql.ParseUUID(version)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidVersion.Error()})
+		return
+	}
+	if loadFatWithCache(projID, &versionUUID) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errProjectNotFound.Error()})
+		return
+	}
+
+	ref := Ref{Name: req.Name, Type: req.Type, Version: versionUUID.String(), UpdatedAt: time.Now()}
+	if err := store.CreateRef(projID, ref); err != nil {
+		if errors.Is(err, errRefExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "name": req.Name})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, ref)
+}
+
+// deleteRef serves DELETE /api/projects/:id/refs/*name. The versions stay
+// until retention removes them.
+func deleteRef(c *gin.Context) {
+	projID := c.Param("id")
+	name := c.Param("name")[1:]
+	if name == defaultBranch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the default branch cannot be deleted"})
+		return
+	}
+	if err := store.DeleteRef(projID, name); err != nil {
+		if errors.Is(err, errNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": errRefNotFound.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
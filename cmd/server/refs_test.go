@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTagsAndBranches(t *testing.T) {
+	r := newTestRouter(t)
+	save := func(url string, body gin.H) string {
+		t.Helper()
+		w := doJSON(t, r, http.MethodPost, url, body)
+		var saved struct {
+			Version string `json:"version"`
+		}
+		decodeJSON(t, w, &saved)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("save to %s = %d %s", url, w.Code, w.Body)
+		}
+		return saved.Version
+	}
+	v1 := save("/api/projects/demo", gin.H{"tree": filesToTree(map[string]string{"main.sw": "one"})})
+
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo/refs", gin.H{"name": "lesson-3-solution", "type": "tag"}); w.Code != http.StatusCreated {
+		t.Fatalf("create tag = %d %s", w.Code, w.Body)
+	}
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo/refs", gin.H{"name": "experiment", "type": "branch", "ref": "lesson-3-solution"}); w.Code != http.StatusCreated {
+		t.Fatalf("create branch = %d %s", w.Code, w.Body)
+	}
+	for _, body := range []gin.H{
+		{"name": "lesson-3-solution", "type": "tag"},
+		{"name": "main", "type": "branch"},
+	} {
+		if w := doJSON(t, r, http.MethodPost, "/api/projects/demo/refs", body); w.Code != http.StatusConflict {
+			t.Errorf("create existing ref %v = %d, want 409", body["name"], w.Code)
+		}
+	}
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo/refs", gin.H{"name": "bad name", "type": "tag"}); w.Code != http.StatusBadRequest {
+		t.Errorf("create ref with invalid name = %d, want 400", w.Code)
+	}
+
+	// Saves to the branch leave main alone; saves to main leave the tag alone.
+	b1 := save("/api/projects/demo?branch=experiment", gin.H{"tree": filesToTree(map[string]string{"main.sw": "experiment"})})
+	v2 := save("/api/projects/demo", gin.H{"tree": filesToTree(map[string]string{"main.sw": "two"})})
+	if meta, _ := store.GetMeta("demo"); meta.LastVersion != v2 {
+		t.Errorf("main = %s, want %s", meta.LastVersion, v2)
+	}
+	if files, _ := splitFileContents("demo"); files["main.sw"] != "two" {
+		t.Errorf("split rows after branch save = %v", files)
+	}
+
+	contentAt := func(query string) string {
+		t.Helper()
+		w := doJSON(t, r, http.MethodGet, "/api/projects/demo/files/main.sw?"+query, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET file ?%s = %d %s", query, w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+	for query, want := range map[string]string{
+		"ref=lesson-3-solution": "one",
+		"ref=experiment":        "experiment",
+		"ref=main":              "two",
+		"version=" + b1:         "experiment",
+	} {
+		if got := contentAt(query); got != want {
+			t.Errorf("file at ?%s = %q, want %q", query, got, want)
+		}
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/projects/demo?ref=nope", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET unknown ref = %d, want 404", w.Code)
+	}
+
+	// The branch head is the base for conditional saves to the branch.
+	w := doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree(), "branch": "experiment", "baseVersion": v1})
+	if w.Code != http.StatusConflict {
+		t.Errorf("stale branch save = %d %s", w.Code, w.Body)
+	}
+	w = doJSON(t, r, http.MethodPatch, "/api/projects/demo", gin.H{"branch": "experiment", "ops": []PatchOp{{Op: "put", Path: "extra.sw", Content: "x"}}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch branch = %d %s", w.Code, w.Body)
+	}
+	if got := contentAt("ref=experiment"); got != "experiment" {
+		t.Errorf("branch main.sw after patch = %q", got)
+	}
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo?branch=lesson-3-solution", gin.H{"tree": sampleTree()}); w.Code != http.StatusNotFound {
+		t.Errorf("save to tag = %d, want 404", w.Code)
+	}
+
+	w = doJSON(t, r, http.MethodGet, "/api/projects/demo/diff?from=lesson-3-solution&to=experiment&summary=true", nil)
+	var d struct {
+		From    string      `json:"from"`
+		Summary DiffSummary `json:"summary"`
+	}
+	decodeJSON(t, w, &d)
+	if w.Code != http.StatusOK || d.From != v1 || d.Summary.Added != 1 || d.Summary.Modified != 1 {
+		t.Errorf("diff between refs = %d %s", w.Code, w.Body)
+	}
+
+	var listed struct {
+		Refs []Ref `json:"refs"`
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodGet, "/api/projects/demo/refs", nil), &listed)
+	var names []string
+	for _, ref := range listed.Refs {
+		names = append(names, ref.Name)
+	}
+	if want := []string{"main", "experiment", "lesson-3-solution"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("refs = %v, want %v", names, want)
+	}
+
+	// Retention keeps what refs point to.
+	store.SetRetention("demo", &RetentionPolicy{KeepLast: 1})
+	if _, err := collectGarbage("demo", false); err != nil {
+		t.Fatalf("collectGarbage() error = %v", err)
+	}
+	if got := contentAt("ref=lesson-3-solution"); got != "one" {
+		t.Errorf("tagged version after GC = %q", got)
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/projects/demo?version="+b1, nil); w.Code != http.StatusNotFound {
+		t.Errorf("old branch version after GC = %d, want 404", w.Code)
+	}
+
+	if w := doJSON(t, r, http.MethodDelete, "/api/projects/demo/refs/experiment", nil); w.Code != http.StatusNoContent {
+		t.Errorf("delete branch = %d", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodDelete, "/api/projects/demo/refs/experiment", nil); w.Code != http.StatusNotFound {
+		t.Errorf("delete deleted branch = %d, want 404", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodDelete, "/api/projects/demo/refs/main", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("delete main = %d, want 400", w.Code)
+	}
+}
+
+func TestLocalStoreRefs(t *testing.T) {
+	s, err := newLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("newLocalStore() error = %v", err)
+	}
+	meta, _ := s.SaveSnapshot("p", sampleTree(), SaveOptions{})
+	if err := s.CreateRef("p", Ref{Name: "dev", Type: "branch", Version: meta.LastVersion}); err != nil {
+		t.Fatalf("CreateRef() error = %v", err)
+	}
+	if err := s.CreateRef("p", Ref{Name: "dev", Type: "tag", Version: meta.LastVersion}); !errors.Is(err, errRefExists) {
+		t.Errorf("CreateRef(existing) error = %v, want errRefExists", err)
+	}
+
+	v, err := s.SaveVersion("p", filesToTree(map[string]string{"main.sw": "dev"}), SaveOptions{Branch: "dev"})
+	if err != nil {
+		t.Fatalf("SaveVersion() error = %v", err)
+	}
+	if err := s.MoveRef("p", "dev", v.Version, meta.LastVersion); err != nil {
+		t.Fatalf("MoveRef() error = %v", err)
+	}
+	var conflict *ConflictError
+	if err := s.MoveRef("p", "dev", meta.LastVersion, meta.LastVersion); !errors.As(err, &conflict) || conflict.CurrentVersion != v.Version {
+		t.Errorf("MoveRef(stale) error = %v", err)
+	}
+
+	// The branch version is the newest, but latest still means main.
+	tree, err := s.LoadSnapshot("p", nil)
+	if err != nil || !reflect.DeepEqual(treeToFiles(tree, ""), treeToFiles(sampleTree(), "")) {
+		t.Errorf("LoadSnapshot(latest) = %v, %v", treeToFiles(tree, ""), err)
+	}
+	if m, _ := s.GetMeta("p"); m.LastVersion != meta.LastVersion {
+		t.Errorf("meta moved to %s by a branch save", m.LastVersion)
+	}
+	versions, _, _ := s.ListVersions("p", 10, "")
+	if len(versions) != 2 || versions[0].Branch != "dev" {
+		t.Errorf("versions = %+v", versions)
+	}
+
+	if err := s.DeleteRef("p", "dev"); err != nil {
+		t.Fatalf("DeleteRef() error = %v", err)
+	}
+	if _, err := s.GetRef("p", "dev"); !errors.Is(err, errNotFound) {
+		t.Errorf("GetRef(deleted) error = %v, want errNotFound", err)
+	}
+}
+
+// racingDeleteStore deletes a ref just before moving it, like a concurrent
+// DELETE landing between the branch lookup and the move.
+type racingDeleteStore struct{ ProjectStore }
+
+func (s racingDeleteStore) MoveRef(projectID, name, version, expected string) error {
+	s.ProjectStore.DeleteRef(projectID, name)
+	return s.ProjectStore.MoveRef(projectID, name, version, expected)
+}
+
+func TestSaveToDeletedBranch(t *testing.T) {
+	r := newTestRouter(t)
+	doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree()})
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo/refs", gin.H{"name": "dev", "type": "branch"}); w.Code != http.StatusCreated {
+		t.Fatalf("create branch = %d %s", w.Code, w.Body)
+	}
+	store = racingDeleteStore{store}
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo?branch=dev", gin.H{"tree": sampleTree()}); w.Code != http.StatusNotFound {
+		t.Errorf("save to a branch deleted meanwhile = %d %s, want 404", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+)
+
+/* ============ SPLIT ROW REPAIR ============ */
+
+// Older servers only ever inserted split rows, so deleted and renamed files
+// lingered in project_files. repair-splits reconciles the split rows of
+// existing projects with their latest snapshot, and rewrites rows that
+// predate the size and parent columns:
+//
+//	server repair-splits [-prefix p] [projectID ...]
+//
+// Without project IDs every project matching prefix is repaired.
+func runRepairCommand(args []string) error {
+	fs := flag.NewFlagSet("repair-splits", flag.ContinueOnError)
+	prefix := fs.String("prefix", "", "only repair projects whose ID starts with this prefix")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if store == nil {
+		return fmt.Errorf("no project store configured")
+	}
+	ids := fs.Args()
+	if len(ids) == 0 {
+		metas, _, err := store.ListMeta(MetaQuery{Prefix: *prefix})
+		if err != nil {
+			return err
+		}
+		for _, m := range metas {
+			ids = append(ids, m.ProjectID)
+		}
+		sort.Strings(ids)
+	}
+	written, deleted, failed := repairSplitRows(ids)
+	log.Printf("🔧 Repaired %d projects: %d rows written, %d stale rows deleted, %d failures", len(ids)-failed, written, deleted, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d projects could not be repaired", failed)
+	}
+	return nil
+}
+
+func repairSplitRows(projectIDs []string) (written, deleted, failed int) {
+	for _, id := range projectIDs {
+		tree, err := store.LoadSnapshot(id, nil)
+		if err != nil {
+			log.Printf("❌ %s: failed to load latest snapshot: %v", id, err)
+			failed++
+			continue
+		}
+		w, d, err := store.SyncFiles(id, tree)
+		if err != nil {
+			log.Printf("❌ %s: failed to sync split rows: %v", id, err)
+			failed++
+			continue
+		}
+		if w > 0 || d > 0 {
+			log.Printf("🔧 %s: %d rows written, %d stale rows deleted", id, w, d)
+		}
+		written += w
+		deleted += d
+	}
+	return written, deleted, failed
+}
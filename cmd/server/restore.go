@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+
+	"swalang-api-dualmode/internal/runner"
+)
+
+/* ============ RESTORE / ROLLBACK ============ */
+
+type RestoreRequest struct {
+	Version string   `json:"version,omitempty"`
+	Ref     string   `json:"ref,omitempty"`
+	Paths   []string `json:"paths,omitempty"`
+	Author  string   `json:"author,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
+
+// restoreTree builds the tree of the restored version. Without paths it is
+// the old snapshot itself; otherwise each path (file or folder) of the
+// current tree is replaced by its old counterpart, or removed when it did not
+// exist in the old version.
+func restoreTree(current, old []FileSystemNode, paths []string) ([]FileSystemNode, error) {
+	if len(paths) == 0 {
+		return old, nil
+	}
+	tree := current
+	for _, raw := range paths {
+		p, err := runner.ValidatePath(raw, 0)
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %w", raw, err)
+		}
+		oldNode := findNode(old, p)
+		var removed bool
+		tree, removed = removeNode(tree, p)
+		if oldNode == nil {
+			if !removed {
+				return nil, fmt.Errorf("path %q exists in neither version", p)
+			}
+			continue
+		}
+		tree = putNode(tree, p, *oldNode)
+	}
+	return tree, nil
+}
+
+// postRestore serves POST /api/projects/:id/restore. The old version is
+// written as a new version, so history is never rewritten.
+func postRestore(c *gin.Context) {
+	projID := c.Param("id")
+	var req RestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Version == "" && req.Ref != "" {
+		v, err := resolveRef(projID, req.Ref)
+		if err != nil {
+			c.JSON(refErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		req.Version = v
+	}
+	versionUUID, err := gocql.ParseUUID(req.Version)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidVersion.Error()})
+		return
+	}
+	old := loadFatWithCache(projID, &versionUUID)
+	if old == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errProjectNotFound.Error()})
+		return
+	}
+	var current []FileSystemNode
+	if len(req.Paths) > 0 {
+		if current = loadFat(projID, nil); current == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": errProjectNotFound.Error()})
+			return
+		}
+	}
+	tree, err := restoreTree(current, old, req.Paths)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Message == "" {
+		req.Message = "Restore " + versionUUID.String()
+	}
+	base := baseVersionOf(c, "")
+	version, size, err := saveHybrid(projID, tree, SaveOptions{Author: saveAuthor(c, req.Author), Message: req.Message, BaseVersion: base})
+	if err != nil {
+		respondSaveError(c, projID, base, err)
+		return
+	}
+	msg := map[string]interface{}{"type": "update", "version": version, "size": size, "restoredFrom": versionUUID.String()}
+	if len(req.Paths) > 0 {
+		msg["paths"] = req.Paths
+	}
+	broadcast(projID, msg)
+	c.JSON(http.StatusCreated, gin.H{"projectId": projID, "version": version, "size": size, "restoredFrom": versionUUID.String()})
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+/* ============ RETENTION & GARBAGE COLLECTION ============ */
+
+// RetentionPolicy decides which versions of a project survive GC. A version
+// is kept if any rule keeps it; the latest version and the versions tags and
+// branches point to are always kept. A policy with no rules keeps
+// everything.
+type RetentionPolicy struct {
+	KeepLast      int `json:"keepLast,omitempty"`      // the newest N versions
+	KeepDailyDays int `json:"keepDailyDays,omitempty"` // the newest version of each UTC day it was saved on, for this many days
+}
+
+func (p RetentionPolicy) keepsAll() bool {
+	return p.KeepLast <= 0 && p.KeepDailyDays <= 0
+}
+
+// defaultRetention applies to projects without a policy of their own.
+var defaultRetention = RetentionPolicy{
+	KeepLast:      envInt("RETENTION_KEEP_LAST", 0),
+	KeepDailyDays: envInt("RETENTION_KEEP_DAILY_DAYS", 0),
+}
+
+// planRetention splits versions (newest first) into those a policy keeps and
+// those it drops. Versions in protected are always kept.
+func planRetention(versions []VersionInfo, p RetentionPolicy, now time.Time, protected map[string]bool) (keep, drop []VersionInfo) {
+	if p.keepsAll() {
+		return versions, nil
+	}
+	cutoff := now.AddDate(0, 0, -p.KeepDailyDays)
+	days := make(map[string]bool)
+	for i, v := range versions {
+		kept := i == 0 || i < p.KeepLast || protected[v.Version]
+		if at := storedAt(v); p.KeepDailyDays > 0 && at.After(cutoff) {
+			day := at.UTC().Format("2006-01-02")
+			if !days[day] {
+				days[day] = true
+				kept = true
+			}
+		}
+		if kept {
+			keep = append(keep, v)
+		} else {
+			drop = append(drop, v)
+		}
+	}
+	return keep, drop
+}
+
+// storedAt is when a version was saved, the time of its timeuuid. Its
+// Timestamp can be far older: an imported commit keeps its author time.
+func storedAt(v VersionInfo) time.Time {
+	if u, err := gocql.ParseUUID(v.Version); err == nil && u.Version() == 1 {
+		return u.Time()
+	}
+	return v.Timestamp
+}
+
+// GCReport describes one project's collection, or what it would collect in
+// a dry run.
+type GCReport struct {
+	ProjectID       string          `json:"projectId"`
+	Policy          RetentionPolicy `json:"policy"`
+	Kept            int             `json:"kept"`
+	DeletedVersions []string        `json:"deletedVersions"`
+	DeletedBlobs    BlobStats       `json:"deletedBlobs"`
+	Purged          bool            `json:"purged,omitempty"` // project left the trash for good
+}
+
+func allVersions(projectID string) ([]VersionInfo, error) {
+	var all []VersionInfo
+	cursor := ""
+	for {
+		page, next, err := store.ListVersions(projectID, maxListLimit, cursor)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if next == "" || len(page) == 0 {
+			return all, nil
+		}
+		cursor = next
+	}
+}
+
+// effectiveRetention returns the project's own policy or the default.
+func effectiveRetention(projectID string) (RetentionPolicy, error) {
+	p, err := store.GetRetention(projectID)
+	if err != nil {
+		return RetentionPolicy{}, err
+	}
+	if p == nil {
+		return defaultRetention, nil
+	}
+	return *p, nil
+}
+
+// refTargets returns the versions that tags and branches, including the
+// default branch, point to.
+func refTargets(projectID string) (map[string]bool, error) {
+	meta, err := store.GetMeta(projectID)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := store.ListRefs(projectID)
+	if err != nil {
+		return nil, err
+	}
+	targets := map[string]bool{meta.LastVersion: true}
+	for _, r := range refs {
+		targets[r.Version] = true
+	}
+	return targets, nil
+}
+
+// collectProject applies the retention policy of one project and prunes the
+// blobs no remaining version references. A project that has been in the
+// trash for longer than RETENTION_TRASH_DAYS is purged instead.
+func collectProject(projectID string, dryRun bool) (GCReport, error) {
+	report := GCReport{ProjectID: projectID, DeletedVersions: []string{}}
+	if meta, err := store.GetMeta(projectID); err == nil {
+		if report.Purged, err = purgeExpired(meta, time.Now(), dryRun); report.Purged || err != nil {
+			return report, err
+		}
+	}
+	policy, err := effectiveRetention(projectID)
+	if err != nil {
+		return report, err
+	}
+	report.Policy = policy
+	versions, err := allVersions(projectID)
+	if err != nil {
+		return report, err
+	}
+	protected, err := refTargets(projectID)
+	if err != nil {
+		return report, err
+	}
+	keep, drop := planRetention(versions, policy, time.Now(), protected)
+	report.Kept = len(keep)
+	for _, v := range drop {
+		report.DeletedVersions = append(report.DeletedVersions, v.Version)
+	}
+	if !dryRun && len(drop) > 0 {
+		if err := store.DeleteVersions(projectID, report.DeletedVersions); err != nil {
+			return report, err
+		}
+		for _, v := range report.DeletedVersions {
+			snapshotCache.Delete(projectID + "@" + v)
+		}
+	}
+	report.DeletedBlobs, err = store.PruneBlobs(projectID, report.DeletedVersions, dryRun)
+	return report, err
+}
+
+// collectGarbage runs collectProject for one project, or for all of them
+// when projectID is empty.
+func collectGarbage(projectID string, dryRun bool) ([]GCReport, error) {
+	ids := []string{projectID}
+	if projectID == "" {
+		metas, _, err := store.ListMeta(MetaQuery{})
+		if err != nil {
+			return nil, err
+		}
+		ids = ids[:0]
+		for _, m := range metas {
+			ids = append(ids, m.ProjectID)
+		}
+	}
+	reports := []GCReport{}
+	for _, id := range ids {
+		r, err := collectProject(id, dryRun)
+		if err != nil {
+			if projectID != "" {
+				return nil, err
+			}
+			log.Printf("❌ GC of project %s failed: %v", id, err)
+			continue
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+// startRetentionGC collects garbage every RETENTION_GC_INTERVAL (a Go
+// duration such as "24h"). GC is off when the variable is unset.
+func startRetentionGC() {
+	v := os.Getenv("RETENTION_GC_INTERVAL")
+	if v == "" || store == nil {
+		return
+	}
+	interval, err := time.ParseDuration(v)
+	if err != nil || interval <= 0 {
+		log.Printf("⚠️  Ignoring invalid RETENTION_GC_INTERVAL=%q", v)
+		return
+	}
+	log.Printf("🧹 Version GC every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			reports, err := collectGarbage("", false)
+			if err != nil {
+				log.Printf("❌ GC failed: %v", err)
+				continue
+			}
+			versions, blobs := 0, 0
+			for _, r := range reports {
+				versions += len(r.DeletedVersions)
+				blobs += r.DeletedBlobs.Count
+			}
+			log.Printf("🧹 GC removed %d versions and %d blobs across %d projects", versions, blobs, len(reports))
+		}
+	}()
+}
+
+/* ---------- Admin & Retention Handlers ---------- */
+
+// adminGC serves GET /api/admin/gc (always a dry run) and POST /api/admin/gc
+// (a dry run only with ?dryRun=true). ?project= limits it to one project.
+func adminGC(c *gin.Context) {
+	dryRun := c.Request.Method == http.MethodGet
+	if v := c.Query("dryRun"); v != "" && !dryRun {
+		dryRun, _ = strconv.ParseBool(v)
+	}
+	reports, err := collectGarbage(c.Query("project"), dryRun)
+	if errors.Is(err, errNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dryRun": dryRun, "projects": reports})
+}
+
+// getRetention serves GET /api/projects/:id/retention.
+func getRetention(c *gin.Context) {
+	projID := c.Param("id")
+	if _, err := store.GetMeta(projID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	p, err := store.GetRetention(projID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if p == nil {
+		c.JSON(http.StatusOK, gin.H{"projectId": projID, "policy": defaultRetention, "default": true})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"projectId": projID, "policy": p, "default": false})
+}
+
+// putRetention serves PUT /api/projects/:id/retention. An empty body object
+// keeps every version; DELETE reverts to the server default.
+func putRetention(c *gin.Context) {
+	projID := c.Param("id")
+	if _, err := store.GetMeta(projID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	var stored *RetentionPolicy
+	if c.Request.Method != http.MethodDelete {
+		var p RetentionPolicy
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if p.KeepLast < 0 || p.KeepDailyDays < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("retention values must not be negative: %+v", p)})
+			return
+		}
+		stored = &p
+	}
+	if err := store.SetRetention(projID, stored); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	getRetention(c)
+}
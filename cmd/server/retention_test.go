@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+func TestPlanRetention(t *testing.T) {
+	now := time.Date(2025, 6, 30, 12, 0, 0, 0, time.UTC)
+	var versions []VersionInfo
+	// Two versions a day for ten days, newest first.
+	for i := 0; i < 20; i++ {
+		versions = append(versions, VersionInfo{Version: fmt.Sprint(i), Timestamp: now.Add(-time.Duration(i) * 12 * time.Hour)})
+	}
+	ids := func(vs []VersionInfo) []string {
+		var out []string
+		for _, v := range vs {
+			out = append(out, v.Version)
+		}
+		return out
+	}
+
+	if keep, drop := planRetention(versions, RetentionPolicy{}, now, nil); len(keep) != 20 || drop != nil {
+		t.Errorf("empty policy dropped %v", ids(drop))
+	}
+	keep, _ := planRetention(versions, RetentionPolicy{KeepLast: 3}, now, map[string]bool{"15": true})
+	if got := fmt.Sprint(ids(keep)); got != "[0 1 2 15]" {
+		t.Errorf("KeepLast=3 kept %s", got)
+	}
+	keep, _ = planRetention(versions, RetentionPolicy{KeepDailyDays: 3}, now, nil)
+	if got := fmt.Sprint(ids(keep)); got != "[0 2 4]" {
+		t.Errorf("KeepDailyDays=3 kept %s", got)
+	}
+	keep, _ = planRetention(versions, RetentionPolicy{KeepLast: 2, KeepDailyDays: 2}, now, nil)
+	if got := fmt.Sprint(ids(keep)); got != "[0 1 2]" {
+		t.Errorf("combined policy kept %s", got)
+	}
+
+	// Imported versions carry their commit times; they count by the day
+	// they were saved on, so recent imports are not collected as old.
+	var imported []VersionInfo
+	for i := 0; i < 4; i++ {
+		saved := now.AddDate(0, 0, -i)
+		imported = append(imported, VersionInfo{Version: gocql.UUIDFromTime(saved).String(), Timestamp: saved.AddDate(-2, 0, -i)})
+	}
+	keep, drop := planRetention(imported, RetentionPolicy{KeepDailyDays: 3}, now, nil)
+	if len(keep) != 3 || len(drop) != 1 || drop[0].Version != imported[3].Version {
+		t.Errorf("KeepDailyDays=3 on an import kept %v, dropped %v", ids(keep), ids(drop))
+	}
+	old := VersionInfo{Version: gocql.UUIDFromTime(now.AddDate(0, 0, -5)).String(), Timestamp: now}
+	if keep, _ := planRetention(append(imported[:1:1], old), RetentionPolicy{KeepDailyDays: 3}, now, nil); len(keep) != 1 {
+		t.Errorf("KeepDailyDays=3 kept a version saved 5 days ago with a recent timestamp")
+	}
+}
+
+func TestRetentionGC(t *testing.T) {
+	r := newTestRouter(t)
+	t.Setenv("ADMIN_TOKEN", "secret")
+	admin := http.Header{"Authorization": {"Bearer secret"}}
+	for i := 0; i < 5; i++ {
+		doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": filesToTree(map[string]string{"main.sw": fmt.Sprint("v", i), "lib.sw": "shared"})})
+	}
+	if w := doJSON(t, r, http.MethodPut, "/api/projects/demo/retention", gin.H{"keepLast": 2}); w.Code != http.StatusOK {
+		t.Fatalf("PUT retention = %d %s", w.Code, w.Body)
+	}
+
+	if w := doJSON(t, r, http.MethodGet, "/api/admin/gc", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("GC without token = %d, want 401", w.Code)
+	}
+	var res struct {
+		DryRun   bool       `json:"dryRun"`
+		Projects []GCReport `json:"projects"`
+	}
+	w := doJSONWithHeader(t, r, http.MethodGet, "/api/admin/gc?project=demo", nil, admin)
+	decodeJSON(t, w, &res)
+	if !res.DryRun || len(res.Projects) != 1 || len(res.Projects[0].DeletedVersions) != 3 || res.Projects[0].DeletedBlobs.Count != 3 {
+		t.Fatalf("dry run = %d %s", w.Code, w.Body)
+	}
+	if vs, _ := allVersions("demo"); len(vs) != 5 {
+		t.Errorf("dry run deleted versions: %d left", len(vs))
+	}
+
+	w = doJSONWithHeader(t, r, http.MethodPost, "/api/admin/gc", nil, admin)
+	decodeJSON(t, w, &res)
+	if res.DryRun || len(res.Projects) != 1 || len(res.Projects[0].DeletedVersions) != 3 {
+		t.Fatalf("GC = %d %s", w.Code, w.Body)
+	}
+	vs, _ := allVersions("demo")
+	if len(vs) != 2 {
+		t.Errorf("%d versions after GC, want 2", len(vs))
+	}
+	for _, v := range vs {
+		if tree := loadFat("demo", mustUUID(t, v.Version)); treeToFiles(tree, "")["lib.sw"] != "shared" {
+			t.Errorf("version %s lost its blobs", v.Version)
+		}
+	}
+	if stats, _ := store.PruneBlobs("demo", nil, true); stats.Count != 0 {
+		t.Errorf("%d unreferenced blobs left", stats.Count)
+	}
+}
+
+func mustUUID(t *testing.T, s string) *gocql.UUID {
+	t.Helper()
+	u, err := gocql.ParseUUID(s)
+	if err != nil {
+		t.Fatalf("ParseUUID(%q): %v", s, err)
+	}
+	return &u
+}
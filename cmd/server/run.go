@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"swalang-api-dualmode/internal/runner"
+)
+
+/* ---------- Sandboxed Execution ---------- */
+
+const (
+	runTimeout = 15 * time.Second
+
+	// Output kept per stream when a run result is broadcast to viewers.
+	maxBroadcastOutput = 64 * 1024
+)
+
+type RunOutcome struct {
+	ExitCode   int    `json:"exitCode"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// wsConn serialises writes to a websocket connection; gorilla supports only
+// one concurrent writer per connection.
+type wsConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
+
+func (w *wsConn) WriteJSON(v interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Conn.WriteJSON(v)
+}
+
+func (w *wsConn) WriteMessage(messageType int, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Conn.WriteMessage(messageType, data)
+}
+
+func swalangBinary() string {
+	if p := os.Getenv("SWALANG_PATH"); p != "" {
+		return p
+	}
+	return "/usr/local/bin/swalang"
+}
+
+// runFiles writes files into a fresh sandbox and runs entry with args,
+// passing every output line to emit. The returned error covers sandbox
+// preparation only; failures of the program itself are reported in the
+// outcome.
+func runFiles(files map[string]string, entry string, args []string, emit func(stream, line string)) (*RunOutcome, error) {
+	dir, err := runner.CreateSandbox(os.TempDir())
+	if err != nil {
+		return nil, err
+	}
+	defer runner.CleanupSandbox(dir)
+
+	if err := runner.WriteFiles(dir, files); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err = runner.StreamSwalang(ctx, swalangBinary(), dir, entry, args, emit)
+	outcome := &RunOutcome{ExitCode: runner.ExitCode(err), DurationMs: time.Since(start).Milliseconds()}
+	if ctx.Err() == context.DeadlineExceeded {
+		outcome.Error = "execution timed out"
+	} else if err != nil && outcome.ExitCode == -1 {
+		outcome.Error = err.Error()
+	}
+	return outcome, nil
+}
+
+// outputCapture keeps the head of each stream for run result broadcasts.
+type outputCapture struct {
+	stdout, stderr strings.Builder
+}
+
+func (o *outputCapture) add(stream, line string) {
+	b := &o.stdout
+	if stream == "stderr" {
+		b = &o.stderr
+	}
+	if b.Len()+len(line)+1 > maxBroadcastOutput {
+		return
+	}
+	b.WriteString(line)
+	b.WriteByte('\n')
+}
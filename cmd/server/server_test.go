@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter wires the full API against a fresh local project store.
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	s, err := newLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("newLocalStore() error = %v", err)
+	}
+	store = s
+	snapshotCache = &sync.Map{}
+	embedder = &MockEmbedder{}
+	t.Cleanup(func() { store, trustUserHeader = nil, false })
+	return newRouter()
+}
+
+// trustUsers lets a test name its users with X-User-ID, as a trusted proxy
+// would. The API then tells users apart, so anonymous callers can no longer
+// create projects.
+func trustUsers(t *testing.T) {
+	trustUserHeader = true
+	t.Cleanup(func() { trustUserHeader = false })
+}
+
+func doJSON(t *testing.T, r http.Handler, method, url string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return doJSONWithHeader(t, r, method, url, body, nil)
+}
+
+func doJSONWithHeader(t *testing.T, r http.Handler, method, url string, body interface{}, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, url, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestProjectAPIWithLocalStore(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree()})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /api/projects/demo = %d %s", w.Code, w.Body)
+	}
+	var saved struct {
+		Version string `json:"version"`
+		Size    int    `json:"size"`
+	}
+	decodeJSON(t, w, &saved)
+
+	w = doJSON(t, r, http.MethodGet, "/api/projects/demo", nil)
+	var got struct {
+		Strategy string           `json:"strategy"`
+		Size     int              `json:"size"`
+		Tree     []FileSystemNode `json:"tree"`
+	}
+	decodeJSON(t, w, &got)
+	if w.Code != http.StatusOK || got.Strategy != "fat" || got.Size != saved.Size || len(got.Tree) != 2 {
+		t.Errorf("GET /api/projects/demo = %d %+v", w.Code, got)
+	}
+
+	w = doJSON(t, r, http.MethodGet, "/api/projects/demo/files/lib/util.sw", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "kazi util() {}" {
+		t.Errorf("GET split file = %d %q", w.Code, w.Body)
+	}
+	w = doJSON(t, r, http.MethodGet, "/api/projects/demo/files/main.sw?version="+saved.Version, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "andika(\"hello\")" {
+		t.Errorf("GET versioned file = %d %q", w.Code, w.Body)
+	}
+
+	w = doJSON(t, r, http.MethodGet, "/api/projects/missing", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET missing project = %d, want 404", w.Code)
+	}
+}
+
+func TestIndexAndSearchWithLocalStore(t *testing.T) {
+	r := newTestRouter(t)
+	doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree()})
+
+	// Index synchronously; the HTTP handler only starts the same job.
+	indexJobs.Store("job", &IndexJob{JobID: "job", ProjectID: "demo"})
+	runIndex("job", "demo")
+
+	w := doJSON(t, r, http.MethodPost, "/api/search/similar", SimilarityQuery{ProjectID: "demo", FilePath: "main.sw", Limit: 5})
+	var res struct {
+		Results []SimilarResult `json:"results"`
+	}
+	decodeJSON(t, w, &res)
+	if w.Code != http.StatusOK || len(res.Results) != 2 || res.Results[0].Path != "main.sw" {
+		t.Errorf("POST /api/search/similar = %d %+v", w.Code, res)
+	}
+}
+
+func TestListProjects(t *testing.T) {
+	r := newTestRouter(t)
+	trustUsers(t)
+	teacher := http.Header{"X-User-Id": {"teacher"}}
+	doJSONWithHeader(t, r, http.MethodPost, "/api/projects/lesson-1", gin.H{"tree": sampleTree()}, teacher)
+	// Projects saved before access control have no owner.
+	store.SaveSnapshot("lesson-2", filesToTree(map[string]string{"main.sw": "x"}), SaveOptions{})
+	store.SaveSnapshot("other", sampleTree(), SaveOptions{})
+	// Anonymous callers cannot create projects, or name their owner.
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/anon", gin.H{"tree": sampleTree(), "owner": "mallory"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous create = %d %s, want 401", w.Code, w.Body)
+	}
+	// A later save must not replace the recorded owner, and no one but an
+	// API admin may change a project that has none.
+	doJSONWithHeader(t, r, http.MethodPost, "/api/projects/lesson-1", gin.H{"tree": sampleTree(), "owner": "someone-else"}, teacher)
+	if w := doJSONWithHeader(t, r, http.MethodPost, "/api/projects/other", gin.H{"tree": sampleTree()}, http.Header{"X-User-Id": {"mallory"}}); w.Code != http.StatusForbidden {
+		t.Errorf("save of an ownerless project = %d, want 403", w.Code)
+	}
+	if meta, _ := store.GetMeta("other"); meta.Owner != "" {
+		t.Errorf("ownerless project got owner %q", meta.Owner)
+	}
+
+	w := doJSONWithHeader(t, r, http.MethodGet, "/api/projects?prefix=lesson-&sort=name&limit=1", nil, teacher)
+	var page struct {
+		Projects   []map[string]interface{} `json:"projects"`
+		Total      int                      `json:"total"`
+		NextOffset *int                     `json:"nextOffset"`
+	}
+	decodeJSON(t, w, &page)
+	if w.Code != http.StatusOK || page.Total != 2 || len(page.Projects) != 1 || page.NextOffset == nil || *page.NextOffset != 1 {
+		t.Fatalf("GET /api/projects = %d %s", w.Code, w.Body)
+	}
+	first := page.Projects[0]
+	if first["projectId"] != "lesson-1" || first["fileCount"] != float64(2) || first["role"] != "owner" || first["lastVersion"] == "" {
+		t.Errorf("first project = %+v", first)
+	}
+	// Listings leave out who owns a project and who else can use it.
+	doJSONWithHeader(t, r, http.MethodPut, "/api/projects/lesson-1/collaborators/student", gin.H{"role": "viewer"}, teacher)
+	w = doJSONWithHeader(t, r, http.MethodGet, "/api/projects?prefix=lesson-1", nil, http.Header{"X-User-Id": {"student"}})
+	if body := w.Body.String(); !strings.Contains(body, `"role":"viewer"`) || strings.Contains(body, "teacher") || strings.Contains(body, "collaborators") {
+		t.Errorf("listing for a collaborator = %s", body)
+	}
+
+	w = doJSONWithHeader(t, r, http.MethodGet, "/api/projects?sort=size&order=asc", nil, teacher)
+	page.Projects = nil
+	decodeJSON(t, w, &page)
+	if page.Total != 3 || page.Projects[0]["projectId"] != "lesson-2" {
+		t.Errorf("GET /api/projects?sort=size = %s", w.Body)
+	}
+
+	if w := doJSON(t, r, http.MethodGet, "/api/projects?sort=bogus", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid sort = %d, want 400", w.Code)
+	}
+
+	// Past the scan limit sorted listings are refused rather than sorting a
+	// part of the projects; one owner's projects and cursor pages still work.
+	listScanLimit = 2
+	t.Cleanup(func() { listScanLimit = 10000 })
+	w = doJSONWithHeader(t, r, http.MethodGet, "/api/projects", nil, teacher)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "too_many_projects") {
+		t.Errorf("sorted listing past the scan limit = %d %s", w.Code, w.Body)
+	}
+	page.Projects = nil
+	decodeJSON(t, doJSONWithHeader(t, r, http.MethodGet, "/api/projects?owner=me", nil, teacher), &page)
+	if page.Total != 1 || page.Projects[0]["projectId"] != "lesson-1" {
+		t.Errorf("owner=me listing = %+v", page)
+	}
+	var ids []string
+	cursor := ""
+	for i := 0; i < 5; i++ {
+		var cpage struct {
+			Projects   []map[string]interface{} `json:"projects"`
+			NextCursor string                   `json:"nextCursor"`
+		}
+		w := doJSONWithHeader(t, r, http.MethodGet, "/api/projects?limit=2&cursor="+cursor, nil, teacher)
+		decodeJSON(t, w, &cpage)
+		if w.Code != http.StatusOK {
+			t.Fatalf("cursor listing = %d %s", w.Code, w.Body)
+		}
+		for _, p := range cpage.Projects {
+			ids = append(ids, p["projectId"].(string))
+		}
+		if cursor = cpage.NextCursor; cursor == "" {
+			break
+		}
+	}
+	sort.Strings(ids)
+	if want := []string{"lesson-1", "lesson-2", "other"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("projects over all cursor pages = %v, want %v", ids, want)
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/projects?cursor=&sort=name", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("cursor with sort = %d, want 400", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/projects?owner=me", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous owner=me = %d, want 401", w.Code)
+	}
+}
+
+func TestVersionHistory(t *testing.T) {
+	r := newTestRouter(t)
+	var versions []string
+	for i, msg := range []string{"initial", "second", "third"} {
+		w := doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{
+			"tree":    filesToTree(map[string]string{"main.sw": msg}),
+			"author":  "student",
+			"message": msg,
+		})
+		var saved struct {
+			Version string `json:"version"`
+		}
+		decodeJSON(t, w, &saved)
+		if saved.Version == "" {
+			t.Fatalf("save %d = %d %s", i, w.Code, w.Body)
+		}
+		versions = append(versions, saved.Version)
+	}
+
+	var page struct {
+		Versions   []VersionInfo `json:"versions"`
+		NextCursor string        `json:"nextCursor"`
+	}
+	w := doJSON(t, r, http.MethodGet, "/api/projects/demo/versions?limit=2", nil)
+	decodeJSON(t, w, &page)
+	if len(page.Versions) != 2 || page.Versions[0].Version != versions[2] || page.Versions[0].Message != "third" || page.Versions[0].Author != "student" || page.NextCursor == "" {
+		t.Fatalf("first page = %s", w.Body)
+	}
+	w = doJSON(t, r, http.MethodGet, "/api/projects/demo/versions?limit=2&cursor="+page.NextCursor, nil)
+	page.NextCursor = ""
+	decodeJSON(t, w, &page)
+	if len(page.Versions) != 1 || page.Versions[0].Version != versions[0] || page.NextCursor != "" {
+		t.Fatalf("second page = %s", w.Body)
+	}
+
+	w = doJSON(t, r, http.MethodGet, "/api/projects/demo/snapshots/"+versions[1], nil)
+	var snap struct {
+		Tree []FileSystemNode `json:"tree"`
+	}
+	decodeJSON(t, w, &snap)
+	if w.Code != http.StatusOK || len(snap.Tree) != 1 || snap.Tree[0].Content != "second" {
+		t.Errorf("GET snapshot = %d %s", w.Code, w.Body)
+	}
+
+	if w := doJSON(t, r, http.MethodGet, "/api/projects/missing/versions", nil); w.Code != http.StatusNotFound {
+		t.Errorf("versions of missing project = %d, want 404", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/projects/demo/snapshots/not-a-uuid", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid snapshot version = %d, want 400", w.Code)
+	}
+}
+
+func TestRestoreVersion(t *testing.T) {
+	r := newTestRouter(t)
+	save := func(files map[string]string) string {
+		var saved struct {
+			Version string `json:"version"`
+		}
+		decodeJSON(t, doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": filesToTree(files)}), &saved)
+		return saved.Version
+	}
+	v1 := save(map[string]string{"main.sw": "one", "lib/util.sw": "util"})
+	save(map[string]string{"main.sw": "two", "extra.sw": "extra"})
+
+	// Partial restore brings back lib/ only.
+	w := doJSON(t, r, http.MethodPost, "/api/projects/demo/restore", gin.H{"version": v1, "paths": []string{"lib"}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("partial restore = %d %s", w.Code, w.Body)
+	}
+	files, _ := splitFileContents("demo")
+	if want := map[string]string{"main.sw": "two", "extra.sw": "extra", "lib/util.sw": "util"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("after partial restore files = %v, want %v", files, want)
+	}
+
+	// Full restore drops extra.sw, including its split row.
+	w = doJSON(t, r, http.MethodPost, "/api/projects/demo/restore", gin.H{"version": v1})
+	var restored struct {
+		Version      string `json:"version"`
+		RestoredFrom string `json:"restoredFrom"`
+	}
+	decodeJSON(t, w, &restored)
+	if w.Code != http.StatusCreated || restored.RestoredFrom != v1 || restored.Version == v1 {
+		t.Fatalf("restore = %d %s", w.Code, w.Body)
+	}
+	files, _ = splitFileContents("demo")
+	if want := map[string]string{"main.sw": "one", "lib/util.sw": "util"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("after restore split files = %v, want %v", files, want)
+	}
+	if tree := loadFatWithCache("demo", nil); !reflect.DeepEqual(treeToFiles(tree, ""), files) {
+		t.Errorf("latest snapshot = %v", treeToFiles(tree, ""))
+	}
+	var versions struct {
+		Versions []VersionInfo `json:"versions"`
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodGet, "/api/projects/demo/versions", nil), &versions)
+	if len(versions.Versions) != 4 || versions.Versions[0].Message != "Restore "+v1 {
+		t.Errorf("history after restore = %+v", versions.Versions)
+	}
+
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo/restore", gin.H{"version": v1, "paths": []string{"nope.sw"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("restore of unknown path = %d, want 400", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo/restore", gin.H{"version": "bad"}); w.Code != http.StatusBadRequest {
+		t.Errorf("restore of invalid version = %d, want 400", w.Code)
+	}
+}
+
+func TestOptimisticConcurrency(t *testing.T) {
+	r := newTestRouter(t)
+	w := doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree()})
+	v1 := w.Header().Get("ETag")
+	if w.Code != http.StatusCreated || v1 == "" {
+		t.Fatalf("first save = %d, ETag %q", w.Code, v1)
+	}
+
+	w = doJSON(t, r, http.MethodGet, "/api/projects/demo", nil)
+	if got := w.Header().Get("ETag"); got != v1 {
+		t.Errorf("GET ETag = %q, want %q", got, v1)
+	}
+	if w := doJSONWithHeader(t, r, http.MethodGet, "/api/projects/demo", nil, http.Header{"If-None-Match": {v1}}); w.Code != http.StatusNotModified {
+		t.Errorf("GET with matching If-None-Match = %d, want 304", w.Code)
+	}
+
+	// Two tabs save from v1; the second one conflicts.
+	tab1 := filesToTree(map[string]string{"main.sw": "tab 1", "lib/util.sw": "kazi util() {}"})
+	w = doJSONWithHeader(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": tab1}, http.Header{"If-Match": {v1}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("save from current base = %d %s", w.Code, w.Body)
+	}
+	v2 := strings.Trim(w.Header().Get("ETag"), `"`)
+
+	w = doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree(), "baseVersion": strings.Trim(v1, `"`)})
+	var conflict struct {
+		CurrentVersion string   `json:"currentVersion"`
+		Diff           TreeDiff `json:"diff"`
+	}
+	decodeJSON(t, w, &conflict)
+	if w.Code != http.StatusConflict || conflict.CurrentVersion != v2 || conflict.Diff.Summary.Modified != 1 {
+		t.Errorf("stale save = %d %s", w.Code, w.Body)
+	}
+	if meta, _ := store.GetMeta("demo"); meta.LastVersion != v2 {
+		t.Errorf("latest version after conflict = %s, want %s", meta.LastVersion, v2)
+	}
+
+	// Unconditional saves keep last-writer-wins behaviour.
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree()}); w.Code != http.StatusCreated {
+		t.Errorf("unconditional save = %d", w.Code)
+	}
+}
+
+func TestShareLimits(t *testing.T) {
+	r := newTestRouter(t)
+	old := shareLimits
+	shareLimits = ShareLimits{TTL: time.Hour, MaxShares: 2, MaxTotalBytes: 1 << 20}
+	t.Cleanup(func() { expireShares(time.Now().Add(2 * time.Hour)); shareLimits = old })
+
+	sessionID, _ := createPlaygroundSession(map[string]string{"main.sw": "andika(1)"}, "new")
+	share := func() (int, string) {
+		var res struct {
+			Slug string `json:"slug"`
+		}
+		w := doJSON(t, r, http.MethodPost, "/api/session/"+sessionID+"/share", nil)
+		decodeJSON(t, w, &res)
+		return w.Code, res.Slug
+	}
+	code, first := share()
+	if code != http.StatusCreated {
+		t.Fatalf("share = %d", code)
+	}
+	share()
+	if code, _ := share(); code != http.StatusInsufficientStorage {
+		t.Errorf("share over the limit = %d, want 507", code)
+	}
+
+	// Expired shares disappear and free their quota.
+	expireShares(time.Now().Add(2 * time.Hour))
+	if w := doJSON(t, r, http.MethodGet, "/api/share/"+first, nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET expired share = %d, want 404", w.Code)
+	}
+	if code, _ := share(); code != http.StatusCreated {
+		t.Errorf("share after expiry = %d, want 201", code)
+	}
+}
+
+// partialSaveStore commits every save but reports that its split rows
+// failed, like the Astra store does when syncing them fails.
+type partialSaveStore struct{ ProjectStore }
+
+func (s partialSaveStore) SaveSnapshot(projectID string, tree []FileSystemNode, opts SaveOptions) (ProjectMeta, error) {
+	meta, _ := s.ProjectStore.SaveSnapshot(projectID, tree, opts)
+	return ProjectMeta{}, errors.New("version " + meta.LastVersion + " saved but split rows are incomplete")
+}
+
+func TestFailedSaveInvalidatesCache(t *testing.T) {
+	r := newTestRouter(t)
+	doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": filesToTree(map[string]string{"main.sw": "old"})})
+	loadFatWithCache("demo", nil)
+	store = partialSaveStore{store}
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": filesToTree(map[string]string{"main.sw": "new"})}); w.Code != http.StatusInternalServerError {
+		t.Fatalf("save = %d, want 500", w.Code)
+	}
+	if files := treeToFiles(loadFatWithCache("demo", nil), ""); files["main.sw"] != "new" {
+		t.Errorf("latest after a partly failed save = %q, want the committed version", files)
+	}
+}
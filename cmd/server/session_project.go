@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+
+	"swalang-api-dualmode/internal/runner"
+)
+
+/* ============ PLAYGROUND <-> PROJECT BRIDGE ============ */
+
+// saveSessionAsProject persists the session's files as a new version of the
+// project named by ?project=.
+func saveSessionAsProject(c *gin.Context) {
+	sessionID := c.Param("id")
+	projID := c.Query("project")
+	if projID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query parameter 'project' is required"})
+		return
+	}
+	sessionVal, ok := playgroundSessions.Load(sessionID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	files := snapshotSessionFiles(sessionVal.(*PlaygroundSession))
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "session has no files to save"})
+		return
+	}
+
+	version, size, err := saveHybrid(projID, filesToTree(files), SaveOptions{Owner: saveOwner(c, "")})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	broadcast(projID, map[string]interface{}{"type": "update", "version": version, "size": size})
+	c.JSON(http.StatusCreated, gin.H{"projectId": projID, "version": version, "size": size, "fileCount": len(files)})
+}
+
+// openProjectSession starts a playground session preloaded with the files of
+// a stored project version (latest when neither ?version= nor ?ref= is
+// given).
+func openProjectSession(c *gin.Context) {
+	projID := c.Param("id")
+	versionStr, status, err := queryVersion(c, projID)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	var version *gocql.UUID
+	if versionStr != "" {
+		versionUUID, _ := gocql.ParseUUID(versionStr)
+		version = &versionUUID
+	}
+	tree := loadFatWithCache(projID, version)
+	if tree == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project or version not found"})
+		return
+	}
+
+	files := make(map[string]string)
+	for p, content := range treeToFiles(tree, "") {
+		clean, err := runner.ValidatePath(p, playgroundLimits.MaxPathDepth)
+		if err != nil {
+			log.Printf("Skipping file %q of project %s: %v", p, projID, err)
+			continue
+		}
+		files[clean] = content
+	}
+	if err := playgroundLimits.checkFiles(files); err != nil {
+		qe := err.(*QuotaError)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": qe.Msg, "code": qe.Code, "limit": qe.Limit})
+		return
+	}
+
+	sessionID, _ := createPlaygroundSession(files, "project:"+projID)
+	resp := gin.H{
+		"session_id": sessionID,
+		"ws_url":     sessionWSURL(c, sessionID),
+		"projectId":  projID,
+		"fileCount":  len(files),
+	}
+	if version != nil {
+		resp["version"] = version.String()
+	}
+	c.JSON(http.StatusCreated, resp)
+}
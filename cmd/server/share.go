@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"swalang-api-dualmode/internal/hooks"
+)
+
+/* ---------- Shared Playground Snapshots ---------- */
+
+// PlaygroundShare is an immutable copy of a session's files taken at share
+// time. Shares live next to sessions in memory but outlive them: they expire
+// after shareLimits.TTL.
+type PlaygroundShare struct {
+	Slug          string            `json:"slug"`
+	Files         map[string]string `json:"files"`
+	SourceSession string            `json:"sourceSession"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	ExpiresAt     time.Time         `json:"expiresAt"`
+	size          int64
+}
+
+// MarshalJSON base64-encodes binary files and lists them in "encodings"
+// (path -> "base64"); text files are sent as is.
+func (s *PlaygroundShare) MarshalJSON() ([]byte, error) {
+	type plain PlaygroundShare
+	out := struct {
+		plain
+		Encodings map[string]string `json:"encodings,omitempty"`
+	}{plain: plain(*s)}
+	out.Files = make(map[string]string, len(s.Files))
+	for p, content := range s.Files {
+		enc := contentEncoding(content)
+		if enc != encodingUTF8 {
+			if out.Encodings == nil {
+				out.Encodings = make(map[string]string)
+			}
+			out.Encodings[p] = enc
+		}
+		out.Files[p] = encodeContent(content, enc)
+	}
+	return json.Marshal(out)
+}
+
+var playgroundShares = &sync.Map{} // slug -> *PlaygroundShare
+
+// shareUsage counts the live shares and their bytes against shareLimits.
+var shareUsage struct {
+	sync.Mutex
+	count int
+	bytes int64
+}
+
+// reserveShare accounts for a new share of size bytes, or returns a
+// *QuotaError when it would exceed shareLimits.
+func reserveShare(size int64) error {
+	shareUsage.Lock()
+	defer shareUsage.Unlock()
+	if shareUsage.count+1 > shareLimits.MaxShares {
+		return &QuotaError{Code: "share_quota_exceeded", Limit: int64(shareLimits.MaxShares),
+			Msg: fmt.Sprintf("the server already holds the maximum of %d shares", shareLimits.MaxShares)}
+	}
+	if shareUsage.bytes+size > shareLimits.MaxTotalBytes {
+		return &QuotaError{Code: "share_quota_exceeded", Limit: shareLimits.MaxTotalBytes,
+			Msg: fmt.Sprintf("shares would exceed the server's %d byte quota", shareLimits.MaxTotalBytes)}
+	}
+	shareUsage.count++
+	shareUsage.bytes += size
+	return nil
+}
+
+func releaseShare(size int64) {
+	shareUsage.Lock()
+	defer shareUsage.Unlock()
+	shareUsage.count--
+	shareUsage.bytes -= size
+}
+
+// loadShare returns a share that has not expired yet.
+func loadShare(slug string) (*PlaygroundShare, bool) {
+	v, ok := playgroundShares.Load(slug)
+	if !ok || time.Now().After(v.(*PlaygroundShare).ExpiresAt) {
+		return nil, false
+	}
+	return v.(*PlaygroundShare), true
+}
+
+// expireShares drops the shares whose TTL has passed.
+func expireShares(now time.Time) {
+	playgroundShares.Range(func(key, value interface{}) bool {
+		share := value.(*PlaygroundShare)
+		if now.After(share.ExpiresAt) {
+			playgroundShares.Delete(key)
+			releaseShare(share.size)
+			log.Printf("Cleaned up expired share: %s", share.Slug)
+		}
+		return true
+	})
+}
+
+const slugAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func newShareSlug(n int) (string, error) {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(slugAlphabet)))
+	for i := range b {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = slugAlphabet[idx.Int64()]
+	}
+	return string(b), nil
+}
+
+// snapshotSessionFiles copies the current path -> content map of a session.
+func snapshotSessionFiles(ps *PlaygroundSession) map[string]string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	files := make(map[string]string)
+	ps.Files.Range(func(key, value interface{}) bool {
+		files[key.(string)] = value.(string)
+		return true
+	})
+	return files
+}
+
+// createPlaygroundSession registers a new session pre-populated with files.
+// origin describes where the files came from for event hooks, e.g. "new",
+// "share:<slug>" or "project:<id>".
+func createPlaygroundSession(files map[string]string, origin string) (string, *PlaygroundSession) {
+	sessionID := uuid.New().String()
+	ps := &PlaygroundSession{Files: &sync.Map{}, CreatedAt: time.Now()}
+	for p, content := range files {
+		ps.Files.Store(p, content)
+	}
+	playgroundSessions.Store(sessionID, ps)
+	sessionHooks.Emit(hooks.Event{
+		Type:      hooks.SessionCreated,
+		SessionID: sessionID,
+		Data:      map[string]interface{}{"origin": origin, "fileCount": len(files)},
+	})
+	return sessionID, ps
+}
+
+func sessionWSURL(c *gin.Context, sessionID string) string {
+	wsScheme := "ws"
+	if c.Request.TLS != nil {
+		wsScheme = "wss"
+	}
+	return fmt.Sprintf("%s://%s/api/session/%s/ws", wsScheme, c.Request.Host, sessionID)
+}
+
+func shareSessionHandler(c *gin.Context) {
+	sessionID := c.Param("id")
+	sessionVal, ok := playgroundSessions.Load(sessionID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	files := snapshotSessionFiles(sessionVal.(*PlaygroundSession))
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "session has no files to share"})
+		return
+	}
+
+	now := time.Now()
+	share := &PlaygroundShare{Files: files, SourceSession: sessionID, CreatedAt: now, ExpiresAt: now.Add(shareLimits.TTL)}
+	for _, content := range files {
+		share.size += int64(len(content))
+	}
+	if err := reserveShare(share.size); err != nil {
+		qe := err.(*QuotaError)
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": qe.Msg, "code": qe.Code, "limit": qe.Limit})
+		return
+	}
+	for attempt := 0; ; attempt++ {
+		slug, err := newShareSlug(8)
+		if err != nil {
+			releaseShare(share.size)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate share slug"})
+			return
+		}
+		share.Slug = slug
+		if _, taken := playgroundShares.LoadOrStore(slug, share); !taken {
+			break
+		}
+		if attempt == 5 {
+			releaseShare(share.size)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate unique share slug"})
+			return
+		}
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"slug":      share.Slug,
+		"url":       fmt.Sprintf("/api/share/%s", share.Slug),
+		"fileCount": len(files),
+		"createdAt": share.CreatedAt,
+		"expiresAt": share.ExpiresAt,
+	})
+}
+
+func getShareHandler(c *gin.Context) {
+	share, ok := loadShare(c.Param("slug"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "share not found"})
+		return
+	}
+	c.JSON(http.StatusOK, share)
+}
+
+func forkShareHandler(c *gin.Context) {
+	share, ok := loadShare(c.Param("slug"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "share not found"})
+		return
+	}
+	sessionID, _ := createPlaygroundSession(share.Files, "share:"+share.Slug)
+	c.JSON(http.StatusCreated, gin.H{
+		"session_id":  sessionID,
+		"ws_url":      sessionWSURL(c, sessionID),
+		"forked_from": share.Slug,
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+/* ---------- Large Snapshot Encoding ---------- */
+
+// Snapshots at or above snapshotChunkThreshold bytes of JSON are stored
+// gzip-compressed and, on Astra, split into snapshotChunkSize pieces in
+// project_snapshot_chunks instead of one snapshot cell.
+const snapshotEncodingGzipChunked = "gzip-chunked"
+
+var (
+	snapshotChunkThreshold = envInt("SNAPSHOT_CHUNK_THRESHOLD", 1<<20)
+	snapshotChunkSize      = envInt("SNAPSHOT_CHUNK_SIZE", 512<<10)
+)
+
+func gzipBytes(raw []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(raw)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decompress snapshot: %w", err)
+	}
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("decompress snapshot: %w", err)
+	}
+	return raw, nil
+}
+
+// chunkSnapshot compresses raw and splits it into chunks of at most size
+// bytes.
+func chunkSnapshot(raw []byte, size int) [][]byte {
+	data := gzipBytes(raw)
+	var chunks [][]byte
+	for len(data) > size {
+		chunks = append(chunks, data[:size])
+		data = data[size:]
+	}
+	return append(chunks, data)
+}
+
+// joinSnapshot reverses chunkSnapshot.
+func joinSnapshot(chunks [][]byte) ([]byte, error) {
+	return gunzipBytes(bytes.Join(chunks, nil))
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestChunkSnapshotRoundTrip(t *testing.T) {
+	raw := []byte(strings.Repeat(`{"name":"main.sw","content":"andika(\"hello\")"},`, 20000))
+	chunks := chunkSnapshot(raw, 1024)
+	if len(chunks) < 2 {
+		t.Fatalf("chunkSnapshot() produced %d chunks, want several", len(chunks))
+	}
+	for i, c := range chunks {
+		if len(c) > 1024 {
+			t.Errorf("chunk %d has %d bytes, want at most 1024", i, len(c))
+		}
+	}
+	got, err := joinSnapshot(chunks)
+	if err != nil || !bytes.Equal(got, raw) {
+		t.Errorf("joinSnapshot() = %d bytes, %v; want %d bytes", len(got), err, len(raw))
+	}
+	if _, err := joinSnapshot([][]byte{[]byte("not gzip")}); err == nil {
+		t.Error("joinSnapshot(garbage) succeeded")
+	}
+}
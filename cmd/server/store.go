@@ -0,0 +1,316 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+/* ---------- Project Storage ---------- */
+
+var (
+	errNotFound      = errors.New("not found")
+	errInvalidCursor = errors.New("invalid cursor")
+	errRefExists     = errors.New("ref already exists")
+)
+
+// ProjectMeta summarises the latest saved version of a project.
+type ProjectMeta struct {
+	ProjectID   string     `json:"projectId"`
+	LastVersion string     `json:"lastVersion"`
+	LastSize    int        `json:"lastSize"`
+	LastUpdated time.Time  `json:"lastUpdated"`
+	FileCount   int        `json:"fileCount"`
+	Owner       string     `json:"owner,omitempty"`
+	DeletedAt   *time.Time `json:"deletedAt,omitempty"` // set while the project is in the trash
+
+	// Access control; see access.go. Collaborators maps user IDs to roles.
+	Collaborators map[string]string `json:"collaborators,omitempty"`
+	Public        bool              `json:"public,omitempty"`
+}
+
+// SaveOptions carries per-save metadata. Owner is only recorded when the save
+// creates the project; Author and Message describe the version.
+// When BaseVersion is set the save only succeeds if it is still the latest
+// version; otherwise SaveSnapshot returns a *ConflictError.
+type SaveOptions struct {
+	Owner       string
+	Author      string
+	Message     string
+	BaseVersion string
+	Branch      string    // recorded with the version; "" is the default branch
+	Timestamp   time.Time // recorded as the version time, not as last_updated; zero means now
+}
+
+func (o SaveOptions) time() time.Time {
+	if o.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return o.Timestamp
+}
+
+// ConflictError reports a save whose base version is no longer the latest.
+type ConflictError struct {
+	CurrentVersion string
+}
+
+func (e *ConflictError) Error() string {
+	return "version conflict: latest version is " + e.CurrentVersion
+}
+
+// VersionInfo describes one stored snapshot without its tree.
+type VersionInfo struct {
+	Version   string    `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+	Size      int       `json:"size"`
+	Author    string    `json:"author,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Branch    string    `json:"branch,omitempty"`
+}
+
+// Ref is a named pointer to a version. Tags stay where they are created;
+// branches advance with every save to them.
+type Ref struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"` // "tag" or "branch"
+	Version   string    `json:"version"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// BlobStats counts blobs and their content bytes.
+type BlobStats struct {
+	Count int   `json:"count"`
+	Bytes int64 `json:"bytes"`
+}
+
+// SplitFile is one row of the split representation: a file or folder of the
+// latest version, addressable by path.
+type SplitFile struct {
+	Path      string
+	Name      string
+	IsFolder  bool
+	Content   string // raw bytes; binary files are stored as such
+	Size      int    // bytes of Content, also set when ListFiles leaves it out
+	MimeType  string
+	Checksum  string
+	UpdatedAt time.Time
+}
+
+// FileQuery selects the split rows ListFiles returns, in path order.
+type FileQuery struct {
+	Prefix   string // only paths starting with Prefix
+	OneLevel bool   // only direct children of Prefix, a folder path ending in "/" or ""
+	Limit    int    // rows scanned per page; 0 returns every row at once
+	Cursor   string // nextCursor of the previous page
+}
+
+// matches reports whether the row at p belongs to the listing.
+func (q FileQuery) matches(p string) bool {
+	if !strings.HasPrefix(p, q.Prefix) {
+		return false
+	}
+	return !q.OneLevel || !strings.Contains(p[len(q.Prefix):], "/")
+}
+
+// MetaQuery selects the projects ListMeta returns. An owner is looked up
+// through an index; a prefix alone still reads every project, as project IDs
+// are not stored in order.
+type MetaQuery struct {
+	Prefix string // only project IDs starting with Prefix
+	Owner  string // only projects this user owns
+	Limit  int    // rows scanned per page; 0 returns every row at once
+	Cursor string // nextCursor of the previous page
+}
+
+func (q MetaQuery) matches(m ProjectMeta) bool {
+	return strings.HasPrefix(m.ProjectID, q.Prefix) && (q.Owner == "" || m.Owner == q.Owner)
+}
+
+// ProjectStore persists projects in two shapes: full snapshots per version
+// ("fat" rows) and one row per file of the latest version ("split" rows), plus
+// the embeddings used for similarity search. Lookups of missing projects,
+// versions or files return errNotFound.
+type ProjectStore interface {
+	// Snapshots. A nil version means the latest one of the default branch.
+	LoadSnapshot(projectID string, version *gocql.UUID) ([]FileSystemNode, error)
+	// SaveSnapshot stores tree as a new version, updates the project metadata
+	// and brings the split rows in line with tree: changed rows are written
+	// and rows of paths no longer in tree are deleted.
+	SaveSnapshot(projectID string, tree []FileSystemNode, opts SaveOptions) (ProjectMeta, error)
+	// SaveVersion stores tree as a version without touching the metadata or
+	// the split rows, which follow the default branch only.
+	SaveVersion(projectID string, tree []FileSystemNode, opts SaveOptions) (VersionInfo, error)
+	// ListVersions pages through versions, newest first. cursor is opaque:
+	// pass "" for the first page and the returned cursor afterwards; an empty
+	// returned cursor means there are no more versions.
+	ListVersions(projectID string, limit int, cursor string) ([]VersionInfo, string, error)
+
+	// Split files
+	// ListFiles returns one page of split rows without their contents, and
+	// the cursor of the next page ("" after the last). With OneLevel a page
+	// can hold fewer than Limit rows, or none, and still have a next page.
+	ListFiles(projectID string, q FileQuery) ([]SplitFile, string, error)
+	GetFile(projectID, filePath string) (SplitFile, error)
+	// ForEachFile calls fn for every split row until fn returns false.
+	ForEachFile(projectID string, fn func(f SplitFile) bool) error
+	// DeleteFiles removes split rows; missing paths are ignored.
+	DeleteFiles(projectID string, paths []string) error
+	// SyncFiles reconciles the split rows with tree without creating a
+	// version, returning the number of rows written and deleted.
+	SyncFiles(projectID string, tree []FileSystemNode) (written, deleted int, err error)
+
+	// Embeddings
+	SetEmbedding(projectID, filePath string, vec []float32) error
+	GetEmbedding(projectID, filePath string) ([]float32, error)
+	SearchSimilar(projectID string, queryVec []float32, limit int) ([]SimilarResult, error)
+
+	// Refs
+	ListRefs(projectID string) ([]Ref, error)
+	GetRef(projectID, name string) (Ref, error)
+	// CreateRef fails with errRefExists when the name is taken.
+	CreateRef(projectID string, ref Ref) error
+	// MoveRef points a ref at version if it still points at expected, and
+	// returns a *ConflictError otherwise.
+	MoveRef(projectID, name, version, expected string) error
+	DeleteRef(projectID, name string) error
+
+	// Retention
+	// GetRetention returns the project's policy, or nil when it has none.
+	GetRetention(projectID string) (*RetentionPolicy, error)
+	// SetRetention stores a policy; nil removes it.
+	SetRetention(projectID string, p *RetentionPolicy) error
+	// DeleteVersions removes snapshots; their blobs are left to PruneBlobs.
+	DeleteVersions(projectID string, versions []string) error
+	// PruneBlobs deletes blobs that no version other than the excluded ones
+	// references. With dryRun it only reports what it would delete.
+	PruneBlobs(projectID string, excluded []string, dryRun bool) (BlobStats, error)
+
+	// Metadata
+	GetMeta(projectID string) (ProjectMeta, error)
+	// ListMeta pages through the metadata the query selects, deleted
+	// projects included, in storage order. An empty cursor is the last
+	// page.
+	ListMeta(q MetaQuery) ([]ProjectMeta, string, error)
+
+	// Deletion
+	// SetDeleted moves a project to the trash at the given time; the zero
+	// time restores it. Saves leave the mark alone.
+	SetDeleted(projectID string, at time.Time) error
+	// PurgeProject removes every version, blob, split row, ref and the
+	// metadata of a project.
+	PurgeProject(projectID string) error
+
+	// Access control. Both fail with errNotFound for unknown projects and
+	// are left alone by saves.
+	// SetCollaborator grants userID a role; the empty role removes them.
+	SetCollaborator(projectID, userID, role string) error
+	SetPublic(projectID string, public bool) error
+
+	Close()
+}
+
+// openProjectStore selects the backend from PROJECT_STORE ("astra", "local"
+// or "none"). When unset, Astra is used if its credentials are present and the
+// local on-disk store otherwise.
+func openProjectStore() (ProjectStore, error) {
+	kind := os.Getenv("PROJECT_STORE")
+	if kind == "" {
+		kind = "local"
+		if os.Getenv("ASTRA_TOKEN") != "" && os.Getenv("ASTRA_BUNDLE") != "" {
+			kind = "astra"
+		}
+	}
+	switch kind {
+	case "astra":
+		return connectAstra()
+	case "local":
+		dir := os.Getenv("PROJECT_STORE_DIR")
+		if dir == "" {
+			dir = "data/projects"
+		}
+		s, err := newLocalStore(dir)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("✅ Using local project store at %s", dir)
+		return s, nil
+	case "none":
+		log.Println("⚠️  PROJECT_STORE=none. Project features disabled.")
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown PROJECT_STORE %q", kind)
+	}
+}
+
+// splitRow is a node of a tree together with its full path.
+type splitRow struct {
+	Path string
+	Node FileSystemNode
+}
+
+func (r splitRow) key() string {
+	return splitKey(r.Node.Type == "folder", checksum(r.Node.Content), r.Node.MimeType)
+}
+
+// splitKey identifies the stored state of a split row; rows with equal keys
+// need not be rewritten.
+func splitKey(isFolder bool, sum, mimeType string) string {
+	if isFolder {
+		return "folder:" + sum
+	}
+	if mimeType != "" {
+		return "file:" + sum + ";" + mimeType
+	}
+	return "file:" + sum
+}
+
+func splitRows(nodes []FileSystemNode, prefix string) []splitRow {
+	var rows []splitRow
+	for _, n := range nodes {
+		p := path.Join(prefix, n.Name)
+		rows = append(rows, splitRow{Path: p, Node: n})
+		if n.Type == "folder" {
+			rows = append(rows, splitRows(n.Children, p)...)
+		}
+	}
+	return rows
+}
+
+// planSplitSync compares tree with the existing split rows (path -> splitKey)
+// and returns the rows to write and the paths to delete.
+func planSplitSync(tree []FileSystemNode, existing map[string]string) (upserts []splitRow, stale []string) {
+	keep := make(map[string]bool)
+	for _, r := range splitRows(tree, "") {
+		keep[r.Path] = true
+		if k, ok := existing[r.Path]; !ok || k != r.key() {
+			upserts = append(upserts, r)
+		}
+	}
+	for p := range existing {
+		if !keep[p] {
+			stale = append(stale, p)
+		}
+	}
+	sort.Strings(stale)
+	return upserts, stale
+}
+
+// countFiles returns the number of files (not folders) in a tree.
+func countFiles(nodes []FileSystemNode) int {
+	n := 0
+	for _, node := range nodes {
+		if node.Type == "folder" {
+			n += countFiles(node.Children)
+		} else {
+			n++
+		}
+	}
+	return n
+}
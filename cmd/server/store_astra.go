@@ -0,0 +1,988 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	gocqlastra "github.com/datastax/gocql-astra"
+	"github.com/gocql/gocql"
+)
+
+/* ============ Astra DB Project Store ============ */
+
+type astraStore struct {
+	session *gocql.Session
+}
+
+func connectAstra() (ProjectStore, error) {
+	bundle := os.Getenv("ASTRA_BUNDLE")
+	token := os.Getenv("ASTRA_TOKEN")
+
+	if token == "" || bundle == "" {
+		return nil, errors.New("ASTRA_TOKEN and ASTRA_BUNDLE must be set for PROJECT_STORE=astra")
+	}
+
+	cluster, err := gocqlastra.NewClusterFromBundle(bundle, "token", token, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Astra cluster: %w", err)
+	}
+	cluster.Keyspace = "codeks"
+	cluster.NumConns = 4
+	cluster.ProtoVersion = 4
+
+	session, err := gocql.NewSession(*cluster)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Astra: %w", err)
+	}
+	log.Println("✅ Connected to Astra DB")
+	return &astraStore{session: session}, nil
+}
+
+func (s *astraStore) Close() {
+	s.session.Close()
+}
+
+func notFoundIfNoRows(err error) error {
+	if errors.Is(err, gocql.ErrNotFound) {
+		return errNotFound
+	}
+	return err
+}
+
+func (s *astraStore) GetMeta(projectID string) (ProjectMeta, error) {
+	m := ProjectMeta{ProjectID: projectID}
+	var ver gocql.UUID
+	err := s.session.Query(`SELECT last_version,last_size,last_updated,file_count,owner,deleted_at,collaborators,public FROM project_meta WHERE project_id=?`, projectID).Scan(&ver, &m.LastSize, &m.LastUpdated, &m.FileCount, &m.Owner, &m.DeletedAt, &m.Collaborators, &m.Public)
+	if errors.Is(err, gocql.ErrNotFound) {
+		// Projects saved before project_meta was maintained only have snapshots.
+		err = s.session.Query(`SELECT version,size,updated_at FROM project_snapshots WHERE project_id=? ORDER BY version DESC LIMIT 1`, projectID).Scan(&ver, &m.LastSize, &m.LastUpdated)
+	}
+	if err != nil {
+		return m, notFoundIfNoRows(err)
+	}
+	m.LastVersion = ver.String()
+	return m, nil
+}
+
+// ListMeta pages through project_meta in token order, or through the owner
+// index when the query names an owner. The prefix is applied to the rows
+// read, so a page can come back short.
+func (s *astraStore) ListMeta(q MetaQuery) ([]ProjectMeta, string, error) {
+	var state []byte
+	if q.Cursor != "" {
+		var err error
+		if state, err = base64.RawURLEncoding.DecodeString(q.Cursor); err != nil {
+			return nil, "", errInvalidCursor
+		}
+	}
+	const cols = `SELECT project_id,last_version,last_size,last_updated,file_count,owner,deleted_at,collaborators,public FROM project_meta`
+	query := s.session.Query(cols)
+	if q.Owner != "" {
+		query = s.session.Query(cols+` WHERE owner=?`, q.Owner)
+	}
+	if q.Limit > 0 {
+		query = query.PageSize(q.Limit).PageState(state)
+	} else {
+		query = query.PageSize(500)
+	}
+	iter := query.Iter()
+	var next []byte
+	if q.Limit > 0 {
+		next = iter.PageState()
+	}
+	var metas []ProjectMeta
+	var m ProjectMeta
+	var ver gocql.UUID
+	for iter.Scan(&m.ProjectID, &ver, &m.LastSize, &m.LastUpdated, &m.FileCount, &m.Owner, &m.DeletedAt, &m.Collaborators, &m.Public) {
+		if q.matches(m) {
+			m.LastVersion = ver.String()
+			metas = append(metas, m)
+		}
+		m = ProjectMeta{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, "", err
+	}
+	return metas, base64.RawURLEncoding.EncodeToString(next), nil
+}
+
+func (s *astraStore) LoadSnapshot(projectID string, version *gocql.UUID) ([]FileSystemNode, error) {
+	data, format, err := s.loadSnapshotData(projectID, version)
+	if err != nil {
+		return nil, err
+	}
+	if format != snapshotFormatManifest {
+		// Versions saved before blob dedup hold the full tree.
+		var tree []FileSystemNode
+		if err := json.Unmarshal(data, &tree); err != nil {
+			return nil, err
+		}
+		return tree, nil
+	}
+	var manifest []manifestNode
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	blobs, err := s.loadBlobs(projectID, manifestHashes(manifest, nil))
+	if err != nil {
+		return nil, err
+	}
+	return fromManifest(manifest, blobs)
+}
+
+// loadSnapshotData returns the stored JSON of a version, reassembled from
+// its chunks if needed, and its format.
+func (s *astraStore) loadSnapshotData(projectID string, version *gocql.UUID) ([]byte, string, error) {
+	var raw, encoding, format string
+	var ver gocql.UUID
+	var chunkCount int
+	if version == nil {
+		// Saves to other branches are newer than the latest version of the
+		// default branch, which project_meta records.
+		meta, err := s.GetMeta(projectID)
+		if err != nil {
+			return nil, "", err
+		}
+		latest, err := gocql.ParseUUID(meta.LastVersion)
+		if err != nil {
+			return nil, "", err
+		}
+		version = &latest
+	}
+	err := s.session.Query(`SELECT version,snapshot,encoding,chunk_count,format FROM project_snapshots WHERE project_id = ? AND version = ? LIMIT 1`, projectID, *version).
+		Consistency(gocql.One).Scan(&ver, &raw, &encoding, &chunkCount, &format)
+	if err != nil {
+		return nil, "", notFoundIfNoRows(err)
+	}
+	if encoding != snapshotEncodingGzipChunked {
+		return []byte(raw), format, nil
+	}
+	data, err := s.loadChunks(projectID, ver, chunkCount)
+	return data, format, err
+}
+
+// blobQueryBatch bounds the IN lists of blob lookups.
+const blobQueryBatch = 100
+
+func hashBatches(hashes map[string]bool) [][]string {
+	var batches [][]string
+	var cur []string
+	for h := range hashes {
+		cur = append(cur, h)
+		if len(cur) == blobQueryBatch {
+			batches = append(batches, cur)
+			cur = nil
+		}
+	}
+	if len(cur) > 0 {
+		batches = append(batches, cur)
+	}
+	return batches
+}
+
+// storedContent splits file contents into the text and blob columns of
+// project_blobs and project_files: text goes to content, binary contents to
+// data, since Cassandra text must be valid UTF-8.
+func storedContent(content string) (text *string, data []byte) {
+	if contentEncoding(content) == encodingBase64 {
+		return nil, []byte(content)
+	}
+	return &content, nil
+}
+
+// contentOf joins the columns written by storedContent.
+func contentOf(text string, data []byte) string {
+	if data != nil {
+		return string(data)
+	}
+	return text
+}
+
+func (s *astraStore) loadBlobs(projectID string, hashes map[string]bool) (map[string]string, error) {
+	blobs := make(map[string]string, len(hashes))
+	for _, batch := range hashBatches(hashes) {
+		iter := s.session.Query(`SELECT hash,content,data FROM project_blobs WHERE project_id=? AND hash IN ?`, projectID, batch).Iter()
+		var h, content string
+		var data []byte
+		for iter.Scan(&h, &content, &data) {
+			blobs[h] = contentOf(content, data)
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return blobs, nil
+}
+
+// writeBlobs stores the blobs of a save. It first refreshes the last_ref
+// marker of every blob in unlogged batches, which tells PruneBlobs that a
+// save is using it, and then writes the contents the project does not have
+// yet, one statement each since a single file can be large. Checking for
+// contents after the marker is set also catches a blob PruneBlobs deleted
+// just before.
+func (s *astraStore) writeBlobs(projectID string, blobs map[string]string) error {
+	now := time.Now()
+	missing := make(map[string]bool, len(blobs))
+	for h := range blobs {
+		missing[h] = true
+	}
+	batches := hashBatches(missing)
+	for _, hashes := range batches {
+		batch := s.session.NewBatch(gocql.UnloggedBatch)
+		for _, h := range hashes {
+			batch.Query(`UPDATE project_blobs SET last_ref=? WHERE project_id=? AND hash=?`, now, projectID, h)
+		}
+		if err := s.session.ExecuteBatch(batch); err != nil {
+			return fmt.Errorf("mark blobs: %w", err)
+		}
+	}
+	for _, hashes := range batches {
+		iter := s.session.Query(`SELECT hash,size FROM project_blobs WHERE project_id=? AND hash IN ?`, projectID, hashes).Iter()
+		var h string
+		var size *int
+		for iter.Scan(&h, &size) {
+			if size != nil {
+				delete(missing, h)
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return err
+		}
+	}
+	for h := range missing {
+		content, data := storedContent(blobs[h])
+		if err := s.session.Query(`INSERT INTO project_blobs (project_id,hash,content,data,size,last_ref) VALUES (?,?,?,?,?,?)`, projectID, h, content, data, len(blobs[h]), now).Exec(); err != nil {
+			return fmt.Errorf("write blob %s: %w", h, err)
+		}
+	}
+	return nil
+}
+
+func (s *astraStore) loadChunks(projectID string, ver gocql.UUID, count int) ([]byte, error) {
+	iter := s.session.Query(`SELECT data FROM project_snapshot_chunks WHERE project_id=? AND version=?`, projectID, ver).Iter()
+	var chunks [][]byte
+	var data []byte
+	for iter.Scan(&data) {
+		chunks = append(chunks, data)
+		data = nil
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	if len(chunks) != count {
+		return nil, fmt.Errorf("snapshot %s of project %s has %d of %d chunks", ver, projectID, len(chunks), count)
+	}
+	return joinSnapshot(chunks)
+}
+
+// writeChunks stores one chunk per statement; a batch of them would exceed
+// the batch size limits this table exists to avoid.
+func (s *astraStore) writeChunks(projectID string, ver gocql.UUID, chunks [][]byte) error {
+	for i, c := range chunks {
+		if err := s.session.Query(`INSERT INTO project_snapshot_chunks (project_id,version,idx,data) VALUES (?,?,?,?)`, projectID, ver, i, c).Exec(); err != nil {
+			return fmt.Errorf("write snapshot chunk %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (s *astraStore) SaveSnapshot(projectID string, tree []FileSystemNode, opts SaveOptions) (ProjectMeta, error) {
+	raw, _ := json.Marshal(tree)
+	ver := gocql.TimeUUID()
+	// The version keeps opts.Timestamp, e.g. an imported commit time; the
+	// project itself was updated now.
+	now := time.Now()
+	meta := ProjectMeta{ProjectID: projectID, LastVersion: ver.String(), LastSize: len(raw), LastUpdated: now, FileCount: countFiles(tree)}
+
+	prev, err := s.GetMeta(projectID)
+	if err != nil && !errors.Is(err, errNotFound) {
+		return ProjectMeta{}, err
+	}
+	meta.Owner = prev.Owner
+
+	existing, err := s.splitKeys(projectID)
+	if err != nil {
+		return ProjectMeta{}, err
+	}
+	upserts, stale := planSplitSync(tree, existing)
+
+	// Every save claims the new version on project_meta first, with a
+	// lightweight transaction: plain writes to the partition would not be
+	// ordered with the LWTs of conditional saves. LWTs cannot share a batch
+	// with other tables, so the batch follows.
+	base := opts.BaseVersion
+	if base != "" {
+		err = s.claimVersion(projectID, base, meta)
+	} else {
+		base, err = s.advanceVersion(projectID, prev.LastVersion, &meta, opts.Owner)
+	}
+	if err != nil {
+		return ProjectMeta{}, err
+	}
+	release := func() { s.releaseVersion(projectID, base, ver) }
+
+	snapshot, err := s.writeSnapshotData(projectID, ver, tree)
+	if err != nil {
+		release()
+		return ProjectMeta{}, err
+	}
+
+	batch := s.session.NewBatch(gocql.LoggedBatch)
+	batch.Query(insertSnapshotCQL, snapshot.args(projectID, ver, meta.LastSize, opts.time(), opts)...)
+	// Small changes to the split rows share the logged batch; large ones are
+	// written afterwards in bounded batches.
+	if splitBytes(upserts) <= maxSplitBatchBytes {
+		queueSplitSync(batch, projectID, upserts, stale, now)
+		upserts, stale = nil, nil
+	}
+	if err := s.session.ExecuteBatch(batch); err != nil {
+		release()
+		return ProjectMeta{}, err
+	}
+	if err := s.writeSplitRows(projectID, upserts, stale, now); err != nil {
+		return ProjectMeta{}, fmt.Errorf("version %s saved but split rows are incomplete (run repair-splits): %w", ver, err)
+	}
+	return meta, nil
+}
+
+func (s *astraStore) SaveVersion(projectID string, tree []FileSystemNode, opts SaveOptions) (VersionInfo, error) {
+	raw, _ := json.Marshal(tree)
+	ver := gocql.TimeUUID()
+	v := VersionInfo{Version: ver.String(), Timestamp: opts.time(), Size: len(raw), Author: opts.Author, Message: opts.Message, Branch: opts.Branch}
+	snapshot, err := s.writeSnapshotData(projectID, ver, tree)
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	err = s.session.Query(insertSnapshotCQL, snapshot.args(projectID, ver, v.Size, v.Timestamp, opts)...).Exec()
+	return v, err
+}
+
+const insertSnapshotCQL = `INSERT INTO project_snapshots (project_id,version,snapshot,size,updated_at,author,message,encoding,chunk_count,format,branch) VALUES (?,?,?,?,?,?,?,?,?,?,?)`
+
+// snapshotData is the stored form of a version's manifest.
+type snapshotData struct {
+	snapshot   string
+	encoding   string
+	chunkCount int
+}
+
+func (d snapshotData) args(projectID string, ver gocql.UUID, size int, now time.Time, opts SaveOptions) []interface{} {
+	return []interface{}{projectID, ver, d.snapshot, size, now, opts.Author, opts.Message, d.encoding, d.chunkCount, snapshotFormatManifest, opts.Branch}
+}
+
+// writeSnapshotData writes the file contents of tree to project_blobs and,
+// if the manifest is large, the manifest to project_snapshot_chunks. Both
+// must exist before the project_snapshots row that references them.
+func (s *astraStore) writeSnapshotData(projectID string, ver gocql.UUID, tree []FileSystemNode) (snapshotData, error) {
+	blobs := make(map[string]string)
+	manifest, _ := json.Marshal(toManifest(tree, blobs))
+	if err := s.writeBlobs(projectID, blobs); err != nil {
+		return snapshotData{}, err
+	}
+	if len(manifest) < snapshotChunkThreshold {
+		return snapshotData{snapshot: string(manifest)}, nil
+	}
+	chunks := chunkSnapshot(manifest, snapshotChunkSize)
+	if err := s.writeChunks(projectID, ver, chunks); err != nil {
+		return snapshotData{}, err
+	}
+	return snapshotData{encoding: snapshotEncodingGzipChunked, chunkCount: len(chunks)}, nil
+}
+
+// claimVersion moves project_meta from base to meta.LastVersion with a
+// lightweight transaction, so only one of several saves from the same base
+// can succeed.
+func (s *astraStore) claimVersion(projectID, base string, meta ProjectMeta) error {
+	baseUUID, err := gocql.ParseUUID(base)
+	if err != nil {
+		current, _ := s.GetMeta(projectID)
+		return &ConflictError{CurrentVersion: current.LastVersion}
+	}
+	ver, _ := gocql.ParseUUID(meta.LastVersion)
+	var current gocql.UUID
+	applied, err := s.session.Query(`UPDATE project_meta SET last_version=?,last_size=?,last_updated=?,file_count=? WHERE project_id=? IF last_version=?`,
+		ver, meta.LastSize, meta.LastUpdated, meta.FileCount, projectID, baseUUID).ScanCAS(&current)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+	if current == (gocql.UUID{}) {
+		// Projects saved before project_meta was maintained have no row to
+		// compare against; fall back to their latest snapshot.
+		legacy, err := s.GetMeta(projectID)
+		if err != nil && !errors.Is(err, errNotFound) {
+			return err
+		}
+		if legacy.LastVersion != base {
+			return &ConflictError{CurrentVersion: legacy.LastVersion}
+		}
+		applied, err = s.createMeta(projectID, ver, meta, "")
+		if err != nil {
+			return err
+		}
+		if applied {
+			return nil
+		}
+		legacy, _ = s.GetMeta(projectID)
+		return &ConflictError{CurrentVersion: legacy.LastVersion}
+	}
+	return &ConflictError{CurrentVersion: current.String()}
+}
+
+// maxClaimAttempts bounds how often an unconditional save retries claiming
+// a version that other saves keep moving.
+const maxClaimAttempts = 10
+
+// advanceVersion claims meta.LastVersion for an unconditional save from
+// whatever version is latest, starting with latest, and returns the version
+// it replaced. A save that creates the project records owner, unless another
+// save created it first.
+func (s *astraStore) advanceVersion(projectID, latest string, meta *ProjectMeta, owner string) (string, error) {
+	ver, _ := gocql.ParseUUID(meta.LastVersion)
+	for attempt := 0; attempt < maxClaimAttempts; attempt++ {
+		if latest == "" {
+			created, err := s.createMeta(projectID, ver, *meta, owner)
+			if err != nil {
+				return "", err
+			}
+			if created {
+				meta.Owner = owner
+				return "", nil
+			}
+			current, err := s.GetMeta(projectID)
+			if err != nil {
+				return "", err
+			}
+			latest, meta.Owner = current.LastVersion, current.Owner
+			continue
+		}
+		err := s.claimVersion(projectID, latest, *meta)
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			return latest, err
+		}
+		latest = conflict.CurrentVersion
+	}
+	return "", fmt.Errorf("project %s is changing too fast to save; try again", projectID)
+}
+
+// createMeta inserts the project_meta row of a new project with owner and
+// reports whether it did; false means the row exists already.
+func (s *astraStore) createMeta(projectID string, ver gocql.UUID, meta ProjectMeta, owner string) (bool, error) {
+	return s.session.Query(`INSERT INTO project_meta (project_id,last_version,last_size,last_updated,file_count,owner) VALUES (?,?,?,?,?,?) IF NOT EXISTS`,
+		projectID, ver, meta.LastSize, meta.LastUpdated, meta.FileCount, owner).MapScanCAS(map[string]interface{}{})
+}
+
+// releaseVersion points project_meta back at base after the batch of a
+// claimed version failed, unless another save has moved it on since. A
+// project the failed save created is removed again.
+func (s *astraStore) releaseVersion(projectID, base string, ver gocql.UUID) {
+	var err error
+	if base == "" {
+		_, err = s.session.Query(`DELETE FROM project_meta WHERE project_id=? IF last_version=?`, projectID, ver).MapScanCAS(map[string]interface{}{})
+	} else {
+		baseUUID, _ := gocql.ParseUUID(base)
+		var current gocql.UUID
+		_, err = s.session.Query(`UPDATE project_meta SET last_version=? WHERE project_id=? IF last_version=?`, baseUUID, projectID, ver).ScanCAS(&current)
+	}
+	if err != nil {
+		log.Printf("Failed to release version %s of project %s: %v", ver, projectID, err)
+	}
+}
+
+func (s *astraStore) SyncFiles(projectID string, tree []FileSystemNode) (int, int, error) {
+	existing, err := s.splitKeys(projectID)
+	if err != nil {
+		return 0, 0, err
+	}
+	upserts, stale := planSplitSync(tree, existing)
+	if len(upserts) == 0 && len(stale) == 0 {
+		return 0, 0, nil
+	}
+	if err := s.writeSplitRows(projectID, upserts, stale, time.Now()); err != nil {
+		return 0, 0, err
+	}
+	return len(upserts), len(stale), nil
+}
+
+func (s *astraStore) ListVersions(projectID string, limit int, cursor string) ([]VersionInfo, string, error) {
+	var state []byte
+	if cursor != "" {
+		var err error
+		if state, err = base64.RawURLEncoding.DecodeString(cursor); err != nil {
+			return nil, "", errInvalidCursor
+		}
+	}
+	// Setting a page state (even nil) disables automatic paging, so the
+	// iterator stops after one page.
+	iter := s.session.Query(`SELECT version,size,updated_at,author,message,branch FROM project_snapshots WHERE project_id=?`, projectID).PageSize(limit).PageState(state).Iter()
+	next := iter.PageState()
+	var versions []VersionInfo
+	var v VersionInfo
+	var ver gocql.UUID
+	for iter.Scan(&ver, &v.Size, &v.Timestamp, &v.Author, &v.Message, &v.Branch) {
+		v.Version = ver.String()
+		versions = append(versions, v)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, "", err
+	}
+	if len(versions) == 0 && cursor == "" {
+		return nil, "", errNotFound
+	}
+	return versions, base64.RawURLEncoding.EncodeToString(next), nil
+}
+
+// splitKeys returns the splitKey of every split row of a project. Rows
+// written before the size or parent column existed get an empty key, so the
+// next sync, or repair-splits, rewrites them.
+func (s *astraStore) splitKeys(projectID string) (map[string]string, error) {
+	iter := s.session.Query(`SELECT path,is_folder,checksum,mime_type,size,parent FROM project_files WHERE project_id=?`, projectID).Iter()
+	keys := make(map[string]string)
+	var p, sum, mimeType string
+	var isFolder bool
+	var size *int
+	var parent *string
+	for iter.Scan(&p, &isFolder, &sum, &mimeType, &size, &parent) {
+		if size == nil || parent == nil {
+			keys[p] = ""
+			continue
+		}
+		keys[p] = splitKey(isFolder, sum, mimeType)
+	}
+	return keys, iter.Close()
+}
+
+// Bounds of the batches written by writeSplitRows.
+const (
+	maxSplitBatchBytes = 256 << 10
+	maxSplitBatchRows  = 100
+)
+
+func splitBytes(rows []splitRow) int {
+	n := 0
+	for _, r := range rows {
+		n += len(r.Node.Content)
+	}
+	return n
+}
+
+// writeSplitRows applies a split row plan in unlogged batches of bounded
+// size. All rows share the project_id partition. A row too large for any
+// batch is written with a statement of its own.
+func (s *astraStore) writeSplitRows(projectID string, upserts []splitRow, stale []string, now time.Time) error {
+	for len(upserts) > 0 || len(stale) > 0 {
+		if len(upserts) > 0 && len(upserts[0].Node.Content) > maxSplitBatchBytes {
+			if err := s.session.Query(insertSplitCQL, splitArgs(projectID, upserts[0], now)...).Exec(); err != nil {
+				return err
+			}
+			upserts = upserts[1:]
+			continue
+		}
+		n, size := 0, 0
+		for n < len(upserts) && n < maxSplitBatchRows && size+len(upserts[n].Node.Content) <= maxSplitBatchBytes {
+			size += len(upserts[n].Node.Content)
+			n++
+		}
+		m := min(len(stale), maxSplitBatchRows-n)
+		batch := s.session.NewBatch(gocql.UnloggedBatch)
+		queueSplitSync(batch, projectID, upserts[:n], stale[:m], now)
+		if err := s.session.ExecuteBatch(batch); err != nil {
+			return err
+		}
+		upserts, stale = upserts[n:], stale[m:]
+	}
+	return nil
+}
+
+const insertSplitCQL = `INSERT INTO project_files (project_id,path,parent,name,is_folder,content,data,size,mime_type,checksum,updated_at) VALUES (?,?,?,?,?,?,?,?,?,?,?)`
+
+// splitParent returns the folder of a split row as a FileQuery prefix:
+// "src/" for "src/main.sw". Top-level rows get "/", since SAI does not index
+// empty strings.
+func splitParent(p string) string {
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		return p[:i+1]
+	}
+	return "/"
+}
+
+func splitArgs(projectID string, r splitRow, now time.Time) []interface{} {
+	n := r.Node
+	content, data := storedContent(n.Content)
+	return []interface{}{projectID, r.Path, splitParent(r.Path), n.Name, n.Type == "folder", content, data, len(n.Content), n.MimeType, checksum(n.Content), now}
+}
+
+func queueSplitSync(batch *gocql.Batch, projectID string, upserts []splitRow, stale []string, now time.Time) {
+	for _, r := range upserts {
+		batch.Query(insertSplitCQL, splitArgs(projectID, r, now)...)
+	}
+	for _, p := range stale {
+		batch.Query(`DELETE FROM project_files WHERE project_id=? AND path=?`, projectID, p)
+	}
+}
+
+// ListFiles pages with Cassandra paging state, like ListVersions. OneLevel
+// listings query the parent index, so they read only the direct children.
+// Rows still lacking a size, written before the column existed, report 0
+// until repair-splits backfills them.
+func (s *astraStore) ListFiles(projectID string, q FileQuery) ([]SplitFile, string, error) {
+	var state []byte
+	if q.Cursor != "" {
+		var err error
+		if state, err = base64.RawURLEncoding.DecodeString(q.Cursor); err != nil {
+			return nil, "", errInvalidCursor
+		}
+	}
+	const cols = `SELECT path,name,is_folder,size,mime_type,checksum,updated_at FROM project_files`
+	var query *gocql.Query
+	if q.OneLevel {
+		parent := q.Prefix
+		if parent == "" {
+			parent = "/"
+		}
+		query = s.session.Query(cols+` WHERE project_id=? AND parent=?`, projectID, parent)
+	} else {
+		query = s.session.Query(cols+` WHERE project_id=? AND path>=? AND path<?`,
+			projectID, q.Prefix, q.Prefix+string(utf8.MaxRune))
+	}
+	if q.Limit > 0 {
+		query = query.PageSize(q.Limit).PageState(state)
+	}
+	iter := query.Iter()
+	var next []byte
+	if q.Limit > 0 {
+		next = iter.PageState()
+	}
+	var files []SplitFile
+	var f SplitFile
+	var size *int
+	for iter.Scan(&f.Path, &f.Name, &f.IsFolder, &size, &f.MimeType, &f.Checksum, &f.UpdatedAt) {
+		f.Size = 0
+		if size != nil {
+			f.Size = *size
+		}
+		files = append(files, f)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, "", err
+	}
+	return files, base64.RawURLEncoding.EncodeToString(next), nil
+}
+
+func (s *astraStore) GetFile(projectID, filePath string) (SplitFile, error) {
+	f := SplitFile{Path: filePath}
+	var data []byte
+	err := s.session.Query(`SELECT name,is_folder,content,data,mime_type,checksum,updated_at FROM project_files WHERE project_id=? AND path=?`, projectID, filePath).Scan(&f.Name, &f.IsFolder, &f.Content, &data, &f.MimeType, &f.Checksum, &f.UpdatedAt)
+	f.Content = contentOf(f.Content, data)
+	f.Size = len(f.Content)
+	return f, notFoundIfNoRows(err)
+}
+
+func (s *astraStore) ForEachFile(projectID string, fn func(f SplitFile) bool) error {
+	iter := s.session.Query(`SELECT path,name,is_folder,content,data,mime_type,checksum,updated_at FROM project_files WHERE project_id=?`, projectID).Iter()
+	var f SplitFile
+	var data []byte
+	for iter.Scan(&f.Path, &f.Name, &f.IsFolder, &f.Content, &data, &f.MimeType, &f.Checksum, &f.UpdatedAt) {
+		f.Content = contentOf(f.Content, data)
+		f.Size = len(f.Content)
+		if !fn(f) {
+			break
+		}
+	}
+	return iter.Close()
+}
+
+func (s *astraStore) DeleteFiles(projectID string, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	batch := s.session.NewBatch(gocql.UnloggedBatch)
+	for _, p := range paths {
+		batch.Query(`DELETE FROM project_files WHERE project_id=? AND path=?`, projectID, p)
+	}
+	return s.session.ExecuteBatch(batch)
+}
+
+func (s *astraStore) SetEmbedding(projectID, filePath string, vec []float32) error {
+	return s.session.Query(`UPDATE project_files SET embedding=? WHERE project_id=? AND path=?`, vec, projectID, filePath).Exec()
+}
+
+func (s *astraStore) GetEmbedding(projectID, filePath string) ([]float32, error) {
+	var vec []float32
+	err := s.session.Query(`SELECT embedding FROM project_files WHERE project_id=? AND path=?`, projectID, filePath).Scan(&vec)
+	if err != nil || vec == nil {
+		return nil, errNotFound
+	}
+	return vec, nil
+}
+
+func (s *astraStore) SearchSimilar(projectID string, queryVec []float32, limit int) ([]SimilarResult, error) {
+	iter := s.session.Query(`SELECT path,name, similarity_cosine(embedding,?) AS sim FROM project_files WHERE project_id=? AND embedding IS NOT NULL ORDER BY embedding ANN OF ? LIMIT ?`, queryVec, projectID, queryVec, limit).Iter()
+	var results []SimilarResult
+	var p, name string
+	var sim float32
+	for iter.Scan(&p, &name, &sim) {
+		results = append(results, SimilarResult{Path: p, Name: name, Similarity: sim})
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *astraStore) GetRetention(projectID string) (*RetentionPolicy, error) {
+	var raw string
+	err := s.session.Query(`SELECT retention FROM project_meta WHERE project_id=?`, projectID).Scan(&raw)
+	if errors.Is(err, gocql.ErrNotFound) || (err == nil && raw == "") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p RetentionPolicy
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *astraStore) SetRetention(projectID string, p *RetentionPolicy) error {
+	var raw interface{}
+	if p != nil {
+		b, _ := json.Marshal(p)
+		raw = string(b)
+	}
+	return s.session.Query(`UPDATE project_meta SET retention=? WHERE project_id=?`, raw, projectID).Exec()
+}
+
+func (s *astraStore) SetDeleted(projectID string, at time.Time) error {
+	var deletedAt interface{}
+	if !at.IsZero() {
+		deletedAt = at
+	}
+	return s.updateMeta(s.session.Query(`UPDATE project_meta SET deleted_at=? WHERE project_id=? IF EXISTS`, deletedAt, projectID))
+}
+
+// updateMeta runs a conditional (IF EXISTS) update of project_meta.
+func (s *astraStore) updateMeta(q *gocql.Query) error {
+	applied, err := q.ScanCAS()
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return errNotFound
+	}
+	return nil
+}
+
+func (s *astraStore) SetCollaborator(projectID, userID, role string) error {
+	if role == "" {
+		return s.updateMeta(s.session.Query(`DELETE collaborators[?] FROM project_meta WHERE project_id=? IF EXISTS`, userID, projectID))
+	}
+	return s.updateMeta(s.session.Query(`UPDATE project_meta SET collaborators[?]=? WHERE project_id=? IF EXISTS`, userID, role, projectID))
+}
+
+func (s *astraStore) SetPublic(projectID string, public bool) error {
+	return s.updateMeta(s.session.Query(`UPDATE project_meta SET public=? WHERE project_id=? IF EXISTS`, public, projectID))
+}
+
+// PurgeProject deletes project_meta last, so a purge that fails part way
+// leaves the project in the trash to be purged again.
+func (s *astraStore) PurgeProject(projectID string) error {
+	iter := s.session.Query(`SELECT version FROM project_snapshots WHERE project_id=?`, projectID).Iter()
+	var versions []gocql.UUID
+	var ver gocql.UUID
+	for iter.Scan(&ver) {
+		versions = append(versions, ver)
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if err := s.session.Query(`DELETE FROM project_snapshot_chunks WHERE project_id=? AND version=?`, projectID, v).Exec(); err != nil {
+			return err
+		}
+	}
+	for _, table := range []string{"project_snapshots", "project_blobs", "project_files", "project_refs", "project_meta"} {
+		if err := s.session.Query(`DELETE FROM `+table+` WHERE project_id=?`, projectID).Exec(); err != nil {
+			return fmt.Errorf("purge %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func (s *astraStore) DeleteVersions(projectID string, versions []string) error {
+	for _, v := range versions {
+		ver, err := gocql.ParseUUID(v)
+		if err != nil {
+			return err
+		}
+		if err := s.session.Query(`DELETE FROM project_snapshots WHERE project_id=? AND version=?`, projectID, ver).Exec(); err != nil {
+			return err
+		}
+		if err := s.session.Query(`DELETE FROM project_snapshot_chunks WHERE project_id=? AND version=?`, projectID, ver).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blobGracePeriod is how long a blob is kept after a save last marked it,
+// which covers saves that wrote their blobs but not yet their snapshot row.
+const blobGracePeriod = 10 * time.Minute
+
+// PruneBlobs reads the manifest of every remaining version and deletes the
+// blobs none of them references. Blobs marked within blobGracePeriod of the
+// scan are kept, as a concurrent save may be about to reference them.
+func (s *astraStore) PruneBlobs(projectID string, excluded []string, dryRun bool) (BlobStats, error) {
+	var stats BlobStats
+	cutoff := time.Now().Add(-blobGracePeriod).UnixMicro()
+	skip := make(map[string]bool, len(excluded))
+	for _, v := range excluded {
+		skip[v] = true
+	}
+	var versions []gocql.UUID
+	iter := s.session.Query(`SELECT version,format FROM project_snapshots WHERE project_id=?`, projectID).Iter()
+	var ver gocql.UUID
+	var format string
+	for iter.Scan(&ver, &format) {
+		if format == snapshotFormatManifest && !skip[ver.String()] {
+			versions = append(versions, ver)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return stats, err
+	}
+
+	referenced := make(map[string]bool)
+	for i := range versions {
+		data, _, err := s.loadSnapshotData(projectID, &versions[i])
+		if err != nil {
+			return stats, err
+		}
+		var manifest []manifestNode
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return stats, err
+		}
+		manifestHashes(manifest, referenced)
+	}
+
+	// Blobs written before last_ref existed fall back to the write time of
+	// their contents.
+	unreferenced := make(map[string]*time.Time)
+	iter = s.session.Query(`SELECT hash,size,last_ref,WRITETIME(size),WRITETIME(last_ref) FROM project_blobs WHERE project_id=?`, projectID).Iter()
+	var h string
+	var size int
+	var lastRef *time.Time
+	var written, marked *int64
+	for iter.Scan(&h, &size, &lastRef, &written, &marked) {
+		at := marked
+		if at == nil {
+			at = written
+		}
+		if !referenced[h] && (at == nil || *at < cutoff) {
+			unreferenced[h] = lastRef
+			stats.Count++
+			stats.Bytes += int64(size)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return stats, err
+	}
+	if dryRun {
+		return stats, nil
+	}
+	// Each delete is conditional on the marker it saw, so it skips a blob a
+	// save marked while GC ran. A save that marks it after the delete finds
+	// its contents gone and writes them again.
+	for h, lastRef := range unreferenced {
+		if _, err := s.session.Query(`DELETE FROM project_blobs WHERE project_id=? AND hash=? IF last_ref=?`, projectID, h, lastRef).MapScanCAS(map[string]interface{}{}); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+func (s *astraStore) ListRefs(projectID string) ([]Ref, error) {
+	iter := s.session.Query(`SELECT name,type,version,updated_at FROM project_refs WHERE project_id=?`, projectID).Iter()
+	refs := []Ref{}
+	var r Ref
+	var ver gocql.UUID
+	for iter.Scan(&r.Name, &r.Type, &ver, &r.UpdatedAt) {
+		r.Version = ver.String()
+		refs = append(refs, r)
+	}
+	return refs, iter.Close()
+}
+
+func (s *astraStore) GetRef(projectID, name string) (Ref, error) {
+	r := Ref{Name: name}
+	var ver gocql.UUID
+	err := s.session.Query(`SELECT type,version,updated_at FROM project_refs WHERE project_id=? AND name=?`, projectID, name).Scan(&r.Type, &ver, &r.UpdatedAt)
+	if err != nil {
+		return r, notFoundIfNoRows(err)
+	}
+	r.Version = ver.String()
+	return r, nil
+}
+
+func (s *astraStore) CreateRef(projectID string, ref Ref) error {
+	ver, err := gocql.ParseUUID(ref.Version)
+	if err != nil {
+		return err
+	}
+	applied, err := s.session.Query(`INSERT INTO project_refs (project_id,name,type,version,updated_at) VALUES (?,?,?,?,?) IF NOT EXISTS`,
+		projectID, ref.Name, ref.Type, ver, ref.UpdatedAt).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return errRefExists
+	}
+	return nil
+}
+
+func (s *astraStore) MoveRef(projectID, name, version, expected string) error {
+	ver, err := gocql.ParseUUID(version)
+	if err != nil {
+		return err
+	}
+	expectedUUID, err := gocql.ParseUUID(expected)
+	if err != nil {
+		return &ConflictError{}
+	}
+	var current gocql.UUID
+	applied, err := s.session.Query(`UPDATE project_refs SET version=?,updated_at=? WHERE project_id=? AND name=? IF version=?`,
+		ver, time.Now(), projectID, name, expectedUUID).ScanCAS(&current)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+	if current == (gocql.UUID{}) {
+		return errNotFound
+	}
+	return &ConflictError{CurrentVersion: current.String()}
+}
+
+func (s *astraStore) DeleteRef(projectID, name string) error {
+	applied, err := s.session.Query(`DELETE FROM project_refs WHERE project_id=? AND name=? IF EXISTS`, projectID, name).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return errNotFound
+	}
+	return nil
+}
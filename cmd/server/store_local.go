@@ -0,0 +1,830 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+/* ============ Local On-Disk Project Store ============ */
+
+// localStore keeps projects as plain JSON files, one directory per project:
+//
+//	<dir>/<project>/meta.json                ProjectMeta of the latest version
+//	<dir>/<project>/versions.json            version index, oldest first
+//	<dir>/<project>/snapshots/<version>.manifest.json
+//	                                         manifest of each version
+//	                                         (.gz when large)
+//	<dir>/<project>/blobs/<sha256>           file contents, stored once
+//	<dir>/<project>/files.json               split rows of the latest version
+//	<dir>/<project>/refs.json                tags and branches by name
+//
+// It needs no external services, which makes it suitable for self-hosting
+// and for tests.
+type localStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+type localVersion struct {
+	Version   string    `json:"version"`
+	Size      int       `json:"size"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Author    string    `json:"author,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Branch    string    `json:"branch,omitempty"`
+}
+
+func (v localVersion) info() VersionInfo {
+	return VersionInfo{Version: v.Version, Timestamp: v.UpdatedAt, Size: v.Size, Author: v.Author, Message: v.Message, Branch: v.Branch}
+}
+
+// localFile is a split row in files.json. Binary contents are stored
+// base64-encoded, as JSON strings must be valid UTF-8.
+type localFile struct {
+	Path      string    `json:"path"`
+	Name      string    `json:"name"`
+	IsFolder  bool      `json:"isFolder"`
+	Content   string    `json:"content,omitempty"`
+	Encoding  string    `json:"encoding,omitempty"`
+	MimeType  string    `json:"mimeType,omitempty"`
+	Checksum  string    `json:"checksum"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Embedding []float32 `json:"embedding,omitempty"`
+}
+
+func newLocalFile(p string, n FileSystemNode, now time.Time) *localFile {
+	f := &localFile{Path: p, Name: n.Name, IsFolder: n.Type == "folder", MimeType: n.MimeType, Checksum: checksum(n.Content), UpdatedAt: now}
+	if enc := contentEncoding(n.Content); enc != encodingUTF8 {
+		f.Encoding = enc
+	}
+	f.Content = encodeContent(n.Content, f.Encoding)
+	return f
+}
+
+func (f *localFile) split() SplitFile {
+	content, err := decodeContent(f.Content, f.Encoding)
+	if err != nil {
+		log.Printf("split row %s: %v", f.Path, err)
+	}
+	return SplitFile{Path: f.Path, Name: f.Name, IsFolder: f.IsFolder, Content: content, Size: len(content), MimeType: f.MimeType, Checksum: f.Checksum, UpdatedAt: f.UpdatedAt}
+}
+
+func newLocalStore(dir string) (*localStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &localStore{dir: dir}, nil
+}
+
+func (s *localStore) Close() {}
+
+// projectDir maps a project ID to a single, reversible directory name.
+func (s *localStore) projectDir(projectID string) string {
+	name := strings.ReplaceAll(url.PathEscape(projectID), ".", "%2E")
+	return filepath.Join(s.dir, name)
+}
+
+func readJSONFile(p string, v interface{}) error {
+	raw, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return errNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// writeJSONFile replaces p atomically so readers never see partial files.
+func writeJSONFile(p string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(p, raw)
+}
+
+func writeFileAtomic(p string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *localStore) versions(projectID string) ([]localVersion, error) {
+	var vs []localVersion
+	if err := readJSONFile(filepath.Join(s.projectDir(projectID), "versions.json"), &vs); err != nil {
+		return nil, err
+	}
+	if len(vs) == 0 {
+		return nil, errNotFound
+	}
+	return vs, nil
+}
+
+func (s *localStore) files(projectID string) (map[string]*localFile, error) {
+	files := make(map[string]*localFile)
+	err := readJSONFile(filepath.Join(s.projectDir(projectID), "files.json"), &files)
+	if errors.Is(err, errNotFound) {
+		return files, nil
+	}
+	return files, err
+}
+
+func (s *localStore) GetMeta(projectID string) (ProjectMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var m ProjectMeta
+	if err := readJSONFile(filepath.Join(s.projectDir(projectID), "meta.json"), &m); err != nil {
+		return ProjectMeta{ProjectID: projectID}, err
+	}
+	return m, nil
+}
+
+// ListMeta pages in the order of the project directories; the cursor is the
+// last directory returned. Like the owner index on Astra, projects of other
+// owners do not count towards the limit.
+func (s *localStore) ListMeta(q MetaQuery) ([]ProjectMeta, string, error) {
+	after := ""
+	if q.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil || len(raw) == 0 {
+			return nil, "", errInvalidCursor
+		}
+		after = string(raw)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, "", err
+	}
+	var metas []ProjectMeta
+	read := 0
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() <= after {
+			continue
+		}
+		var m ProjectMeta
+		if err := readJSONFile(filepath.Join(s.dir, e.Name(), "meta.json"), &m); err != nil {
+			continue
+		}
+		if q.Owner != "" && m.Owner != q.Owner {
+			// Not read at all through the owner index on Astra.
+			continue
+		}
+		if q.Limit > 0 && read == q.Limit {
+			return metas, base64.RawURLEncoding.EncodeToString([]byte(after)), nil
+		}
+		read++
+		after = e.Name()
+		if q.matches(m) {
+			metas = append(metas, m)
+		}
+	}
+	return metas, "", nil
+}
+
+func (s *localStore) LoadSnapshot(projectID string, version *gocql.UUID) ([]FileSystemNode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ver string
+	if version != nil {
+		ver = version.String()
+	} else {
+		// Saves to other branches are newer than the latest version of
+		// the default branch, which meta.json records.
+		var m ProjectMeta
+		if err := readJSONFile(filepath.Join(s.projectDir(projectID), "meta.json"), &m); err != nil {
+			return nil, err
+		}
+		ver = m.LastVersion
+	}
+	dir := s.projectDir(projectID)
+	manifest, err := readManifest(dir, ver)
+	if errors.Is(err, errNotFound) {
+		// Versions saved before blob dedup hold the full tree.
+		var tree []FileSystemNode
+		raw, err := readMaybeGzipped(filepath.Join(dir, "snapshots", ver+".json"))
+		if err != nil {
+			return nil, err
+		}
+		return tree, json.Unmarshal(raw, &tree)
+	}
+	if err != nil {
+		return nil, err
+	}
+	blobs := make(map[string]string)
+	for h := range manifestHashes(manifest, nil) {
+		content, err := os.ReadFile(filepath.Join(dir, "blobs", h))
+		if err != nil {
+			return nil, fmt.Errorf("read blob %s: %w", h, err)
+		}
+		blobs[h] = string(content)
+	}
+	return fromManifest(manifest, blobs)
+}
+
+// readManifest returns errNotFound for versions stored as full trees.
+func readManifest(dir, ver string) ([]manifestNode, error) {
+	raw, err := readMaybeGzipped(filepath.Join(dir, "snapshots", ver+".manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest []manifestNode
+	return manifest, json.Unmarshal(raw, &manifest)
+}
+
+// readMaybeGzipped reads p, or p.gz for files that were stored compressed.
+func readMaybeGzipped(p string) ([]byte, error) {
+	raw, err := os.ReadFile(p)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return raw, err
+	}
+	data, err := os.ReadFile(p + ".gz")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return gunzipBytes(data)
+}
+
+// writeBlobs stores the blobs a project does not have yet.
+func writeBlobs(dir string, blobs map[string]string) error {
+	for h, content := range blobs {
+		p := filepath.Join(dir, "blobs", h)
+		if _, err := os.Stat(p); err == nil {
+			continue
+		}
+		if err := writeFileAtomic(p, []byte(content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *localStore) SaveSnapshot(projectID string, tree []FileSystemNode, opts SaveOptions) (ProjectMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir := s.projectDir(projectID)
+
+	var prev ProjectMeta
+	err := readJSONFile(filepath.Join(dir, "meta.json"), &prev)
+	created := errors.Is(err, errNotFound)
+	if err != nil && !created {
+		return ProjectMeta{}, err
+	}
+	if opts.BaseVersion != "" && opts.BaseVersion != prev.LastVersion {
+		return ProjectMeta{}, &ConflictError{CurrentVersion: prev.LastVersion}
+	}
+
+	v, err := s.writeVersion(projectID, tree, opts)
+	if err != nil {
+		return ProjectMeta{}, err
+	}
+	// The version keeps opts.Timestamp, e.g. an imported commit time; the
+	// project itself was updated now.
+	now := time.Now()
+	if _, _, err := s.syncFiles(projectID, tree, now); err != nil {
+		return ProjectMeta{}, err
+	}
+
+	meta := ProjectMeta{ProjectID: projectID, LastVersion: v.Version, LastSize: v.Size, LastUpdated: now, FileCount: countFiles(tree), Owner: prev.Owner, DeletedAt: prev.DeletedAt,
+		Collaborators: prev.Collaborators, Public: prev.Public}
+	if created {
+		meta.Owner = opts.Owner
+	}
+	if err := writeJSONFile(filepath.Join(dir, "meta.json"), meta); err != nil {
+		return ProjectMeta{}, err
+	}
+	return meta, nil
+}
+
+func (s *localStore) SaveVersion(projectID string, tree []FileSystemNode, opts SaveOptions) (VersionInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(filepath.Join(s.projectDir(projectID), "meta.json")); err != nil {
+		return VersionInfo{}, errNotFound
+	}
+	v, err := s.writeVersion(projectID, tree, opts)
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	return v.info(), nil
+}
+
+// writeVersion stores the blobs and manifest of tree as a new version and
+// appends it to the version index. The caller holds s.mu.
+func (s *localStore) writeVersion(projectID string, tree []FileSystemNode, opts SaveOptions) (localVersion, error) {
+	raw, _ := json.Marshal(tree)
+	v := localVersion{Version: gocql.TimeUUID().String(), Size: len(raw), UpdatedAt: opts.time(), Author: opts.Author, Message: opts.Message, Branch: opts.Branch}
+	dir := s.projectDir(projectID)
+
+	blobs := make(map[string]string)
+	manifest, _ := json.Marshal(toManifest(tree, blobs))
+	if err := writeBlobs(dir, blobs); err != nil {
+		return v, err
+	}
+	snapshotFile := v.Version + ".manifest.json"
+	if len(manifest) >= snapshotChunkThreshold {
+		snapshotFile, manifest = snapshotFile+".gz", gzipBytes(manifest)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "snapshots", snapshotFile), manifest); err != nil {
+		return v, err
+	}
+
+	vs, err := s.versions(projectID)
+	if err != nil && !errors.Is(err, errNotFound) {
+		return v, err
+	}
+	vs = append(vs, v)
+	return v, writeJSONFile(filepath.Join(dir, "versions.json"), vs)
+}
+
+// ListVersions uses the number of versions already returned as its cursor.
+func (s *localStore) ListVersions(projectID string, limit int, cursor string) ([]VersionInfo, string, error) {
+	offset := 0
+	if cursor != "" {
+		n, err := strconv.Atoi(cursor)
+		if err != nil || n < 0 {
+			return nil, "", errInvalidCursor
+		}
+		offset = n
+	}
+	s.mu.Lock()
+	vs, err := s.versions(projectID)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, "", err
+	}
+	var out []VersionInfo
+	for i := len(vs) - 1 - offset; i >= 0 && len(out) < limit; i-- {
+		out = append(out, vs[i].info())
+	}
+	next := ""
+	if offset+len(out) < len(vs) {
+		next = strconv.Itoa(offset + len(out))
+	}
+	return out, next, nil
+}
+
+func (s *localStore) SyncFiles(projectID string, tree []FileSystemNode) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.projectDir(projectID)); err != nil {
+		return 0, 0, errNotFound
+	}
+	return s.syncFiles(projectID, tree, time.Now())
+}
+
+// syncFiles applies planSplitSync to files.json. Unchanged rows keep their
+// timestamps and embeddings. The caller holds s.mu.
+func (s *localStore) syncFiles(projectID string, tree []FileSystemNode, now time.Time) (int, int, error) {
+	files, err := s.files(projectID)
+	if err != nil {
+		return 0, 0, err
+	}
+	existing := make(map[string]string, len(files))
+	for p, f := range files {
+		existing[p] = splitKey(f.IsFolder, f.Checksum, f.MimeType)
+	}
+	upserts, stale := planSplitSync(tree, existing)
+	if len(upserts) == 0 && len(stale) == 0 {
+		return 0, 0, nil
+	}
+	for _, r := range upserts {
+		files[r.Path] = newLocalFile(r.Path, r.Node, now)
+	}
+	for _, p := range stale {
+		delete(files, p)
+	}
+	if err := writeJSONFile(filepath.Join(s.projectDir(projectID), "files.json"), files); err != nil {
+		return 0, 0, err
+	}
+	return len(upserts), len(stale), nil
+}
+
+// ListFiles pages by path: the cursor is the last path of the previous page.
+func (s *localStore) ListFiles(projectID string, q FileQuery) ([]SplitFile, string, error) {
+	after := ""
+	if q.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil || len(raw) == 0 {
+			return nil, "", errInvalidCursor
+		}
+		after = string(raw)
+	}
+	var out []SplitFile
+	next := ""
+	err := s.ForEachFile(projectID, func(f SplitFile) bool {
+		if f.Path <= after || !q.matches(f.Path) {
+			return true
+		}
+		if q.Limit > 0 && len(out) == q.Limit {
+			next = base64.RawURLEncoding.EncodeToString([]byte(out[len(out)-1].Path))
+			return false
+		}
+		f.Content = ""
+		out = append(out, f)
+		return true
+	})
+	return out, next, err
+}
+
+func (s *localStore) GetFile(projectID, filePath string) (SplitFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := s.files(projectID)
+	if err != nil {
+		return SplitFile{}, err
+	}
+	f, ok := files[filePath]
+	if !ok {
+		return SplitFile{}, errNotFound
+	}
+	return f.split(), nil
+}
+
+// ForEachFile visits rows in path order, like the clustering order of the
+// Astra project_files table.
+func (s *localStore) ForEachFile(projectID string, fn func(f SplitFile) bool) error {
+	s.mu.Lock()
+	files, err := s.files(projectID)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if !fn(files[p].split()) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *localStore) DeleteFiles(projectID string, paths []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := s.files(projectID)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		delete(files, p)
+	}
+	return writeJSONFile(filepath.Join(s.projectDir(projectID), "files.json"), files)
+}
+
+func (s *localStore) SetEmbedding(projectID, filePath string, vec []float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := s.files(projectID)
+	if err != nil {
+		return err
+	}
+	f, ok := files[filePath]
+	if !ok {
+		return errNotFound
+	}
+	f.Embedding = vec
+	return writeJSONFile(filepath.Join(s.projectDir(projectID), "files.json"), files)
+}
+
+func (s *localStore) GetEmbedding(projectID, filePath string) ([]float32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := s.files(projectID)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := files[filePath]
+	if !ok || f.Embedding == nil {
+		return nil, errNotFound
+	}
+	return f.Embedding, nil
+}
+
+// SearchSimilar ranks every embedded file by cosine similarity, mirroring the
+// ANN query of the Astra store with an exhaustive scan.
+func (s *localStore) SearchSimilar(projectID string, queryVec []float32, limit int) ([]SimilarResult, error) {
+	s.mu.Lock()
+	files, err := s.files(projectID)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var results []SimilarResult
+	for _, f := range files {
+		if f.Embedding == nil {
+			continue
+		}
+		results = append(results, SimilarResult{Path: f.Path, Name: f.Name, Similarity: cosineSimilarity(queryVec, f.Embedding)})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Similarity != results[j].Similarity {
+			return results[i].Similarity > results[j].Similarity
+		}
+		return results[i].Path < results[j].Path
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// cosineSimilarity is scaled to [0, 1] like Cassandra's similarity_cosine.
+func cosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32((1 + dot/(math.Sqrt(na)*math.Sqrt(nb))) / 2)
+}
+
+func (s *localStore) GetRetention(projectID string) (*RetentionPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var p RetentionPolicy
+	err := readJSONFile(filepath.Join(s.projectDir(projectID), "retention.json"), &p)
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *localStore) SetRetention(projectID string, p *RetentionPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := filepath.Join(s.projectDir(projectID), "retention.json")
+	if p == nil {
+		if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return writeJSONFile(f, p)
+}
+
+// updateMeta rewrites meta.json with the changes fn makes.
+func (s *localStore) updateMeta(projectID string, fn func(m *ProjectMeta)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := filepath.Join(s.projectDir(projectID), "meta.json")
+	var m ProjectMeta
+	if err := readJSONFile(f, &m); err != nil {
+		return err
+	}
+	fn(&m)
+	return writeJSONFile(f, m)
+}
+
+func (s *localStore) SetDeleted(projectID string, at time.Time) error {
+	return s.updateMeta(projectID, func(m *ProjectMeta) {
+		m.DeletedAt = nil
+		if !at.IsZero() {
+			m.DeletedAt = &at
+		}
+	})
+}
+
+func (s *localStore) SetCollaborator(projectID, userID, role string) error {
+	return s.updateMeta(projectID, func(m *ProjectMeta) {
+		if role == "" {
+			delete(m.Collaborators, userID)
+			return
+		}
+		if m.Collaborators == nil {
+			m.Collaborators = make(map[string]string)
+		}
+		m.Collaborators[userID] = role
+	})
+}
+
+func (s *localStore) SetPublic(projectID string, public bool) error {
+	return s.updateMeta(projectID, func(m *ProjectMeta) { m.Public = public })
+}
+
+func (s *localStore) PurgeProject(projectID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir := s.projectDir(projectID)
+	if _, err := os.Stat(dir); err != nil {
+		return errNotFound
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *localStore) DeleteVersions(projectID string, versions []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vs, err := s.versions(projectID)
+	if err != nil {
+		return err
+	}
+	drop := make(map[string]bool, len(versions))
+	for _, v := range versions {
+		drop[v] = true
+	}
+	kept := vs[:0:0]
+	for _, v := range vs {
+		if !drop[v.Version] {
+			kept = append(kept, v)
+		}
+	}
+	dir := s.projectDir(projectID)
+	if err := writeJSONFile(filepath.Join(dir, "versions.json"), kept); err != nil {
+		return err
+	}
+	for v := range drop {
+		for _, name := range []string{".manifest.json", ".manifest.json.gz", ".json", ".json.gz"} {
+			if err := os.Remove(filepath.Join(dir, "snapshots", v+name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PruneBlobs holds the store lock throughout, so no save can reuse a blob
+// while it is being deleted.
+func (s *localStore) PruneBlobs(projectID string, excluded []string, dryRun bool) (BlobStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var stats BlobStats
+	vs, err := s.versions(projectID)
+	if err != nil {
+		return stats, err
+	}
+	skip := make(map[string]bool, len(excluded))
+	for _, v := range excluded {
+		skip[v] = true
+	}
+	dir := s.projectDir(projectID)
+	referenced := make(map[string]bool)
+	for _, v := range vs {
+		if skip[v.Version] {
+			continue
+		}
+		manifest, err := readManifest(dir, v.Version)
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+		if err != nil {
+			return stats, err
+		}
+		manifestHashes(manifest, referenced)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "blobs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	for _, e := range entries {
+		if referenced[e.Name()] || strings.HasPrefix(e.Name(), ".tmp-") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return stats, err
+		}
+		stats.Count++
+		stats.Bytes += info.Size()
+		if !dryRun {
+			if err := os.Remove(filepath.Join(dir, "blobs", e.Name())); err != nil {
+				return stats, err
+			}
+		}
+	}
+	return stats, nil
+}
+
+func (s *localStore) refs(projectID string) (map[string]Ref, error) {
+	refs := make(map[string]Ref)
+	err := readJSONFile(filepath.Join(s.projectDir(projectID), "refs.json"), &refs)
+	if errors.Is(err, errNotFound) {
+		return refs, nil
+	}
+	return refs, err
+}
+
+func (s *localStore) ListRefs(projectID string) ([]Ref, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs, err := s.refs(projectID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Ref, 0, len(refs))
+	for _, r := range refs {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (s *localStore) GetRef(projectID, name string) (Ref, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs, err := s.refs(projectID)
+	if err != nil {
+		return Ref{}, err
+	}
+	r, ok := refs[name]
+	if !ok {
+		return Ref{}, errNotFound
+	}
+	return r, nil
+}
+
+func (s *localStore) CreateRef(projectID string, ref Ref) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs, err := s.refs(projectID)
+	if err != nil {
+		return err
+	}
+	if _, ok := refs[ref.Name]; ok {
+		return errRefExists
+	}
+	refs[ref.Name] = ref
+	return writeJSONFile(filepath.Join(s.projectDir(projectID), "refs.json"), refs)
+}
+
+func (s *localStore) MoveRef(projectID, name, version, expected string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs, err := s.refs(projectID)
+	if err != nil {
+		return err
+	}
+	r, ok := refs[name]
+	if !ok {
+		return errNotFound
+	}
+	if r.Version != expected {
+		return &ConflictError{CurrentVersion: r.Version}
+	}
+	r.Version, r.UpdatedAt = version, time.Now()
+	refs[name] = r
+	return writeJSONFile(filepath.Join(s.projectDir(projectID), "refs.json"), refs)
+}
+
+func (s *localStore) DeleteRef(projectID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs, err := s.refs(projectID)
+	if err != nil {
+		return err
+	}
+	if _, ok := refs[name]; !ok {
+		return errNotFound
+	}
+	delete(refs, name)
+	return writeJSONFile(filepath.Join(s.projectDir(projectID), "refs.json"), refs)
+}
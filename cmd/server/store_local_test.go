@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+func sampleTree() []FileSystemNode {
+	return filesToTree(map[string]string{
+		"main.sw":     "andika(\"hello\")",
+		"lib/util.sw": "kazi util() {}",
+	})
+}
+
+func TestLocalStoreSnapshots(t *testing.T) {
+	s, err := newLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("newLocalStore() error = %v", err)
+	}
+
+	if _, err := s.LoadSnapshot("demo", nil); !errors.Is(err, errNotFound) {
+		t.Fatalf("LoadSnapshot() on empty store error = %v, want errNotFound", err)
+	}
+
+	first, err := s.SaveSnapshot("demo/../odd id", sampleTree(), SaveOptions{})
+	if err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+	second, err := s.SaveSnapshot("demo/../odd id", filesToTree(map[string]string{"main.sw": "v2"}), SaveOptions{})
+	if err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+
+	meta, err := s.GetMeta("demo/../odd id")
+	if err != nil || meta.LastVersion != second.LastVersion || meta.LastSize != second.LastSize {
+		t.Errorf("GetMeta() = %+v, %v; want version %s", meta, err, second.LastVersion)
+	}
+
+	latest, err := s.LoadSnapshot("demo/../odd id", nil)
+	if err != nil || findFileInTree(latest, "main.sw").Content != "v2" {
+		t.Errorf("LoadSnapshot(latest) = %+v, %v", latest, err)
+	}
+	v1, _ := gocql.ParseUUID(first.LastVersion)
+	old, err := s.LoadSnapshot("demo/../odd id", &v1)
+	if err != nil || findFileInTree(old, "lib/util.sw") == nil {
+		t.Errorf("LoadSnapshot(v1) = %+v, %v", old, err)
+	}
+}
+
+func TestLocalStoreSplitFilesAndEmbeddings(t *testing.T) {
+	s, _ := newLocalStore(t.TempDir())
+	if _, err := s.SaveSnapshot("demo", sampleTree(), SaveOptions{}); err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+
+	files, _, err := s.ListFiles("demo", FileQuery{})
+	if err != nil || len(files) != 3 {
+		t.Fatalf("ListFiles() = %+v, %v; want 3 rows", files, err)
+	}
+	if files[0].Path != "lib" || !files[0].IsFolder {
+		t.Errorf("first row = %+v, want folder lib", files[0])
+	}
+
+	f, err := s.GetFile("demo", "lib/util.sw")
+	if err != nil || f.Content != "kazi util() {}" || f.Checksum != checksum(f.Content) {
+		t.Errorf("GetFile() = %+v, %v", f, err)
+	}
+	if _, err := s.GetFile("demo", "missing.sw"); !errors.Is(err, errNotFound) {
+		t.Errorf("GetFile(missing) error = %v, want errNotFound", err)
+	}
+
+	if err := s.SetEmbedding("demo", "main.sw", []float32{1, 0}); err != nil {
+		t.Fatalf("SetEmbedding() error = %v", err)
+	}
+	s.SetEmbedding("demo", "lib/util.sw", []float32{0, 1})
+	results, err := s.SearchSimilar("demo", []float32{1, 0.1}, 1)
+	if err != nil || len(results) != 1 || results[0].Path != "main.sw" {
+		t.Errorf("SearchSimilar() = %+v, %v", results, err)
+	}
+}
+
+func TestLocalStoreSaveDropsStaleRows(t *testing.T) {
+	s, _ := newLocalStore(t.TempDir())
+	s.SaveSnapshot("demo", sampleTree(), SaveOptions{})
+	s.SetEmbedding("demo", "main.sw", []float32{1, 0})
+
+	// lib/ is removed and util.sw moves to the root.
+	s.SaveSnapshot("demo", filesToTree(map[string]string{
+		"main.sw": "andika(\"hello\")",
+		"util.sw": "kazi util() {}",
+	}), SaveOptions{})
+
+	files, _, _ := s.ListFiles("demo", FileQuery{})
+	if len(files) != 2 || files[0].Path != "main.sw" || files[1].Path != "util.sw" {
+		t.Errorf("ListFiles() after rename = %+v", files)
+	}
+	if _, err := s.GetEmbedding("demo", "main.sw"); err != nil {
+		t.Errorf("embedding of unchanged file was dropped: %v", err)
+	}
+}
+
+func TestRepairSplitRows(t *testing.T) {
+	s, _ := newLocalStore(t.TempDir())
+	store = s
+	t.Cleanup(func() { store = nil })
+	s.SaveSnapshot("demo", sampleTree(), SaveOptions{})
+
+	// Simulate drift left behind by older servers.
+	s.SyncFiles("demo", filesToTree(map[string]string{"main.sw": "old", "gone.sw": "x", "lib/util.sw": "kazi util() {}"}))
+
+	written, deleted, failed := repairSplitRows([]string{"demo", "missing"})
+	if written != 1 || deleted != 1 || failed != 1 {
+		t.Errorf("repairSplitRows() = %d written, %d deleted, %d failed; want 1, 1, 1", written, deleted, failed)
+	}
+	files, _, _ := s.ListFiles("demo", FileQuery{})
+	if len(files) != 3 {
+		t.Errorf("ListFiles() after repair = %+v", files)
+	}
+	if w, d, _ := s.SyncFiles("demo", sampleTree()); w != 0 || d != 0 {
+		t.Errorf("second sync = %d written, %d deleted; want no changes", w, d)
+	}
+}
+
+func TestLocalStoreConditionalSave(t *testing.T) {
+	s, _ := newLocalStore(t.TempDir())
+	first, _ := s.SaveSnapshot("demo", sampleTree(), SaveOptions{})
+	second, err := s.SaveSnapshot("demo", sampleTree(), SaveOptions{BaseVersion: first.LastVersion})
+	if err != nil {
+		t.Fatalf("SaveSnapshot(current base) error = %v", err)
+	}
+	_, err = s.SaveSnapshot("demo", sampleTree(), SaveOptions{BaseVersion: first.LastVersion})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.CurrentVersion != second.LastVersion {
+		t.Errorf("SaveSnapshot(stale base) error = %v, want conflict with %s", err, second.LastVersion)
+	}
+	if _, err := s.SaveSnapshot("new", sampleTree(), SaveOptions{BaseVersion: first.LastVersion}); !errors.As(err, &conflict) {
+		t.Errorf("SaveSnapshot(new project with base) error = %v, want conflict", err)
+	}
+}
+
+func TestLocalStoreCompressesLargeManifests(t *testing.T) {
+	old := snapshotChunkThreshold
+	snapshotChunkThreshold = 64
+	t.Cleanup(func() { snapshotChunkThreshold = old })
+
+	s, _ := newLocalStore(t.TempDir())
+	meta, err := s.SaveSnapshot("demo", sampleTree(), SaveOptions{})
+	if err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(s.projectDir("demo"), "snapshots", meta.LastVersion+".manifest.json.gz")); err != nil {
+		t.Errorf("compressed manifest missing: %v", err)
+	}
+	tree, err := s.LoadSnapshot("demo", nil)
+	if err != nil || !reflect.DeepEqual(tree, sampleTree()) {
+		t.Errorf("LoadSnapshot() = %v, %v", tree, err)
+	}
+}
+
+func TestLocalStoreDedupsBlobs(t *testing.T) {
+	s, _ := newLocalStore(t.TempDir())
+	big := strings.Repeat("swalang ", 1000)
+	for i := 0; i < 3; i++ {
+		s.SaveSnapshot("demo", filesToTree(map[string]string{"data.txt": big, "main.sw": strings.Repeat("x", i)}), SaveOptions{})
+	}
+	blobs, _ := os.ReadDir(filepath.Join(s.projectDir("demo"), "blobs"))
+	if len(blobs) != 4 {
+		t.Errorf("stored %d blobs, want 4 (data.txt once, main.sw three times)", len(blobs))
+	}
+
+	// Versions written before blobs existed hold the full tree.
+	legacy := "00000000-0000-1000-8000-000000000000"
+	writeJSONFile(filepath.Join(s.projectDir("demo"), "snapshots", legacy+".json"), sampleTree())
+	v, _ := gocql.ParseUUID(legacy)
+	if tree, err := s.LoadSnapshot("demo", &v); err != nil || !reflect.DeepEqual(tree, sampleTree()) {
+		t.Errorf("LoadSnapshot(legacy) = %v, %v", tree, err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/* ============ PROJECT TRASH ============ */
+
+// trashRetention is how long a deleted project can be restored before the
+// GC purges it.
+var trashRetention = time.Duration(envInt("RETENTION_TRASH_DAYS", 30)) * 24 * time.Hour
+
+func purgeAfter(deletedAt time.Time) time.Time {
+	return deletedAt.Add(trashRetention)
+}
+
+// routeProjectID returns the project a request addresses, or "" for routes
+// that are not about a single project.
+func routeProjectID(c *gin.Context) string {
+	switch {
+	case strings.HasPrefix(c.FullPath(), "/api/projects/:id"):
+		return c.Param("id")
+	case strings.HasPrefix(c.FullPath(), "/ws/:projectId"):
+		return c.Param("projectId")
+	case c.FullPath() == "/api/session/:id/save":
+		return c.Query("project")
+	}
+	return ""
+}
+
+// deleteProject serves DELETE /api/projects/:id. The project moves to the
+// trash: it disappears from every route until it is restored, and the GC
+// purges it once RETENTION_TRASH_DAYS have passed. If-Match makes the
+// delete conditional on the latest version.
+func deleteProject(c *gin.Context) {
+	projID := c.Param("id")
+	meta, err := store.GetMeta(projID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	if base := baseVersionOf(c, ""); base != "" && base != meta.LastVersion {
+		respondConflict(c, projID, base, meta.LastVersion)
+		return
+	}
+	now := time.Now().UTC()
+	if err := store.SetDeleted(projID, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	snapshotCache.Delete(projID + "@latest")
+	broadcast(projID, map[string]interface{}{"type": "deleted", "deletedAt": now})
+	c.JSON(http.StatusOK, gin.H{"projectId": projID, "deletedAt": now, "purgeAfter": purgeAfter(now)})
+}
+
+// undeleteProject serves POST /api/projects/:id/undelete, which takes a
+// project out of the trash. It is the one route open to trashed projects.
+func undeleteProject(c *gin.Context) {
+	projID := c.Param("id")
+	meta, ok := checkAccess(c, projID, roleAdmin)
+	if !ok {
+		return
+	}
+	if meta.LastVersion == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	if meta.DeletedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "project is not deleted"})
+		return
+	}
+	if err := store.SetDeleted(projID, time.Time{}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	meta.DeletedAt = nil
+	c.JSON(http.StatusOK, meta)
+}
+
+// purgeExpired purges a project whose trash period is over and reports
+// whether it did (or, in a dry run, would).
+func purgeExpired(meta ProjectMeta, now time.Time, dryRun bool) (bool, error) {
+	if meta.DeletedAt == nil || now.Before(purgeAfter(*meta.DeletedAt)) {
+		return false, nil
+	}
+	if dryRun {
+		return true, nil
+	}
+	if err := store.PurgeProject(meta.ProjectID); err != nil && !errors.Is(err, errNotFound) {
+		return false, err
+	}
+	snapshotCache.Range(func(key, _ interface{}) bool {
+		if strings.HasPrefix(key.(string), meta.ProjectID+"@") {
+			snapshotCache.Delete(key)
+		}
+		return true
+	})
+	return true, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestProjectTrash(t *testing.T) {
+	r := newTestRouter(t)
+	t.Setenv("ADMIN_TOKEN", "secret")
+	admin := http.Header{"Authorization": {"Bearer secret"}}
+	var saved struct {
+		Version string `json:"version"`
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodPost, "/api/projects/demo", gin.H{"tree": sampleTree()}), &saved)
+	doJSON(t, r, http.MethodPost, "/api/projects/other", gin.H{"tree": sampleTree()})
+
+	if w := doJSONWithHeader(t, r, http.MethodDelete, "/api/projects/demo", nil, http.Header{"If-Match": {`"00000000-0000-1000-8000-000000000000"`}}); w.Code != http.StatusConflict {
+		t.Errorf("DELETE with stale If-Match = %d, want 409", w.Code)
+	}
+	if w := doJSONWithHeader(t, r, http.MethodDelete, "/api/projects/demo", nil, http.Header{"If-Match": {projectETag(saved.Version)}}); w.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s", w.Code, w.Body)
+	}
+	for _, req := range [][2]string{
+		{http.MethodGet, "/api/projects/demo"},
+		{http.MethodGet, "/api/projects/demo/files/main.sw"},
+		{http.MethodPost, "/api/projects/demo"},
+		{http.MethodDelete, "/api/projects/demo"},
+	} {
+		w := doJSON(t, r, req[0], req[1], gin.H{"tree": sampleTree()})
+		var res struct {
+			Code string `json:"code"`
+		}
+		decodeJSON(t, w, &res)
+		if w.Code != http.StatusNotFound || res.Code != "project_deleted" {
+			t.Errorf("%s %s on deleted project = %d %s", req[0], req[1], w.Code, w.Body)
+		}
+	}
+
+	var list struct {
+		Projects []ProjectMeta `json:"projects"`
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodGet, "/api/projects", nil), &list)
+	if len(list.Projects) != 1 || list.Projects[0].ProjectID != "other" {
+		t.Errorf("projects = %+v, want only other", list.Projects)
+	}
+	decodeJSON(t, doJSON(t, r, http.MethodGet, "/api/projects?deleted=true", nil), &list)
+	if len(list.Projects) != 1 || list.Projects[0].ProjectID != "demo" || list.Projects[0].DeletedAt == nil {
+		t.Errorf("trash = %+v, want demo", list.Projects)
+	}
+
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo/undelete", nil); w.Code != http.StatusOK {
+		t.Fatalf("undelete = %d %s", w.Code, w.Body)
+	}
+	if w := doJSON(t, r, http.MethodPost, "/api/projects/demo/undelete", nil); w.Code != http.StatusConflict {
+		t.Errorf("second undelete = %d, want 409", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/projects/demo/files/main.sw", nil); w.Code != http.StatusOK {
+		t.Errorf("GET after undelete = %d %s", w.Code, w.Body)
+	}
+
+	// Purging waits for the trash period.
+	doJSON(t, r, http.MethodDelete, "/api/projects/demo", nil)
+	var res struct {
+		Projects []GCReport `json:"projects"`
+	}
+	decodeJSON(t, doJSONWithHeader(t, r, http.MethodPost, "/api/admin/gc?project=demo", nil, admin), &res)
+	if len(res.Projects) != 1 || res.Projects[0].Purged {
+		t.Fatalf("GC within the trash period = %+v", res.Projects)
+	}
+	defer func(d time.Duration) { trashRetention = d }(trashRetention)
+	trashRetention = 0
+	decodeJSON(t, doJSONWithHeader(t, r, http.MethodGet, "/api/admin/gc?project=demo", nil, admin), &res)
+	if _, err := store.GetMeta("demo"); len(res.Projects) != 1 || !res.Projects[0].Purged || err != nil {
+		t.Fatalf("dry run = %+v, meta error %v", res.Projects, err)
+	}
+	decodeJSON(t, doJSONWithHeader(t, r, http.MethodPost, "/api/admin/gc", nil, admin), &res)
+	if len(res.Projects) != 2 || !res.Projects[0].Purged && !res.Projects[1].Purged {
+		t.Fatalf("GC = %+v", res.Projects)
+	}
+	if _, err := store.GetMeta("demo"); err == nil {
+		t.Error("purged project still has metadata")
+	}
+	if files, _, _ := store.ListFiles("demo", FileQuery{}); len(files) != 0 {
+		t.Errorf("purged project still has %d split rows", len(files))
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/projects/demo", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET purged project = %d, want 404", w.Code)
+	}
+}
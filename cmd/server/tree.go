@@ -0,0 +1,196 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+/* ---------- Flat <-> Tree Conversion ---------- */
+
+// filesToTree builds a FileSystemNode tree from a flat path -> content map.
+// Intermediate folders are created as needed; node IDs are the full paths,
+// matching what the frontend IDE generates.
+func filesToTree(files map[string]string) []FileSystemNode {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var root []FileSystemNode
+	for _, p := range paths {
+		root = insertFile(root, "", strings.Split(p, "/"), files[p])
+	}
+	sortTree(root)
+	return root
+}
+
+func insertFile(nodes []FileSystemNode, prefix string, parts []string, content string) []FileSystemNode {
+	name := parts[0]
+	p := path.Join(prefix, name)
+	if len(parts) == 1 {
+		return append(nodes, FileSystemNode{ID: p, Name: name, Type: "file", Content: content})
+	}
+	for i := range nodes {
+		if nodes[i].Name == name && nodes[i].Type == "folder" {
+			nodes[i].Children = insertFile(nodes[i].Children, p, parts[1:], content)
+			return nodes
+		}
+	}
+	folder := FileSystemNode{ID: p, Name: name, Type: "folder", IsFolder: true}
+	folder.Children = insertFile(nil, p, parts[1:], content)
+	return append(nodes, folder)
+}
+
+// sortTree orders folders before files, then by name, at every level.
+func sortTree(nodes []FileSystemNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		fi, fj := nodes[i].Type == "folder", nodes[j].Type == "folder"
+		if fi != fj {
+			return fi
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+	for i := range nodes {
+		if nodes[i].Type == "folder" {
+			sortTree(nodes[i].Children)
+		}
+	}
+}
+
+// treeToFiles flattens a tree into a path -> content map of its files.
+func treeToFiles(nodes []FileSystemNode, prefix string) map[string]string {
+	files := make(map[string]string)
+	collectFiles(nodes, prefix, files)
+	return files
+}
+
+func collectFiles(nodes []FileSystemNode, prefix string, files map[string]string) {
+	for _, n := range nodes {
+		p := path.Join(prefix, n.Name)
+		if n.Type == "folder" {
+			collectFiles(n.Children, p, files)
+			continue
+		}
+		files[p] = n.Content
+	}
+}
+
+// treePaths returns the paths of every file and folder in a tree.
+func treePaths(nodes []FileSystemNode, prefix string) map[string]bool {
+	paths := make(map[string]bool)
+	for _, n := range flattenTree(nodes, prefix) {
+		paths[n.ID] = true
+	}
+	return paths
+}
+
+// findNode returns the file or folder at p, or nil.
+func findNode(nodes []FileSystemNode, p string) *FileSystemNode {
+	head, tail, nested := strings.Cut(p, "/")
+	for i := range nodes {
+		if nodes[i].Name != head {
+			continue
+		}
+		if !nested {
+			return &nodes[i]
+		}
+		if nodes[i].Type == "folder" {
+			return findNode(nodes[i].Children, tail)
+		}
+	}
+	return nil
+}
+
+// fileAncestor returns the path of the first parent folder of p that is a
+// file in nodes, or "" if there is none.
+func fileAncestor(nodes []FileSystemNode, p string) string {
+	parts := strings.Split(p, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		if n := findNode(nodes, dir); n == nil {
+			return ""
+		} else if n.Type != "folder" {
+			return dir
+		}
+	}
+	return ""
+}
+
+// removeNode returns nodes without the file or folder at p. The bool reports
+// whether anything was removed.
+func removeNode(nodes []FileSystemNode, p string) ([]FileSystemNode, bool) {
+	head, tail, nested := strings.Cut(p, "/")
+	for i := range nodes {
+		if nodes[i].Name != head {
+			continue
+		}
+		if !nested {
+			return append(nodes[:i:i], nodes[i+1:]...), true
+		}
+		if nodes[i].Type != "folder" {
+			return nodes, false
+		}
+		children, ok := removeNode(nodes[i].Children, tail)
+		if ok {
+			out := append([]FileSystemNode(nil), nodes...)
+			out[i].Children = children
+			return out, true
+		}
+		return nodes, false
+	}
+	return nodes, false
+}
+
+// putNode places node at p, replacing whatever is there and creating missing
+// parent folders. IDs below p are rewritten to match the new location.
+func putNode(nodes []FileSystemNode, p string, node FileSystemNode) []FileSystemNode {
+	return putNodeAt(nodes, "", strings.Split(p, "/"), node)
+}
+
+func putNodeAt(nodes []FileSystemNode, prefix string, parts []string, node FileSystemNode) []FileSystemNode {
+	name := parts[0]
+	p := path.Join(prefix, name)
+	out := append([]FileSystemNode(nil), nodes...)
+	if len(parts) == 1 {
+		node.Name = name
+		node = withIDs(node, prefix)
+		for i := range out {
+			if out[i].Name == name {
+				out[i] = node
+				return out
+			}
+		}
+		out = append(out, node)
+		sortTree(out)
+		return out
+	}
+	for i := range out {
+		if out[i].Name == name {
+			if out[i].Type != "folder" {
+				// A file is in the way; the folder replaces it.
+				out[i] = FileSystemNode{ID: p, Name: name, Type: "folder", IsFolder: true}
+			}
+			out[i].Children = putNodeAt(out[i].Children, p, parts[1:], node)
+			return out
+		}
+	}
+	folder := FileSystemNode{ID: p, Name: name, Type: "folder", IsFolder: true}
+	folder.Children = putNodeAt(nil, p, parts[1:], node)
+	out = append(out, folder)
+	sortTree(out)
+	return out
+}
+
+func withIDs(n FileSystemNode, prefix string) FileSystemNode {
+	n.ID = path.Join(prefix, n.Name)
+	if n.Type == "folder" {
+		children := make([]FileSystemNode, len(n.Children))
+		for i, c := range n.Children {
+			children[i] = withIDs(c, n.ID)
+		}
+		n.Children = children
+	}
+	return n
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilesToTreeRoundTrip(t *testing.T) {
+	files := map[string]string{
+		"main.sw":          "andika(\"hello\")",
+		"lib/util.sw":      "util",
+		"lib/deep/more.sw": "more",
+		"README.md":        "",
+	}
+	tree := filesToTree(files)
+
+	if len(tree) != 3 {
+		t.Fatalf("filesToTree() produced %d root nodes, want 3", len(tree))
+	}
+	if tree[0].Name != "lib" || tree[0].Type != "folder" || !tree[0].IsFolder {
+		t.Errorf("first root node = %+v, want folder lib", tree[0])
+	}
+	if tree[0].Children[0].ID != "lib/deep" {
+		t.Errorf("nested folder ID = %q, want %q", tree[0].Children[0].ID, "lib/deep")
+	}
+	if f := findFileInTree(tree, "lib/deep/more.sw"); f == nil || f.Content != "more" {
+		t.Errorf("findFileInTree(lib/deep/more.sw) = %+v", f)
+	}
+
+	if got := treeToFiles(tree, ""); !reflect.DeepEqual(got, files) {
+		t.Errorf("treeToFiles() = %v, want %v", got, files)
+	}
+}
+
+func TestPutAndRemoveNode(t *testing.T) {
+	tree := filesToTree(map[string]string{"main.sw": "main", "lib/util.sw": "util"})
+
+	tree = putNode(tree, "lib/deep/more.sw", FileSystemNode{Type: "file", Content: "more"})
+	if f := findNode(tree, "lib/deep/more.sw"); f == nil || f.ID != "lib/deep/more.sw" || f.Content != "more" {
+		t.Errorf("putNode new file = %+v", f)
+	}
+	tree = putNode(tree, "main.sw", FileSystemNode{Type: "file", Content: "changed"})
+	if f := findNode(tree, "main.sw"); f == nil || f.Content != "changed" {
+		t.Errorf("putNode replace = %+v", f)
+	}
+
+	lib := *findNode(tree, "lib")
+	tree = putNode(tree, "pkg/lib", lib)
+	if f := findNode(tree, "pkg/lib/deep/more.sw"); f == nil || f.ID != "pkg/lib/deep/more.sw" {
+		t.Errorf("putNode folder IDs = %+v", f)
+	}
+
+	tree, ok := removeNode(tree, "lib")
+	if !ok || findNode(tree, "lib/util.sw") != nil {
+		t.Errorf("removeNode(lib) = %v", ok)
+	}
+	if _, ok := removeNode(tree, "missing/file.sw"); ok {
+		t.Error("removeNode(missing) reported a removal")
+	}
+
+	paths := treePaths(tree, "")
+	for _, p := range []string{"main.sw", "pkg", "pkg/lib", "pkg/lib/util.sw"} {
+		if !paths[p] {
+			t.Errorf("treePaths missing %s", p)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+/* ============ VERSION HISTORY ============ */
+
+// getVersions serves GET /api/projects/:id/versions?limit=&cursor=.
+func getVersions(c *gin.Context) {
+	projID := c.Param("id")
+	limit, ok := queryInt(c, "limit", defaultListLimit)
+	if !ok || limit == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	versions, next, err := store.ListVersions(projID, limit, c.Query("cursor"))
+	switch {
+	case errors.Is(err, errInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if versions == nil {
+		versions = []VersionInfo{}
+	}
+	resp := gin.H{"projectId": projID, "versions": versions}
+	if next != "" {
+		resp["nextCursor"] = next
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// getSnapshot serves GET /api/projects/:id/snapshots/:version.
+func getSnapshot(c *gin.Context) {
+	projID := c.Param("id")
+	versionUUID, err := gocql.ParseUUID(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version UUID format"})
+		return
+	}
+	tree := loadFatWithCache(projID, &versionUUID)
+	if tree == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project or version not found"})
+		return
+	}
+	raw, _ := json.Marshal(tree)
+	c.JSON(http.StatusOK, gin.H{"projectId": projID, "version": versionUUID.String(), "size": len(raw), "tree": tree})
+}
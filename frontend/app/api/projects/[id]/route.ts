@@ -1,6 +1,6 @@
 import { NextRequest, NextResponse } from "next/server";
 import createSupabaseServerClient from "@/lib/supabase/server";
-import { ASTRA_API } from "@/lib/astra";
+import { ASTRA_API, authHeaders } from "@/lib/astra";
 
 export async function POST(req: NextRequest, { params }: { params: { id: string } }) {
   const projectId = params.id;
@@ -9,6 +9,9 @@ export async function POST(req: NextRequest, { params }: { params: { id: string
   const {
     data: { user },
   } = await supabase.auth.getUser();
+  const {
+    data: { session },
+  } = await supabase.auth.getSession();
 
   if (!user) {
     return NextResponse.json({ error: "Unauthorized" }, { status: 401 });
@@ -35,7 +38,7 @@ export async function POST(req: NextRequest, { params }: { params: { id: string
     // 2. Save the new snapshot to Astra via Go API
     const astraResponse = await fetch(`${ASTRA_API}/api/projects/${projectId}`, {
       method: "POST",
-      headers: { "Content-Type": "application/json" },
+      headers: { "Content-Type": "application/json", ...(await authHeaders(session?.access_token)) },
       body: JSON.stringify({ tree }),
     });
 
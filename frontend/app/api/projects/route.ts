@@ -1,13 +1,16 @@
 import { NextRequest, NextResponse } from "next/server";
 import createSupabaseServerClient from "@/lib/supabase/server";
 import { initialFileSystem } from "@/lib/constants";
-import { ASTRA_API } from "@/lib/astra";
+import { ASTRA_API, authHeaders } from "@/lib/astra";
 
 export async function POST(req: NextRequest) {
   const supabase = await createSupabaseServerClient();
   const {
     data: { user },
   } = await supabase.auth.getUser();
+  const {
+    data: { session },
+  } = await supabase.auth.getSession();
 
   if (!user) {
     return NextResponse.json({ error: "Unauthorized" }, { status: 401 });
@@ -41,7 +44,7 @@ export async function POST(req: NextRequest) {
     // 2. Save initial snapshot to Astra via Go API using the new UUID
     const astraResponse = await fetch(`${ASTRA_API}/api/projects/${newProjectId}`, {
       method: "POST",
-      headers: { "Content-Type": "application/json" },
+      headers: { "Content-Type": "application/json", ...(await authHeaders(session?.access_token)) },
       body: JSON.stringify({ tree: initialFileSystem }),
     });
 
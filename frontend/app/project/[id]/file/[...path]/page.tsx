@@ -3,6 +3,7 @@ import { notFound } from "next/navigation";
 import FileIDEView from "@/components/FileIDEView";
 import type { GetProjectResponse } from "@/lib/types";
 import createSupabaseServerClient from "@/lib/supabase/server";
+import getUserSession from "@/lib/getUserSession";
 
 export async function generateMetadata({ 
     params, 
@@ -62,10 +63,13 @@ export default async function FilePage({
   const path = params.path.join("/");
   const version = searchParams?.version;
   
+  const { data: { session } } = await getUserSession();
+  const token = session?.access_token;
+
   try {
     const [project, content] = await Promise.all([
-      getProject(params.id, version),
-      getFileContent(params.id, path, version)
+      getProject(params.id, version, token),
+      getFileContent(params.id, path, version, token)
     ]);
 
     if (!project || content === null) {
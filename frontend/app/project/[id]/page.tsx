@@ -4,6 +4,7 @@ import ProjectIDE from "@/components/ProjectIDE";
 import type { FileSystemNode as FrontendFileSystemNode } from '@/lib/types';
 import type { FileSystemNode as ApiFileSystemNode } from "@/lib/astra";
 import createSupabaseServerClient from "@/lib/supabase/server";
+import getUserSession from "@/lib/getUserSession";
 
 export async function generateMetadata({ params, searchParams }: { params: { id: string }, searchParams?: { version?: string } }) {
   const supabase = await createSupabaseServerClient();
@@ -66,7 +67,8 @@ export default async function ProjectPage({
 }) {
   const version = searchParams?.version as string | undefined;
 
-  const project = await getProject(params.id, version).catch((err) => {
+  const { data: { session } } = await getUserSession();
+  const project = await getProject(params.id, version, session?.access_token).catch((err) => {
     console.error(`Failed to fetch project ${params.id} (Version: ${version || 'latest'}):`, err);
     return null;
   });
@@ -21,16 +21,16 @@ const buildTreeFromSplitList = (apiNodes: any[]): FileSystemNode[] => {
     const map = new Map<string, FileSystemNode>();
     
     // Ensure nodes are sorted by path depth to build parent directories first
-    const sortedNodes = (apiNodes || []).sort((a, b) => (a.id || a.name).localeCompare(b.id || b.name));
+    const sortedNodes = (apiNodes || []).sort((a, b) => (a.path || a.id || a.name).localeCompare(b.path || b.id || b.name));
     
     sortedNodes.forEach(node => {
-        const path = node.id || node.name;
+        const path = node.path || node.id || node.name;
         const parts = path.split('/');
         const fileName = parts[parts.length - 1];
         const parentPath = parts.slice(0, -1).join('/');
 
         let newNode: FileSystemNode;
-        if (node.isFolder) {
+        if (node.isFolder || node.type === 'folder') {
             newNode = { id: path, name: fileName, type: 'folder', children: [] };
         } else {
             newNode = { id: path, name: fileName, type: 'file', content: '' };
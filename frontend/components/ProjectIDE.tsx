@@ -52,7 +52,7 @@ const buildTreeFromSplitList = (apiNodes: ApiFileSystemNode[]): FileSystemNode[]
   const map = new Map<string, FileSystemNode>([['', root]]);
 
   apiNodes.forEach(node => {
-    const path = node.name;
+    const path = node.path || node.name;
     const parts = path.split('/');
     let currentParentPath = '';
     
@@ -70,7 +70,7 @@ const buildTreeFromSplitList = (apiNodes: ApiFileSystemNode[]): FileSystemNode[]
   });
 
   apiNodes.forEach(node => {
-    const path = node.name;
+    const path = node.path || node.name;
     const parts = path.split('/');
     const fileName = parts[parts.length - 1];
     const parentPath = parts.slice(0, -1).join('/');
@@ -78,7 +78,7 @@ const buildTreeFromSplitList = (apiNodes: ApiFileSystemNode[]): FileSystemNode[]
 
     if (!map.has(path)) {
         let newNode: FileSystemNode;
-        if (node.isFolder) {
+        if (node.isFolder || node.type === 'folder') {
             newNode = { id: path, name: fileName, type: 'folder', children: [] };
         } else {
             newNode = { id: path, name: fileName, type: 'file', content: '' };
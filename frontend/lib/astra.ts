@@ -1,5 +1,22 @@
+import { getSupabaseBrowserClient } from "./supabase/client";
+
 export const ASTRA_API = process.env.NEXT_PUBLIC_API_BASE || "http://localhost:8080";
 
+/**
+ * The signed-in user's Supabase access token. In the browser it comes from
+ * the current session; on the server, callers pass the token of the request.
+ */
+async function accessToken(token?: string): Promise<string | undefined> {
+  if (token || typeof window === "undefined") return token;
+  const { data } = await getSupabaseBrowserClient().auth.getSession();
+  return data.session?.access_token;
+}
+
+export async function authHeaders(token?: string): Promise<Record<string, string>> {
+  const t = await accessToken(token);
+  return t ? { Authorization: `Bearer ${t}` } : {};
+}
+
 export interface FileSystemNode {
   id: string;
   name: string;
@@ -7,9 +24,11 @@ export interface FileSystemNode {
   content?: string;
   children?: FileSystemNode[];
   isFolder?: boolean;
+  path?: string; // split listings
+  size?: number;
 }
 
-export async function getProject(id: string, version?: string): Promise<{
+export async function getProject(id: string, version?: string, token?: string): Promise<{
   strategy: "fat" | "split";
   size: number;
   tree?: FileSystemNode[];
@@ -20,19 +39,29 @@ export async function getProject(id: string, version?: string): Promise<{
     ? `${ASTRA_API}/api/projects/${id}?version=${version}`
     : `${ASTRA_API}/api/projects/${id}`;
 
-  const res = await fetch(url, { cache: 'no-store' }); // Use no-store to ensure fresh data for versions
+  const headers = await authHeaders(token);
+  const res = await fetch(url, { cache: 'no-store', headers }); // Use no-store to ensure fresh data for versions
   if (!res.ok) throw new Error("Project not found");
   
   const data = await res.json();
+  // Split listings are paginated; fetch the remaining pages.
+  let cursor: string | undefined = data.nextCursor;
+  while (data.strategy === "split" && cursor) {
+    const page = await fetch(`${ASTRA_API}/api/projects/${id}/files?cursor=${encodeURIComponent(cursor)}`, { cache: 'no-store', headers });
+    if (!page.ok) throw new Error("Project not found");
+    const next = await page.json();
+    data.files = [...(data.files || []), ...next.files];
+    cursor = next.nextCursor;
+  }
   return data;
 }
 
-export async function getFileContent(projectId: string, path: string, version?: string): Promise<string> {
+export async function getFileContent(projectId: string, path: string, version?: string, token?: string): Promise<string> {
   const url = version
     ? `${ASTRA_API}/api/projects/${projectId}/files/${path}?version=${version}`
     : `${ASTRA_API}/api/projects/${projectId}/files/${path}`;
     
-  const res = await fetch(url, { cache: 'no-store' });
+  const res = await fetch(url, { cache: 'no-store', headers: await authHeaders(token) });
   if (!res.ok) throw new Error("File not found");
   return res.text();
 }
@@ -51,7 +80,7 @@ export async function saveProject(id: string, tree: FileSystemNode[]): Promise<a
 }
 
 export async function indexProject(id: string): Promise<{ jobId: string }> {
-  const res = await fetch(`${ASTRA_API}/api/projects/${id}/index`, { method: "POST" });
+  const res = await fetch(`${ASTRA_API}/api/projects/${id}/index`, { method: "POST", headers: await authHeaders() });
   return res.json();
 }
 
@@ -61,7 +90,7 @@ export async function searchSimilar(
 ): Promise<SimilarResult[]> {
   const res = await fetch(`${ASTRA_API}/api/search/similar`, {
     method: "POST",
-    headers: { "Content-Type": "application/json" },
+    headers: { "Content-Type": "application/json", ...(await authHeaders()) },
     body: JSON.stringify({ projectId, ...query, limit: query.limit || 10 }),
   });
   const data = await res.json();
@@ -74,8 +103,14 @@ export interface SimilarResult {
   similarity: number;
 }
 
-export function websocket(projectId: string, onUpdate: (data: any) => void) {
-  const ws = new WebSocket(`ws://localhost:8080/ws/${projectId}`);
+/**
+ * Opens the project's update stream. Browsers cannot set headers on a
+ * WebSocket, so the access token travels as the second subprotocol.
+ */
+export async function websocket(projectId: string, onUpdate: (data: any) => void) {
+  const token = await accessToken();
+  const url = `${ASTRA_API.replace(/^http/, "ws")}/ws/${projectId}`;
+  const ws = token ? new WebSocket(url, ["bearer", token]) : new WebSocket(url);
   ws.onmessage = (e) => onUpdate(JSON.parse(e.data));
   return ws;
 }
@@ -87,11 +122,11 @@ export function websocket(projectId: string, onUpdate: (data: any) => void) {
  */
 export async function getSnapshotFromAstra(
   projectId: string,
-  userId: string,
-  astraSnapshotVersion: string
+  astraSnapshotVersion: string,
+  token?: string
 ): Promise<{ tree: FileSystemNode[] }> {
   const res = await fetch(`${ASTRA_API}/api/projects/${projectId}/snapshots/${astraSnapshotVersion}`, {
-    headers: { "X-User-Id": userId },
+    headers: await authHeaders(token),
   });
   if (!res.ok) {
     if (res.status === 404) return { tree: [] };
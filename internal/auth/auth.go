@@ -0,0 +1,235 @@
+// Package auth verifies the JSON Web Tokens Supabase issues. Verification is
+// offline: HS256 tokens are checked against the project's JWT secret and
+// RS256/ES256 tokens against public keys from a JWKS document.
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrSignature = errors.New("invalid signature")
+	ErrExpired   = errors.New("token expired")
+	ErrClaims    = errors.New("token not accepted")
+)
+
+// Claims are the claims of a Supabase access token the API uses.
+type Claims struct {
+	Subject     string                 `json:"sub"`
+	Role        string                 `json:"role"` // "anon", "authenticated" or "service_role"
+	Email       string                 `json:"email,omitempty"`
+	Issuer      string                 `json:"iss"`
+	Audience    Audience               `json:"aud"`
+	ExpiresAt   int64                  `json:"exp"`
+	NotBefore   int64                  `json:"nbf,omitempty"`
+	IssuedAt    int64                  `json:"iat,omitempty"`
+	AppMetadata map[string]interface{} `json:"app_metadata,omitempty"`
+}
+
+// Audience is the "aud" claim, which is a string or an array of strings.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = Audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (a Audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier checks token signatures and claims.
+type Verifier struct {
+	Issuer   string        // required "iss" when set
+	Audience string        // required in "aud" when set
+	Leeway   time.Duration // clock skew allowed for "exp" and "nbf"
+
+	secret []byte
+	keys   []jwk
+	now    func() time.Time
+}
+
+// NewVerifier returns a verifier for HS256 tokens signed with secret and
+// for RS256/ES256 tokens signed by a key in the JWKS document jwks. Either
+// may be empty, but not both.
+func NewVerifier(secret, jwks []byte) (*Verifier, error) {
+	v := &Verifier{secret: secret, Leeway: 30 * time.Second, now: time.Now}
+	if len(jwks) > 0 {
+		var err error
+		if v.keys, err = parseJWKS(jwks); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.secret) == 0 && len(v.keys) == 0 {
+		return nil, errors.New("auth: neither a JWT secret nor JWKS keys are configured")
+	}
+	return v, nil
+}
+
+type jwk struct {
+	kid string
+	alg string // "RS256" or "ES256"
+	key crypto.PublicKey
+}
+
+// parseJWKS reads the RSA and P-256 signing keys of a JWKS document. Keys of
+// other types are skipped.
+func parseJWKS(data []byte) ([]jwk, error) {
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("auth: invalid JWKS: %w", err)
+	}
+	var keys []jwk
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.Kty == "RSA":
+			n, err1 := decodeBigInt(k.N)
+			e, err2 := decodeBigInt(k.E)
+			if err1 != nil || err2 != nil || !e.IsInt64() {
+				return nil, fmt.Errorf("auth: invalid RSA key %q", k.Kid)
+			}
+			keys = append(keys, jwk{kid: k.Kid, alg: "RS256", key: &rsa.PublicKey{N: n, E: int(e.Int64())}})
+		case k.Kty == "EC" && k.Crv == "P-256":
+			x, err1 := decodeBigInt(k.X)
+			y, err2 := decodeBigInt(k.Y)
+			if err1 != nil || err2 != nil || !elliptic.P256().IsOnCurve(x, y) {
+				return nil, fmt.Errorf("auth: invalid EC key %q", k.Kid)
+			}
+			keys = append(keys, jwk{kid: k.Kid, alg: "ES256", key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}})
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("auth: JWKS has no RSA or P-256 signing keys")
+	}
+	return keys, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, ErrMalformed
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Verify checks the signature, expiry and the configured issuer and audience
+// of token, and returns its claims.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if !v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], sig) {
+		return nil, ErrSignature
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	now := v.now()
+	switch {
+	case claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(v.Leeway)):
+		return nil, ErrExpired
+	case claims.NotBefore != 0 && now.Add(v.Leeway).Before(time.Unix(claims.NotBefore, 0)):
+		return nil, fmt.Errorf("%w: not valid yet", ErrClaims)
+	case v.Issuer != "" && claims.Issuer != v.Issuer:
+		return nil, fmt.Errorf("%w: issuer %q", ErrClaims, claims.Issuer)
+	case v.Audience != "" && !claims.Audience.contains(v.Audience):
+		return nil, fmt.Errorf("%w: audience %q", ErrClaims, claims.Audience)
+	}
+	return &claims, nil
+}
+
+// verifySignature only accepts the algorithm that belongs to each key, so a
+// public key can never be used as an HMAC secret.
+func (v *Verifier) verifySignature(alg, kid, signed string, sig []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+	if alg == "HS256" {
+		if len(v.secret) == 0 {
+			return false
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signed))
+		return hmac.Equal(sig, mac.Sum(nil))
+	}
+	for _, k := range v.keys {
+		if k.alg != alg || (kid != "" && k.kid != kid) {
+			continue
+		}
+		switch key := k.key.(type) {
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil {
+				return true
+			}
+		case *ecdsa.PublicKey:
+			if len(sig) == 64 && ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrMalformed
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return ErrMalformed
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding
+
+// sign builds a token with the given header fields and claims.
+func sign(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	body, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(body)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, k, digest[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func TestVerify(t *testing.T) {
+	secret := []byte("super-secret-jwt-token")
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": %q, "e": %q},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "oct", "kid": "skipped", "k": "c2VjcmV0"}
+	]}`, b64.EncodeToString(rsaKey.N.Bytes()), b64.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+		b64.EncodeToString(ecKey.X.Bytes()), b64.EncodeToString(ecKey.Y.Bytes()))
+
+	v, err := NewVerifier(secret, []byte(jwks))
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	v.now = func() time.Time { return now }
+	v.Issuer, v.Audience = "https://demo.supabase.co/auth/v1", "authenticated"
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"sub": "user-1", "role": "authenticated", "iss": v.Issuer, "aud": "authenticated", "exp": now.Unix() + 3600}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	for name, token := range map[string]string{
+		"HS256": sign(t, "HS256", "", secret, claims(nil)),
+		"RS256": sign(t, "RS256", "rsa-1", rsaKey, claims(nil)),
+		"ES256": sign(t, "ES256", "ec-1", ecKey, claims(map[string]interface{}{"aud": []string{"authenticated", "other"}})),
+	} {
+		c, err := v.Verify(token)
+		if err != nil || c.Subject != "user-1" || c.Role != "authenticated" {
+			t.Errorf("Verify(%s) = %+v, %v", name, c, err)
+		}
+	}
+
+	pub, _ := json.Marshal(rsaKey.N.Bytes())
+	for name, tc := range map[string]struct {
+		token string
+		want  error
+	}{
+		"garbage":        {"not-a-token", ErrMalformed},
+		"wrong secret":   {sign(t, "HS256", "", []byte("other"), claims(nil)), ErrSignature},
+		"alg none":       {sign(t, "none", "", nil, claims(nil)), ErrSignature},
+		"public key hs":  {sign(t, "HS256", "", pub, claims(nil)), ErrSignature},
+		"unknown kid":    {sign(t, "RS256", "rsa-2", rsaKey, claims(nil)), ErrSignature},
+		"alg mismatch":   {sign(t, "ES256", "rsa-1", ecKey, claims(nil)), ErrSignature},
+		"expired":        {sign(t, "HS256", "", secret, claims(map[string]interface{}{"exp": now.Unix() - 60})), ErrExpired},
+		"no exp":         {sign(t, "HS256", "", secret, claims(map[string]interface{}{"exp": 0})), ErrExpired},
+		"not yet valid":  {sign(t, "HS256", "", secret, claims(map[string]interface{}{"nbf": now.Unix() + 600})), ErrClaims},
+		"wrong issuer":   {sign(t, "HS256", "", secret, claims(map[string]interface{}{"iss": "evil"})), ErrClaims},
+		"wrong audience": {sign(t, "HS256", "", secret, claims(map[string]interface{}{"aud": "anon"})), ErrClaims},
+	} {
+		if _, err := v.Verify(tc.token); !errors.Is(err, tc.want) {
+			t.Errorf("Verify(%s) error = %v, want %v", name, err, tc.want)
+		}
+	}
+
+	// Tokens within the leeway are still accepted.
+	if _, err := v.Verify(sign(t, "HS256", "", secret, claims(map[string]interface{}{"exp": now.Unix() - 10}))); err != nil {
+		t.Errorf("Verify(within leeway) error = %v", err)
+	}
+
+	if _, err := NewVerifier(nil, nil); err == nil {
+		t.Error("NewVerifier() without keys succeeded")
+	}
+	if _, err := NewVerifier(nil, []byte(`{"keys": [{"kty": "oct"}]}`)); err == nil {
+		t.Error("NewVerifier() with only unsupported keys succeeded")
+	}
+}
@@ -0,0 +1,261 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Edit is one line of an edit script.
+type Edit struct {
+	Op   Op
+	Text string
+}
+
+// maxEditDistance bounds the Myers search. Inputs that differ by more lines
+// than this are reported as a full replacement of the differing middle part.
+const maxEditDistance = 4000
+
+// SplitLines splits s into lines without their terminators. A trailing
+// newline does not produce an empty last line.
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// IsBinary reports whether s looks like binary data rather than text.
+func IsBinary(s string) bool {
+	return strings.IndexByte(s, 0) >= 0 || !utf8.ValidString(s)
+}
+
+// Lines returns a shortest edit script turning a into b.
+func Lines(a, b []string) []Edit {
+	// Common prefix and suffix never need the search.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var edits []Edit
+	for _, l := range a[:pre] {
+		edits = append(edits, Edit{Equal, l})
+	}
+	edits = append(edits, myers(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, l := range a[len(a)-suf:] {
+		edits = append(edits, Edit{Equal, l})
+	}
+	return edits
+}
+
+func myers(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+	limit := max
+	if limit > maxEditDistance {
+		limit = maxEditDistance
+	}
+
+	// trace[d] keeps v for k in [-d-1, d+1] as it was before step d, which is
+	// all the backtracking reads; copying the whole of v for every step
+	// would take O((n+m)*d) memory.
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return replaceAll(a, b)
+	}
+
+	var edits []Edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v, offset := trace[d], d+1
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, Edit{Equal, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, Edit{Insert, b[y-1]})
+			} else {
+				edits = append(edits, Edit{Delete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+func replaceAll(a, b []string) []Edit {
+	edits := make([]Edit, 0, len(a)+len(b))
+	for _, l := range a {
+		edits = append(edits, Edit{Delete, l})
+	}
+	for _, l := range b {
+		edits = append(edits, Edit{Insert, l})
+	}
+	return edits
+}
+
+// Hunk is one section of a unified diff.
+type Hunk struct {
+	Header   string   `json:"header"`
+	OldStart int      `json:"oldStart"`
+	OldLines int      `json:"oldLines"`
+	NewStart int      `json:"newStart"`
+	NewLines int      `json:"newLines"`
+	Lines    []string `json:"lines"` // prefixed with ' ', '-' or '+'
+}
+
+// Hunks groups an edit script into unified diff hunks with the given number
+// of context lines. Changes separated by at most 2*context unchanged lines
+// share a hunk.
+func Hunks(edits []Edit, context int) []Hunk {
+	n := len(edits)
+	oldNo := make([]int, n+1)
+	newNo := make([]int, n+1)
+	for i, e := range edits {
+		oldNo[i+1], newNo[i+1] = oldNo[i], newNo[i]
+		if e.Op != Insert {
+			oldNo[i+1]++
+		}
+		if e.Op != Delete {
+			newNo[i+1]++
+		}
+	}
+
+	var hunks []Hunk
+	for i := 0; i < n; {
+		if edits[i].Op == Equal {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for {
+			for end < n && edits[end].Op != Equal {
+				end++
+			}
+			j := end
+			for j < n && edits[j].Op == Equal {
+				j++
+			}
+			if j < n && j-end <= 2*context {
+				end = j
+				continue
+			}
+			break
+		}
+		stop := end + context
+		if stop > n {
+			stop = n
+		}
+
+		h := Hunk{
+			OldStart: oldNo[start] + 1,
+			OldLines: oldNo[stop] - oldNo[start],
+			NewStart: newNo[start] + 1,
+			NewLines: newNo[stop] - newNo[start],
+		}
+		// An empty range is addressed by the line before it.
+		if h.OldLines == 0 {
+			h.OldStart--
+		}
+		if h.NewLines == 0 {
+			h.NewStart--
+		}
+		h.Header = fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+		for _, e := range edits[start:stop] {
+			h.Lines = append(h.Lines, prefix(e.Op)+e.Text)
+		}
+		hunks = append(hunks, h)
+		i = stop
+	}
+	return hunks
+}
+
+func prefix(op Op) string {
+	switch op {
+	case Delete:
+		return "-"
+	case Insert:
+		return "+"
+	}
+	return " "
+}
+
+// Unified renders hunks as a unified diff between oldName and newName.
+func Unified(oldName, newName string, hunks []Hunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks {
+		b.WriteString(h.Header)
+		b.WriteByte('\n')
+		for _, l := range h.Lines {
+			b.WriteString(l)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,124 @@
+package diff
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func apply(edits []Edit) (a, b []string) {
+	for _, e := range edits {
+		if e.Op != Insert {
+			a = append(a, e.Text)
+		}
+		if e.Op != Delete {
+			b = append(b, e.Text)
+		}
+	}
+	return a, b
+}
+
+func TestLinesRoundTrip(t *testing.T) {
+	cases := [][2]string{
+		{"", ""},
+		{"", "a\nb\n"},
+		{"a\nb\n", ""},
+		{"a\nb\nc\n", "a\nc\n"},
+		{"a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n"},
+		{"one\ntwo\nthree\n", "one\n2\nthree\nfour\n"},
+	}
+	for _, tc := range cases {
+		a, b := SplitLines(tc[0]), SplitLines(tc[1])
+		edits := Lines(a, b)
+		gotA, gotB := apply(edits)
+		if !reflect.DeepEqual(gotA, a) || !reflect.DeepEqual(gotB, b) {
+			t.Errorf("Lines(%q, %q) does not reproduce its inputs: %v", tc[0], tc[1], edits)
+		}
+	}
+}
+
+func TestLinesIsMinimal(t *testing.T) {
+	// Classic Myers example: the shortest edit script has 5 changes.
+	edits := Lines(strings.Split("ABCABBA", ""), strings.Split("CBABAC", ""))
+	changes := 0
+	for _, e := range edits {
+		if e.Op != Equal {
+			changes++
+		}
+	}
+	if changes != 5 {
+		t.Errorf("Lines() made %d changes, want 5", changes)
+	}
+}
+
+func TestLinesBoundsMemory(t *testing.T) {
+	// Inputs that share no line run the search to maxEditDistance. Its
+	// trace must grow with the edit distance, not with the input size.
+	a, b := make([]string, 100000), make([]string, 100000)
+	for i := range a {
+		a[i], b[i] = "a"+strconv.Itoa(i), "b"+strconv.Itoa(i)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	edits := Lines(a, b)
+	runtime.ReadMemStats(&after)
+	if len(edits) != len(a)+len(b) {
+		t.Errorf("Lines() returned %d edits, want a full replacement", len(edits))
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<30 {
+		t.Errorf("Lines() allocated %d MB", alloc>>20)
+	}
+}
+
+func TestHunks(t *testing.T) {
+	var a, b []string
+	for i := 1; i <= 20; i++ {
+		line := strings.Repeat("x", i)
+		a = append(a, line)
+		switch i {
+		case 2:
+			b = append(b, "changed")
+		case 15:
+			// deleted
+		default:
+			b = append(b, line)
+		}
+	}
+	hunks := Hunks(Lines(a, b), 3)
+	if len(hunks) != 2 {
+		t.Fatalf("Hunks() returned %d hunks, want 2: %+v", len(hunks), hunks)
+	}
+	if hunks[0].Header != "@@ -1,5 +1,5 @@" {
+		t.Errorf("first hunk header = %q", hunks[0].Header)
+	}
+	if hunks[1].Header != "@@ -12,7 +12,6 @@" {
+		t.Errorf("second hunk header = %q", hunks[1].Header)
+	}
+	want := []string{" x", "-xx", "+changed", " xxx", " xxxx", " xxxxx"}
+	if !reflect.DeepEqual(hunks[0].Lines, want) {
+		t.Errorf("first hunk lines = %q, want %q", hunks[0].Lines, want)
+	}
+
+	// Nearby changes are merged into one hunk.
+	if got := Hunks(Lines([]string{"a", "b", "c", "d"}, []string{"A", "b", "c", "D"}), 1); len(got) != 1 {
+		t.Errorf("Hunks() split close changes into %d hunks", len(got))
+	}
+}
+
+func TestHunksPureInsertion(t *testing.T) {
+	hunks := Hunks(Lines(nil, []string{"a", "b"}), 3)
+	if len(hunks) != 1 || hunks[0].Header != "@@ -0,0 +1,2 @@" {
+		t.Errorf("Hunks() = %+v", hunks)
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	if IsBinary("hello\nworld") {
+		t.Error("IsBinary(text) = true")
+	}
+	if !IsBinary("PNG\x00\x01") || !IsBinary("\xff\xfe") {
+		t.Error("IsBinary(binary) = false")
+	}
+}
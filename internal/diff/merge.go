@@ -0,0 +1,161 @@
+package diff
+
+import "strings"
+
+// Conflict is a region that both sides changed differently. BaseStart is the
+// 1-based line of the region in the base; Base, Ours and Theirs hold its
+// lines in each version.
+type Conflict struct {
+	BaseStart int      `json:"baseStart"`
+	Base      []string `json:"base"`
+	Ours      []string `json:"ours"`
+	Theirs    []string `json:"theirs"`
+}
+
+// MergeResult is the outcome of a three-way merge. Lines contains the merged
+// text, with conflict markers around every conflicting region.
+type MergeResult struct {
+	Lines     []string
+	Conflicts []Conflict
+}
+
+// region replaces base[Start:End] with Lines.
+type region struct {
+	Start, End int
+	Lines      []string
+}
+
+func regions(edits []Edit) []region {
+	var out []region
+	i := 0
+	var cur *region
+	for _, e := range edits {
+		if e.Op == Equal {
+			if cur != nil {
+				out = append(out, *cur)
+				cur = nil
+			}
+			i++
+			continue
+		}
+		if cur == nil {
+			cur = &region{Start: i, End: i}
+		}
+		if e.Op == Delete {
+			i++
+			cur.End = i
+		} else {
+			cur.Lines = append(cur.Lines, e.Text)
+		}
+	}
+	if cur != nil {
+		out = append(out, *cur)
+	}
+	return out
+}
+
+// applyRegions returns base[start:end] with rs, which must lie inside that range,
+// applied.
+func applyRegions(base []string, start, end int, rs []region) []string {
+	var out []string
+	pos := start
+	for _, r := range rs {
+		out = append(out, base[pos:r.Start]...)
+		out = append(out, r.Lines...)
+		pos = r.End
+	}
+	return append(out, base[pos:end]...)
+}
+
+// Merge3 merges the changes from base to ours and from base to theirs.
+// Changes that touch or overlap are conflicts unless both sides made the same
+// change; conflicting regions are wrapped in markers labelled oursLabel and
+// theirsLabel.
+func Merge3(base, ours, theirs []string, oursLabel, theirsLabel string) MergeResult {
+	a := regions(Lines(base, ours))
+	b := regions(Lines(base, theirs))
+	var res MergeResult
+	pos := 0
+	for len(a) > 0 || len(b) > 0 {
+		// Start a cluster with the earliest region and absorb every region
+		// of either side that touches it.
+		var ca, cb []region
+		start, end := 0, 0
+		if len(b) == 0 || (len(a) > 0 && a[0].Start <= b[0].Start) {
+			start, end = a[0].Start, a[0].End
+			ca, a = a[:1], a[1:]
+		} else {
+			start, end = b[0].Start, b[0].End
+			cb, b = b[:1], b[1:]
+		}
+	absorb:
+		for {
+			switch {
+			case len(a) > 0 && a[0].Start <= end:
+				ca = append(ca, a[0])
+				end = max(end, a[0].End)
+				a = a[1:]
+			case len(b) > 0 && b[0].Start <= end:
+				cb = append(cb, b[0])
+				end = max(end, b[0].End)
+				b = b[1:]
+			default:
+				break absorb
+			}
+		}
+		res.Lines = append(res.Lines, base[pos:start]...)
+		pos = end
+		oursLines := applyRegions(base, start, end, ca)
+		theirsLines := applyRegions(base, start, end, cb)
+		switch {
+		case len(cb) == 0:
+			res.Lines = append(res.Lines, oursLines...)
+		case len(ca) == 0, equalLines(oursLines, theirsLines):
+			res.Lines = append(res.Lines, theirsLines...)
+		default:
+			res.Conflicts = append(res.Conflicts, Conflict{
+				BaseStart: start + 1,
+				Base:      append([]string{}, base[start:end]...),
+				Ours:      oursLines,
+				Theirs:    theirsLines,
+			})
+			res.Lines = append(res.Lines, "<<<<<<< "+oursLabel)
+			res.Lines = append(res.Lines, oursLines...)
+			res.Lines = append(res.Lines, "=======")
+			res.Lines = append(res.Lines, theirsLines...)
+			res.Lines = append(res.Lines, ">>>>>>> "+theirsLabel)
+		}
+	}
+	res.Lines = append(res.Lines, base[pos:]...)
+	return res
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// MergeText is Merge3 on whole texts. The result ends in a newline when the
+// side that changed the final newline (or both, if neither did) has one.
+func MergeText(base, ours, theirs, oursLabel, theirsLabel string) (string, []Conflict) {
+	res := Merge3(SplitLines(base), SplitLines(ours), SplitLines(theirs), oursLabel, theirsLabel)
+	if len(res.Lines) == 0 {
+		return "", res.Conflicts
+	}
+	trailing := strings.HasSuffix(ours, "\n")
+	if trailing == strings.HasSuffix(base, "\n") {
+		trailing = strings.HasSuffix(theirs, "\n")
+	}
+	text := strings.Join(res.Lines, "\n")
+	if trailing {
+		text += "\n"
+	}
+	return text, res.Conflicts
+}
@@ -0,0 +1,48 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeTextClean(t *testing.T) {
+	base := "a\nb\nc\nd\ne\n"
+	ours := "A\nb\nc\nd\ne\n"
+	theirs := "a\nb\nc\nd\nE\nf\n"
+	got, conflicts := MergeText(base, ours, theirs, "ours", "theirs")
+	if want := "A\nb\nc\nd\nE\nf\n"; got != want || conflicts != nil {
+		t.Errorf("MergeText() = %q, %v; want %q", got, conflicts, want)
+	}
+
+	// Identical changes on both sides are not a conflict.
+	got, conflicts = MergeText(base, ours, ours, "ours", "theirs")
+	if got != ours || conflicts != nil {
+		t.Errorf("MergeText(same change) = %q, %v", got, conflicts)
+	}
+}
+
+func TestMergeTextConflict(t *testing.T) {
+	base := "a\nb\nc\n"
+	ours := "a\nB1\nc\n"
+	theirs := "a\nB2\nc\n"
+	got, conflicts := MergeText(base, ours, theirs, "stored", "yours")
+	want := "a\n<<<<<<< stored\nB1\n=======\nB2\n>>>>>>> yours\nc\n"
+	if got != want {
+		t.Errorf("MergeText() = %q, want %q", got, want)
+	}
+	wantConflicts := []Conflict{{BaseStart: 2, Base: []string{"b"}, Ours: []string{"B1"}, Theirs: []string{"B2"}}}
+	if !reflect.DeepEqual(conflicts, wantConflicts) {
+		t.Errorf("conflicts = %+v, want %+v", conflicts, wantConflicts)
+	}
+}
+
+func TestMergeInsertionsAtSamePoint(t *testing.T) {
+	res := Merge3([]string{"a"}, []string{"a", "x"}, []string{"a", "y"}, "o", "t")
+	if len(res.Conflicts) != 1 {
+		t.Errorf("Merge3() conflicts = %+v, want 1", res.Conflicts)
+	}
+	res = Merge3(nil, []string{"x"}, nil, "o", "t")
+	if !reflect.DeepEqual(res.Lines, []string{"x"}) || res.Conflicts != nil {
+		t.Errorf("Merge3(one-sided insert) = %+v", res)
+	}
+}
@@ -0,0 +1,248 @@
+// Package gitrepo reads commits, trees and blobs from local git repositories
+// and bundles with the git binary. It never touches the network: bundles are
+// unpacked into a temporary bare repository and only the file transport is
+// allowed.
+package gitrepo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRev is returned for revisions that could be mistaken for options.
+var ErrInvalidRev = errors.New("invalid revision")
+
+// Repo is a git directory (a bare repository or the .git of a work tree).
+type Repo struct {
+	GitDir string
+}
+
+// Commit is the metadata of one commit.
+type Commit struct {
+	Hash        string
+	AuthorName  string
+	AuthorEmail string
+	Time        time.Time // author time
+	Message     string
+}
+
+// Entry is a blob or submodule of a tree, as listed by ls-tree -r.
+type Entry struct {
+	Path string
+	Mode string // e.g. 100644, 100755, 120000 (symlink), 160000 (submodule)
+	Type string // "blob" or "commit"
+	Hash string
+	Size int64 // -1 for submodules
+}
+
+// IsRegular reports whether the entry is a regular file.
+func (e Entry) IsRegular() bool {
+	return e.Type == "blob" && e.Mode != "120000"
+}
+
+func (e Entry) IsSymlink() bool {
+	return e.Mode == "120000"
+}
+
+func command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_ALLOW_PROTOCOL=file",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL="+os.DevNull,
+	)
+	return cmd
+}
+
+// run runs a git subcommand and returns its output, or its stderr as the
+// error.
+func run(cmd *exec.Cmd, name string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("git %s: %s", name, msg)
+	}
+	return out, nil
+}
+
+func (r Repo) git(ctx context.Context, args ...string) ([]byte, error) {
+	return run(command(ctx, append([]string{"--git-dir", r.GitDir}, args...)...), args[0])
+}
+
+// Open returns the repository at dir, which may be a work tree or a bare
+// repository.
+func Open(ctx context.Context, dir string) (Repo, error) {
+	out, err := run(command(ctx, "-C", dir, "rev-parse", "--absolute-git-dir"), "rev-parse")
+	if err != nil {
+		return Repo{}, err
+	}
+	return Repo{GitDir: strings.TrimSpace(string(out))}, nil
+}
+
+// OpenBundle unpacks a bundle file into a new bare repository under tmpDir.
+// The bundle's HEAD, if it has one, becomes the repository's HEAD.
+func OpenBundle(ctx context.Context, bundle, tmpDir string) (Repo, error) {
+	r := Repo{GitDir: tmpDir}
+	if _, err := run(command(ctx, "init", "--bare", "-q", tmpDir), "init"); err != nil {
+		return r, err
+	}
+	heads, err := r.git(ctx, "bundle", "list-heads", bundle)
+	if err != nil {
+		return r, err
+	}
+	if _, err := r.git(ctx, "fetch", "-q", "--no-tags", bundle, "+refs/*:refs/*"); err != nil {
+		return r, err
+	}
+	for _, line := range strings.Split(string(heads), "\n") {
+		hash, name, _ := strings.Cut(line, " ")
+		if name == "HEAD" {
+			_, err = r.git(ctx, "update-ref", "--no-deref", "HEAD", hash)
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// Resolve returns the commit hash rev names.
+func (r Repo) Resolve(ctx context.Context, rev string) (string, error) {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return "", fmt.Errorf("%w %q", ErrInvalidRev, rev)
+	}
+	out, err := r.git(ctx, "rev-parse", "--verify", "-q", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("%w %q: not a commit", ErrInvalidRev, rev)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// CountCommits counts the commits FirstParentLog would return.
+func (r Repo) CountCommits(ctx context.Context, head, since string) (int, error) {
+	out, err := r.git(ctx, "rev-list", "--count", "--first-parent", revRange(head, since))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+func revRange(head, since string) string {
+	if since == "" {
+		return head
+	}
+	return since + ".." + head
+}
+
+// FirstParentLog returns the commits on the first-parent line of head,
+// oldest first, excluding since and its ancestors when since is set. head
+// and since must be resolved hashes.
+func (r Repo) FirstParentLog(ctx context.Context, head, since string) ([]Commit, error) {
+	out, err := r.git(ctx, "log", "--first-parent", "--reverse", "--format=%H%x00%an%x00%ae%x00%at%x00%B%x1e", revRange(head, since))
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, rec := range strings.Split(string(out), "\x1e") {
+		rec = strings.TrimLeft(rec, "\n")
+		if rec == "" {
+			continue
+		}
+		f := strings.SplitN(rec, "\x00", 5)
+		if len(f) != 5 {
+			return nil, fmt.Errorf("unexpected git log record %q", rec)
+		}
+		secs, err := strconv.ParseInt(f[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected commit time %q", f[3])
+		}
+		commits = append(commits, Commit{Hash: f[0], AuthorName: f[1], AuthorEmail: f[2], Time: time.Unix(secs, 0).UTC(), Message: strings.TrimRight(f[4], "\n")})
+	}
+	return commits, nil
+}
+
+// Tree lists every blob and submodule of a commit.
+func (r Repo) Tree(ctx context.Context, commit string) ([]Entry, error) {
+	out, err := r.git(ctx, "ls-tree", "-r", "-z", "--long", commit)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, rec := range strings.Split(string(out), "\x00") {
+		if rec == "" {
+			continue
+		}
+		meta, p, ok := strings.Cut(rec, "\t")
+		f := strings.Fields(meta)
+		if !ok || len(f) != 4 {
+			return nil, fmt.Errorf("unexpected ls-tree record %q", rec)
+		}
+		size := int64(-1)
+		if f[3] != "-" {
+			if size, err = strconv.ParseInt(f[3], 10, 64); err != nil {
+				return nil, fmt.Errorf("unexpected ls-tree size %q", f[3])
+			}
+		}
+		entries = append(entries, Entry{Path: p, Mode: f[0], Type: f[1], Hash: f[2], Size: size})
+	}
+	return entries, nil
+}
+
+// Blobs returns the contents of the given distinct blobs in one cat-file
+// process.
+func (r Repo) Blobs(ctx context.Context, hashes []string) (map[string][]byte, error) {
+	blobs := make(map[string][]byte, len(hashes))
+	if len(hashes) == 0 {
+		return blobs, nil
+	}
+	cmd := command(ctx, "--git-dir", r.GitDir, "cat-file", "--batch")
+	cmd.Stdin = strings.NewReader(strings.Join(hashes, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(stdout)
+	for range hashes {
+		header, err := br.ReadString('\n')
+		if err != nil {
+			break
+		}
+		f := strings.Fields(header)
+		if len(f) != 3 || f[1] != "blob" {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return nil, fmt.Errorf("git cat-file: unexpected object %q", strings.TrimSpace(header))
+		}
+		size, _ := strconv.Atoi(f[2])
+		data := make([]byte, size+1) // the content and a trailing newline
+		if _, err := io.ReadFull(br, data); err != nil {
+			break
+		}
+		blobs[f[0]] = data[:size]
+	}
+	io.Copy(io.Discard, br)
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("git cat-file: %s", strings.TrimSpace(stderr.String()))
+	}
+	if len(blobs) != len(hashes) {
+		return nil, errors.New("git cat-file: output ended early")
+	}
+	return blobs, nil
+}
@@ -0,0 +1,96 @@
+package gitrepo
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// gitIn runs git in dir with a fixed identity and commit date.
+func gitIn(t *testing.T, dir, date string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Amina", "-c", "user.email=amina@example.com", "-c", "init.defaultBranch=main"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date, "GIT_CONFIG_GLOBAL="+os.DevNull)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	gitIn(t, dir, "", "init", "-q")
+	os.WriteFile(filepath.Join(dir, "main.sw"), []byte("andika(1)\n"), 0644)
+	gitIn(t, dir, "2024-01-02T03:04:05Z", "add", ".")
+	gitIn(t, dir, "2024-01-02T03:04:05Z", "commit", "-q", "-m", "First\n\nWith a body.")
+	os.MkdirAll(filepath.Join(dir, "lib"), 0755)
+	os.WriteFile(filepath.Join(dir, "lib", "util.sw"), []byte("kazi util() {}\n"), 0644)
+	os.Symlink("main.sw", filepath.Join(dir, "link.sw"))
+	gitIn(t, dir, "2024-01-03T00:00:00Z", "add", ".")
+	gitIn(t, dir, "2024-01-03T00:00:00Z", "commit", "-q", "-m", "Second")
+
+	repo, err := Open(ctx, dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, err := repo.Resolve(ctx, "--output=x"); err == nil {
+		t.Errorf("Resolve(option) succeeded")
+	}
+	head, err := repo.Resolve(ctx, "main")
+	if err != nil {
+		t.Fatalf("Resolve(main) error = %v", err)
+	}
+	commits, err := repo.FirstParentLog(ctx, head, "")
+	if err != nil || len(commits) != 2 {
+		t.Fatalf("FirstParentLog() = %+v, %v", commits, err)
+	}
+	first := commits[0]
+	if first.AuthorName != "Amina" || first.AuthorEmail != "amina@example.com" || first.Message != "First\n\nWith a body." ||
+		!first.Time.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("first commit = %+v", first)
+	}
+	if n, _ := repo.CountCommits(ctx, head, first.Hash); n != 1 {
+		t.Errorf("CountCommits(since first) = %d, want 1", n)
+	}
+
+	entries, err := repo.Tree(ctx, head)
+	if err != nil {
+		t.Fatalf("Tree() error = %v", err)
+	}
+	var paths []string
+	var hashes []string
+	for _, e := range entries {
+		paths = append(paths, e.Path)
+		if e.IsRegular() {
+			hashes = append(hashes, e.Hash)
+		} else if !e.IsSymlink() {
+			t.Errorf("entry %s is neither a file nor a symlink", e.Path)
+		}
+	}
+	if want := []string{"lib/util.sw", "link.sw", "main.sw"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("tree paths = %v, want %v", paths, want)
+	}
+	blobs, err := repo.Blobs(ctx, hashes)
+	if err != nil || string(blobs[hashes[1]]) != "andika(1)\n" {
+		t.Errorf("Blobs() = %q, %v", blobs, err)
+	}
+
+	// A bundle of the same history reads back the same commits.
+	bundle := filepath.Join(t.TempDir(), "repo.bundle")
+	gitIn(t, dir, "", "bundle", "create", "-q", bundle, "--all")
+	unpacked, err := OpenBundle(ctx, bundle, filepath.Join(t.TempDir(), "repo.git"))
+	if err != nil {
+		t.Fatalf("OpenBundle() error = %v", err)
+	}
+	if got, err := unpacked.Resolve(ctx, "HEAD"); err != nil || got != head {
+		t.Errorf("bundle HEAD = %s, %v, want %s", got, err, head)
+	}
+}
@@ -0,0 +1,124 @@
+package hooks
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EventType string
+
+const (
+	SessionCreated EventType = "session.created"
+	FilesChanged   EventType = "session.files_changed"
+	RunStarted     EventType = "run.started"
+	RunFinished    EventType = "run.finished"
+)
+
+type Event struct {
+	ID        string                 `json:"id"`
+	Type      EventType              `json:"type"`
+	SessionID string                 `json:"sessionId,omitempty"`
+	ProjectID string                 `json:"projectId,omitempty"`
+	Time      time.Time              `json:"time"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// Hook receives session lifecycle events. Implementations must be safe for
+// concurrent use.
+type Hook interface {
+	Handle(ctx context.Context, e Event) error
+}
+
+// HookFunc adapts a plain function to the Hook interface.
+type HookFunc func(ctx context.Context, e Event) error
+
+func (f HookFunc) Handle(ctx context.Context, e Event) error { return f(ctx, e) }
+
+// Dispatcher fans events out to its hooks in the background so request
+// handlers never wait on slow receivers. Each hook has a queue of QueueSize
+// events worked off by Workers goroutines; an event arriving at a full queue
+// is dropped and counted, so a stalled receiver costs neither memory nor
+// goroutines without bound.
+type Dispatcher struct {
+	Timeout   time.Duration // per hook and event, including retries
+	Workers   int           // delivery goroutines per hook, read by Register
+	QueueSize int           // events waiting per hook, read by Register
+
+	mu      sync.RWMutex
+	queues  []chan Event
+	wg      sync.WaitGroup
+	dropped atomic.Int64
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{Timeout: time.Minute, Workers: 4, QueueSize: 1000}
+}
+
+// Register adds h and starts its workers, which live as long as the process.
+func (d *Dispatcher) Register(h Hook) {
+	q := make(chan Event, max(d.QueueSize, 0))
+	for i := 0; i < max(d.Workers, 1); i++ {
+		go d.work(h, q)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queues = append(d.queues, q)
+}
+
+func (d *Dispatcher) work(h Hook, q <-chan Event) {
+	for e := range q {
+		ctx, cancel := context.WithTimeout(context.Background(), d.Timeout)
+		if err := h.Handle(ctx, e); err != nil {
+			log.Printf("hook delivery of %s (%s) failed: %v", e.Type, e.ID, err)
+		}
+		cancel()
+		d.wg.Done()
+	}
+}
+
+func (d *Dispatcher) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.queues)
+}
+
+// Dropped returns how many deliveries were dropped because a hook's queue
+// was full.
+func (d *Dispatcher) Dropped() int64 {
+	return d.dropped.Load()
+}
+
+// Emit stamps e with an ID and time if missing and queues it for every hook.
+// It never blocks.
+func (d *Dispatcher) Emit(e Event) {
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, q := range d.queues {
+		d.wg.Add(1)
+		select {
+		case q <- e:
+		default:
+			d.wg.Done()
+			// Log the 1st, 2nd, 4th, ... drop rather than flood the log.
+			if n := d.dropped.Add(1); n&(n-1) == 0 {
+				log.Printf("hook queue full, dropped %s (%s); %d dropped so far", e.Type, e.ID, n)
+			}
+		}
+	}
+}
+
+// Wait blocks until all queued deliveries have finished.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
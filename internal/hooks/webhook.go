@@ -0,0 +1,131 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderEvent     = "X-Swalang-Event"
+	HeaderDelivery  = "X-Swalang-Delivery"
+	HeaderTimestamp = "X-Swalang-Timestamp"
+	HeaderSignature = "X-Swalang-Signature"
+)
+
+// Webhook POSTs events as JSON to a URL. When Secret is set, each request is
+// signed with HMAC-SHA256 over "<timestamp>.<body>" and the hex digest is sent
+// as "sha256=<digest>" in the X-Swalang-Signature header.
+type Webhook struct {
+	URL        string
+	Secret     string
+	Events     []EventType // empty means all events
+	MaxRetries int
+	Backoff    time.Duration // doubled after every failed attempt
+	Client     *http.Client
+}
+
+func NewWebhook(url, secret string) *Webhook {
+	return &Webhook{
+		URL:        url,
+		Secret:     secret,
+		MaxRetries: 4,
+		Backoff:    500 * time.Millisecond,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Sign returns the signature a receiver should expect for body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhook) wants(t EventType) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) Handle(ctx context.Context, e Event) error {
+	if !w.wants(e.Type) {
+		return nil
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.Backoff
+	var lastErr error
+	for attempt := 0; attempt <= w.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w (last error: %v)", ctx.Err(), lastErr)
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		retry, err := w.deliver(ctx, e, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+	return lastErr
+}
+
+// deliver makes a single attempt and reports whether a failure is worth
+// retrying (network errors, 429 and 5xx responses).
+func (w *Webhook) deliver(ctx context.Context, e Event, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(e.Type))
+	req.Header.Set(HeaderDelivery, e.ID)
+	req.Header.Set(HeaderTimestamp, ts)
+	if w.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(w.Secret, ts, body))
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	// Drain a bounded amount so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook %s responded %s", w.URL, resp.Status)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
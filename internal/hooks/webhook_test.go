@@ -0,0 +1,127 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignsPayload(t *testing.T) {
+	received := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := Sign("s3cret", r.Header.Get(HeaderTimestamp), body)
+		if got := r.Header.Get(HeaderSignature); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if got := r.Header.Get(HeaderEvent); got != string(RunFinished) {
+			t.Errorf("event header = %q, want %q", got, RunFinished)
+		}
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		received <- e
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher()
+	d.Register(NewWebhook(srv.URL, "s3cret"))
+	d.Emit(Event{Type: RunFinished, SessionID: "abc", Data: map[string]interface{}{"exitCode": 0}})
+	d.Wait()
+
+	select {
+	case e := <-received:
+		if e.SessionID != "abc" || e.ID == "" || e.Time.IsZero() {
+			t.Errorf("received event = %+v", e)
+		}
+	default:
+		t.Fatal("webhook was not delivered")
+	}
+}
+
+func TestWebhookRetriesServerErrors(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	wh := NewWebhook(srv.URL, "")
+	wh.Backoff = time.Millisecond
+	if err := wh.Handle(context.Background(), Event{ID: "1", Type: RunStarted}); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("receiver called %d times, want 3", calls)
+	}
+}
+
+func TestWebhookDoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	wh := NewWebhook(srv.URL, "")
+	wh.Backoff = time.Millisecond
+	if err := wh.Handle(context.Background(), Event{ID: "1", Type: RunStarted}); err == nil {
+		t.Fatal("Handle() succeeded on a 400 response")
+	}
+	if calls != 1 {
+		t.Errorf("receiver called %d times, want 1", calls)
+	}
+}
+
+func TestWebhookEventFilter(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer srv.Close()
+
+	wh := NewWebhook(srv.URL, "")
+	wh.Events = []EventType{RunFinished}
+	wh.Handle(context.Background(), Event{ID: "1", Type: FilesChanged})
+	wh.Handle(context.Background(), Event{ID: "2", Type: RunFinished})
+	if calls != 1 {
+		t.Errorf("receiver called %d times, want 1", calls)
+	}
+}
+
+func TestDispatcherDropsWhenQueueFull(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	var handled atomic.Int32
+	d := NewDispatcher()
+	d.Workers, d.QueueSize = 1, 1
+	d.Register(HookFunc(func(ctx context.Context, e Event) error {
+		started <- struct{}{}
+		<-release
+		handled.Add(1)
+		return nil
+	}))
+
+	d.Emit(Event{Type: RunStarted})
+	<-started // the worker holds the first event; the next one waits in the queue
+	d.Emit(Event{Type: RunStarted})
+	d.Emit(Event{Type: RunStarted})
+	if got := d.Dropped(); got != 1 {
+		t.Errorf("dropped = %d, want 1", got)
+	}
+	close(release)
+	d.Wait()
+	if got := handled.Load(); got != 2 {
+		t.Errorf("handled = %d, want 2", got)
+	}
+}
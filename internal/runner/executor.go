@@ -1,8 +1,10 @@
 package runner
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"os/exec"
 	"sync"
@@ -55,3 +57,60 @@ func RunSwalang(ctx context.Context, binPath, workDir, entry string) (*Execution
 		Stderr: stderrBuf.String(),
 	}, cmdErr
 }
+
+// StreamSwalang runs entry like RunSwalang but hands every output line to
+// onLine as it is produced. Calls to onLine are serialised, so it may write to
+// a single connection without further locking.
+func StreamSwalang(ctx context.Context, binPath, workDir, entry string, args []string, onLine func(stream, line string)) error {
+	cmd := exec.CommandContext(ctx, binPath, append([]string{entry}, args...)...)
+	cmd.Dir = workDir
+
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	scan := func(pipe io.Reader, stream string) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(pipe)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			mu.Lock()
+			onLine(stream, scanner.Text())
+			mu.Unlock()
+		}
+	}
+
+	wg.Add(2)
+	go scan(stdoutPipe, "stdout")
+	go scan(stderrPipe, "stderr")
+
+	// The pipes must be drained before Wait closes them.
+	wg.Wait()
+	return cmd.Wait()
+}
+
+// ExitCode extracts the process exit code from an error returned by
+// RunSwalang or StreamSwalang. It returns -1 if the process did not exit
+// normally (e.g. it was killed on timeout or never started).
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
@@ -51,3 +51,39 @@ func TestRunSwalang(t *testing.T) {
 		t.Errorf("RunSwalang() stderr = %q, want %q", result.Stderr, "")
 	}
 }
+
+func TestStreamSwalang(t *testing.T) {
+	mockBinDir, err := os.MkdirTemp("", "mock-bin")
+	if err != nil {
+		t.Fatalf("Failed to create mock bin directory: %v", err)
+	}
+	defer os.RemoveAll(mockBinDir)
+
+	// Echo the entry and arguments, write to stderr and exit non-zero.
+	mockBinPath := filepath.Join(mockBinDir, "swalang")
+	mockScript := "#!/bin/sh\necho \"$1\"\necho \"$2 $3\"\necho oops >&2\nexit 3\n"
+	if err := os.WriteFile(mockBinPath, []byte(mockScript), 0755); err != nil {
+		t.Fatalf("Failed to write mock swalang binary: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var stdout, stderr []string
+	err = StreamSwalang(ctx, mockBinPath, mockBinDir, "app.sw", []string{"a", "b"}, func(stream, line string) {
+		if stream == "stdout" {
+			stdout = append(stdout, line)
+		} else {
+			stderr = append(stderr, line)
+		}
+	})
+	if got := ExitCode(err); got != 3 {
+		t.Fatalf("ExitCode() = %d, want 3 (err = %v)", got, err)
+	}
+	if len(stdout) != 2 || stdout[0] != "app.sw" || stdout[1] != "a b" {
+		t.Errorf("StreamSwalang() stdout = %q", stdout)
+	}
+	if len(stderr) != 1 || stderr[0] != "oops" {
+		t.Errorf("StreamSwalang() stderr = %q", stderr)
+	}
+}
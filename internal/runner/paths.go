@@ -0,0 +1,67 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+var ErrInvalidPath = errors.New("invalid path")
+
+// Device names that cannot be used as file names on Windows hosts.
+var reservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// ValidatePath checks that p is a relative, slash-separated path that stays
+// inside a sandbox and returns its cleaned form. A maxDepth of 0 disables the
+// depth check.
+func ValidatePath(p string, maxDepth int) (string, error) {
+	if p == "" {
+		return "", fmt.Errorf("%w: empty path", ErrInvalidPath)
+	}
+	if strings.ContainsRune(p, 0) {
+		return "", fmt.Errorf("%w: path contains NUL byte", ErrInvalidPath)
+	}
+	if strings.Contains(p, "\\") {
+		return "", fmt.Errorf("%w: path contains backslash", ErrInvalidPath)
+	}
+	if strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("%w: absolute paths are not allowed", ErrInvalidPath)
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return "", fmt.Errorf("%w: path escapes the sandbox", ErrInvalidPath)
+		}
+	}
+
+	clean := path.Clean(p)
+	if clean == "." {
+		return "", fmt.Errorf("%w: empty path", ErrInvalidPath)
+	}
+
+	segments := strings.Split(clean, "/")
+	if maxDepth > 0 && len(segments) > maxDepth {
+		return "", fmt.Errorf("%w: path is deeper than %d levels", ErrInvalidPath, maxDepth)
+	}
+	for _, seg := range segments {
+		for _, r := range seg {
+			if r < 0x20 || r == 0x7f {
+				return "", fmt.Errorf("%w: path contains control characters", ErrInvalidPath)
+			}
+		}
+		base := strings.ToLower(seg)
+		if i := strings.IndexByte(base, '.'); i >= 0 {
+			base = base[:i]
+		}
+		if reservedNames[base] {
+			return "", fmt.Errorf("%w: %q is a reserved name", ErrInvalidPath, seg)
+		}
+	}
+	return clean, nil
+}
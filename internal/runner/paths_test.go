@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidatePath(t *testing.T) {
+	valid := map[string]string{
+		"main.sw":            "main.sw",
+		"src/lib/util.sw":    "src/lib/util.sw",
+		"./src//main.sw":     "src/main.sw",
+		"data/console.txt":   "data/console.txt",
+		"docs/.hidden/a.txt": "docs/.hidden/a.txt",
+	}
+	for in, want := range valid {
+		got, err := ValidatePath(in, 8)
+		if err != nil {
+			t.Errorf("ValidatePath(%q) error = %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ValidatePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		".",
+		"../main.sw",
+		"src/../../etc/passwd",
+		"src/../main.sw",
+		"/etc/passwd",
+		"src\\main.sw",
+		"main\x00.sw",
+		"src/\nmain.sw",
+		"CON",
+		"src/nul.txt",
+		"lpt1.sw",
+		strings.Repeat("a/", 8) + "main.sw",
+	}
+	for _, in := range invalid {
+		if _, err := ValidatePath(in, 8); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("ValidatePath(%q) error = %v, want ErrInvalidPath", in, err)
+		}
+	}
+}
+
+func TestValidatePathNoDepthLimit(t *testing.T) {
+	deep := strings.Repeat("a/", 64) + "main.sw"
+	if _, err := ValidatePath(deep, 0); err != nil {
+		t.Errorf("ValidatePath() with maxDepth 0 error = %v", err)
+	}
+}
@@ -1,8 +1,10 @@
 package runner
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+
 	"github.com/google/uuid"
 )
 
@@ -16,3 +18,23 @@ func CreateSandbox(baseDir string) (string, error) {
 func CleanupSandbox(path string) {
 	os.RemoveAll(path)
 }
+
+// WriteFiles materialises a path -> content map inside a sandbox directory,
+// creating subdirectories as needed. Every path is checked with ValidatePath
+// so nothing can be written outside dir.
+func WriteFiles(dir string, files map[string]string) error {
+	for p, content := range files {
+		clean, err := ValidatePath(p, 0)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		fullPath := filepath.Join(dir, filepath.FromSlash(clean))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", clean, err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", clean, err)
+		}
+	}
+	return nil
+}
@@ -37,3 +37,26 @@ func TestCleanupSandbox(t *testing.T) {
 		t.Errorf("Sandbox directory was not cleaned up")
 	}
 }
+
+func TestWriteFiles(t *testing.T) {
+	path, err := CreateSandbox(os.TempDir())
+	if err != nil {
+		t.Fatalf("CreateSandbox() error = %v", err)
+	}
+	defer CleanupSandbox(path)
+
+	files := map[string]string{"main.sw": "main", "lib/util.sw": "util"}
+	if err := WriteFiles(path, files); err != nil {
+		t.Fatalf("WriteFiles() error = %v", err)
+	}
+	for p, want := range files {
+		got, err := os.ReadFile(filepath.Join(path, p))
+		if err != nil || string(got) != want {
+			t.Errorf("file %s = %q, %v; want %q", p, got, err, want)
+		}
+	}
+
+	if err := WriteFiles(path, map[string]string{"../escape.sw": "x"}); err == nil {
+		t.Errorf("WriteFiles() accepted a path outside the sandbox")
+	}
+}